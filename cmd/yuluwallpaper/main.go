@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"errors"
+	"fmt"
 	"image/color"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
@@ -19,12 +24,18 @@ import (
 
 	wallapp "yuluwallpaper/internal/app"
 	"yuluwallpaper/internal/autostart"
+	"yuluwallpaper/internal/calendar"
 	"yuluwallpaper/internal/config"
 	"yuluwallpaper/internal/logger"
+	"yuluwallpaper/internal/schedule"
+	"yuluwallpaper/internal/solar"
+	"yuluwallpaper/internal/source"
+	"yuluwallpaper/internal/state"
 )
 
 const appID = "com.yulu.wallpaper"
 const appDisplayName = "Yulu Wallpaper"
+const customCityLabel = "自定义"
 
 //go:embed assets/fonts/NotoSansCJKsc-Regular.otf
 var appFontData []byte
@@ -50,17 +61,33 @@ func main() {
 		assetsDir = os.TempDir()
 	}
 
-	service := wallapp.NewService(cfg, assetsDir)
-	go service.Run()
+	var store *state.Store
+	if statePath, err := config.StatePath(); err != nil {
+		log.Printf("state path failed: %v", err)
+	} else if store, err = state.Open(statePath); err != nil {
+		log.Printf("state load failed: %v", err)
+	}
+
+	service := wallapp.NewService(cfg, assetsDir, store)
+	service.SetOverlayFont(appFontData)
+	secretsPath, err := config.SecretsPath()
+	if err != nil {
+		log.Printf("secrets path failed: %v", err)
+	} else {
+		service.SetSecretsPath(secretsPath)
+	}
 
 	fyneApp := app.NewWithID(appID)
 	fyneApp.Settings().SetTheme(appTheme{})
-	settingsUI := newSettingsUI(fyneApp, &cfg, logPath, func(newCfg config.Config) {
+	testProxy := func(proxy config.Proxy) error {
+		return wallapp.TestConnection(context.Background(), proxy, secretsPath)
+	}
+	settingsUI := newSettingsUI(fyneApp, &cfg, logPath, service.UpcomingChanges, service.Usage, testProxy, func(newCfg config.Config) {
 		cfg = newCfg
 		service.UpdateConfig(newCfg)
 	})
 
-	menu := fyne.NewMenu("",
+	menuItems := []*fyne.MenuItem{
 		fyne.NewMenuItem("设置", func() {
 			settingsUI.ApplyConfig(cfg)
 			settingsUI.Show()
@@ -68,38 +95,106 @@ func main() {
 		fyne.NewMenuItem("立即刷新", func() {
 			service.RequestRefresh()
 		}),
+		fyne.NewMenuItem("收藏当前壁纸", func() {
+			if err := service.AddFavorite(); err != nil {
+				log.Printf("add favorite failed: %v", err)
+			}
+		}),
 		fyne.NewMenuItemSeparator(),
 		newQuitMenuItem(func() {
 			service.Stop()
 			fyneApp.Quit()
 		}),
-	)
+	}
+	menu := fyne.NewMenu("", menuItems...)
+	statusItem := fyne.NewMenuItem("", nil)
+	statusItem.Disabled = true
+	service.SetDegradedHandler(func(step wallapp.FallbackStep) {
+		menu.Items = menuItems
+		if step != "" {
+			statusItem.Label = "离线模式：" + fallbackLabels[step]
+			menu.Items = append([]*fyne.MenuItem{statusItem, fyne.NewMenuItemSeparator()}, menuItems...)
+		}
+		menu.Refresh()
+	})
+	service.SetShownHandler(func(meta source.Metadata) {
+		setTrayTooltip(trayTooltip(meta))
+	})
 
 	if desktopApp, ok := fyneApp.(desktop.App); ok {
 		desktopApp.SetSystemTrayMenu(menu)
 		desktopApp.SetSystemTrayIcon(appIconResource())
 	}
+	go service.Run()
 
 	fyneApp.Run()
 }
 
+// trayTooltip names the app and the current wallpaper.
+func trayTooltip(meta source.Metadata) string {
+	lines := []string{appDisplayName}
+	title := meta.Title
+	if meta.Author != "" && !strings.Contains(meta.Copyright, meta.Author) {
+		title = strings.TrimSpace(title + " —— " + meta.Author)
+	}
+	for _, line := range []string{title, meta.Copyright} {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fallbackLabels describe in the tray where an offline wallpaper came from.
+var fallbackLabels = map[wallapp.FallbackStep]string{
+	wallapp.FallbackQueue:     "使用预取的图片",
+	wallapp.FallbackFavorites: "使用收藏",
+	wallapp.FallbackHistory:   "使用历史壁纸",
+	wallapp.FallbackEmbedded:  "使用内置壁纸",
+	wallapp.FallbackQuote:     "使用生成的语录卡片",
+}
+
 type settingsUI struct {
 	window         fyne.Window
 	intervalSelect *widget.Select
+	intervalEntry  *widget.Entry
+	scheduleEntry  *widget.Entry
+	upcomingLabel  *widget.Label
 	layoutSelect   *widget.Select
+	citySelect     *widget.Select
+	latitudeEntry  *widget.Entry
+	longitudeEntry *widget.Entry
+	dayNightCheck  *widget.Check
+	sunLabel       *widget.Label
+	festivalCheck  *widget.Check
+	termLabelCheck *widget.Check
 	autoStartCheck *widget.Check
+	creditCheck    *widget.Check
+	proxySelect    *widget.Select
+	proxyEntry     *widget.Entry
+	proxyTestBtn   *widget.Button
+	proxyStatus    *widget.Label
+	dailyEntry     *widget.Entry
+	monthlyEntry   *widget.Entry
+	usageLabel     *widget.Label
 
 	labelToMinutes map[string]int
 	logPath        string
+	upcoming       func(n int) []time.Time
+	usage          func(now time.Time) wallapp.Usage
+	testProxy      func(config.Proxy) error
 
 	onApply    func(config.Config)
 	currentCfg *config.Config
 }
 
-func newSettingsUI(fyneApp fyne.App, cfg *config.Config, logPath string, onApply func(config.Config)) *settingsUI {
+func newSettingsUI(fyneApp fyne.App, cfg *config.Config, logPath string, upcoming func(n int) []time.Time, usage func(time.Time) wallapp.Usage, testProxy func(config.Proxy) error, onApply func(config.Config)) *settingsUI {
 	ui := &settingsUI{
 		window:     fyneApp.NewWindow("壁纸设置"),
 		logPath:    logPath,
+		upcoming:   upcoming,
+		usage:      usage,
+		testProxy:  testProxy,
 		onApply:    onApply,
 		currentCfg: cfg,
 	}
@@ -112,14 +207,92 @@ func newSettingsUI(fyneApp fyne.App, cfg *config.Config, logPath string, onApply
 		labelToMinutes[opt.Label] = opt.Minutes
 	}
 
-	ui.intervalSelect = widget.NewSelect(labels, nil)
+	ui.intervalEntry = widget.NewEntry()
+	ui.intervalEntry.SetPlaceHolder("自定义，如 90m")
+	ui.intervalSelect = widget.NewSelect(labels, func(label string) {
+		if label != "" {
+			ui.intervalEntry.SetText("")
+		}
+	})
+	ui.intervalEntry.OnChanged = func(text string) {
+		if text != "" && ui.intervalSelect.Selected != "" {
+			ui.intervalSelect.ClearSelected()
+		}
+	}
+	ui.scheduleEntry = widget.NewEntry()
+	ui.scheduleEntry.SetPlaceHolder("如 0 9,13,18 * * 1-5 或 09:00,13:30")
+	ui.scheduleEntry.OnChanged = func(string) {
+		ui.refreshUpcoming()
+	}
+	ui.upcomingLabel = widget.NewLabel("")
 	ui.layoutSelect = widget.NewSelect([]string{"平铺", "拉伸", "适应", "填充", "居中"}, nil)
 	ui.autoStartCheck = widget.NewCheck("开机自启动", nil)
+	ui.creditCheck = widget.NewCheck("在右下角标注标题、作者与版权", nil)
+
+	cityNames := []string{customCityLabel}
+	for _, city := range config.CityPresets() {
+		cityNames = append(cityNames, city.Name)
+	}
+	ui.latitudeEntry = widget.NewEntry()
+	ui.latitudeEntry.SetPlaceHolder("纬度")
+	ui.longitudeEntry = widget.NewEntry()
+	ui.longitudeEntry.SetPlaceHolder("经度")
+	ui.sunLabel = widget.NewLabel("")
+	ui.citySelect = widget.NewSelect(cityNames, func(name string) {
+		city, ok := config.CityByName(name)
+		if ok {
+			ui.latitudeEntry.SetText(strconv.FormatFloat(city.Latitude, 'f', 4, 64))
+			ui.longitudeEntry.SetText(strconv.FormatFloat(city.Longitude, 'f', 4, 64))
+			ui.latitudeEntry.Disable()
+			ui.longitudeEntry.Disable()
+		} else {
+			ui.latitudeEntry.Enable()
+			ui.longitudeEntry.Enable()
+		}
+		ui.refreshSunTimes()
+	})
+	ui.latitudeEntry.OnChanged = func(string) { ui.refreshSunTimes() }
+	ui.longitudeEntry.OnChanged = func(string) { ui.refreshSunTimes() }
+	ui.dayNightCheck = widget.NewCheck("按日出日落切换昼夜壁纸", nil)
+	ui.termLabelCheck = widget.NewCheck("在壁纸上标注节气或节日", nil)
+	ui.festivalCheck = widget.NewCheck("节气与传统节日使用主题壁纸", func(checked bool) {
+		if checked {
+			ui.termLabelCheck.Enable()
+		} else {
+			ui.termLabelCheck.Disable()
+		}
+	})
+
+	proxyLabels := make([]string, 0, len(proxyModes))
+	for _, mode := range proxyModes {
+		proxyLabels = append(proxyLabels, mode.label)
+	}
+	ui.proxyEntry = widget.NewEntry()
+	ui.proxySelect = widget.NewSelect(proxyLabels, func(label string) {
+		mode := proxyModeByLabel(label)
+		ui.proxyEntry.SetPlaceHolder(mode.placeholder)
+		if mode.placeholder == "" {
+			ui.proxyEntry.Disable()
+		} else {
+			ui.proxyEntry.Enable()
+		}
+		ui.proxyStatus.SetText("")
+	})
+	ui.proxyStatus = widget.NewLabel("")
+	ui.proxyStatus.Wrapping = fyne.TextWrapWord
+	ui.proxyTestBtn = widget.NewButton("测试连接", ui.runProxyTest)
+	ui.dailyEntry = widget.NewEntry()
+	ui.dailyEntry.SetPlaceHolder("不限")
+	ui.monthlyEntry = widget.NewEntry()
+	ui.monthlyEntry.SetPlaceHolder("不限")
+	ui.usageLabel = widget.NewLabel("")
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
-			{Text: "更换周期", Widget: ui.intervalSelect},
+			{Text: "更换周期", Widget: container.NewGridWithColumns(2, ui.intervalSelect, ui.intervalEntry)},
+			{Text: "定时计划", Widget: ui.scheduleEntry, HintText: "填写后按计划更换，忽略更换周期"},
 			{Text: "桌面布局", Widget: ui.layoutSelect},
+			{Text: "图片信息", Widget: ui.creditCheck},
 		},
 	}
 
@@ -132,7 +305,34 @@ func newSettingsUI(fyneApp fyne.App, cfg *config.Config, logPath string, onApply
 	header := container.NewVBox(title, subtitle)
 
 	formCard := widget.NewCard("基础设置", "让桌面在时光里悄然更迭", form)
+	upcomingCard := widget.NewCard("接下来", "最近五次计划更换", ui.upcomingLabel)
+	dayNightForm := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "所在城市", Widget: ui.citySelect},
+			{Text: "经纬度", Widget: container.NewGridWithColumns(2, ui.latitudeEntry, ui.longitudeEntry)},
+		},
+	}
+	dayNightCard := widget.NewCard("昼夜", "日出而明，日落而静", container.NewVBox(dayNightForm, ui.sunLabel, ui.dayNightCheck))
+	festivalHint := "今日无节令"
+	if name, ok := calendar.Theme(time.Now()); ok {
+		festivalHint = "今日" + name
+	}
+	festivalCard := widget.NewCard("节令", festivalHint, container.NewVBox(ui.festivalCheck, ui.termLabelCheck))
 	autoCard := widget.NewCard("启动方式", "静默守候，需要时即现", container.NewVBox(ui.autoStartCheck))
+	proxyForm := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "代理方式", Widget: ui.proxySelect},
+			{Text: "代理地址", Widget: ui.proxyEntry, HintText: "用户名与密码写在 secrets.json"},
+		},
+	}
+	proxyCard := widget.NewCard("网络代理", "山高路远，自有捷径", container.NewVBox(proxyForm, container.NewHBox(ui.proxyTestBtn), ui.proxyStatus))
+	budgetForm := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "每日上限", Widget: ui.dailyEntry, HintText: "单位 MB，留空不限"},
+			{Text: "每月上限", Widget: ui.monthlyEntry, HintText: "达到上限后只使用本地图片"},
+		},
+	}
+	budgetCard := widget.NewCard("流量", "细水长流", container.NewVBox(budgetForm, ui.usageLabel))
 
 	saveBtn := widget.NewButton("保存", func() {
 		newCfg, err := ui.configFromInputs()
@@ -160,11 +360,16 @@ func newSettingsUI(fyneApp fyne.App, cfg *config.Config, logPath string, onApply
 		header,
 		widget.NewSeparator(),
 		formCard,
+		upcomingCard,
+		dayNightCard,
+		festivalCard,
 		autoCard,
+		proxyCard,
+		budgetCard,
 		buttons,
 	)
-	ui.window.SetContent(container.NewPadded(content))
-	ui.window.Resize(fyne.NewSize(420, 320))
+	ui.window.SetContent(container.NewPadded(container.NewVScroll(content)))
+	ui.window.Resize(fyne.NewSize(420, 760))
 	ui.window.SetCloseIntercept(func() {
 		ui.window.Hide()
 	})
@@ -179,7 +384,10 @@ func (ui *settingsUI) ApplyConfig(cfg config.Config) {
 	label := config.IntervalLabel(cfg.IntervalMinutes)
 	if label != "" {
 		ui.intervalSelect.SetSelected(label)
+	} else {
+		ui.intervalEntry.SetText(config.FormatInterval(cfg.IntervalMinutes))
 	}
+	ui.scheduleEntry.SetText(cfg.Schedule)
 
 	switch cfg.Layout {
 	case config.LayoutTile:
@@ -195,19 +403,129 @@ func (ui *settingsUI) ApplyConfig(cfg config.Config) {
 	}
 
 	ui.autoStartCheck.SetChecked(cfg.AutoStart)
+	ui.creditCheck.SetChecked(cfg.Credit)
+	if _, ok := config.CityByName(cfg.Location.City); ok {
+		ui.citySelect.SetSelected(cfg.Location.City)
+	} else {
+		ui.citySelect.SetSelected(customCityLabel)
+		ui.latitudeEntry.SetText(strconv.FormatFloat(cfg.Location.Latitude, 'f', 4, 64))
+		ui.longitudeEntry.SetText(strconv.FormatFloat(cfg.Location.Longitude, 'f', 4, 64))
+	}
+	ui.dayNightCheck.SetChecked(cfg.DayNight.Enabled)
+	ui.termLabelCheck.SetChecked(cfg.Festival.Overlay)
+	ui.festivalCheck.SetChecked(cfg.Festival.Enabled)
+	ui.festivalCheck.OnChanged(cfg.Festival.Enabled)
+	ui.proxySelect.SetSelected(proxyModeByValue(cfg.Proxy.Mode).label)
+	ui.proxyEntry.SetText(cfg.Proxy.URL)
+	ui.proxyStatus.SetText("")
+	ui.dailyEntry.SetText(formatCap(cfg.Network.DailyMB))
+	ui.monthlyEntry.SetText(formatCap(cfg.Network.MonthlyMB))
+	ui.refreshUpcoming()
+	ui.refreshUsage()
+}
+
+// scheduleError explains a schedule.Parse error to the user.
+func scheduleError(err error) error {
+	if errors.Is(err, schedule.ErrNeverFires) {
+		return errors.New("定时计划永远不会触发，请检查日期与月份（例如 2 月没有 30、31 日）")
+	}
+	return fmt.Errorf("定时计划格式有误：%v", err)
+}
+
+func (ui *settingsUI) refreshUpcoming() {
+	var times []time.Time
+	if expr := strings.TrimSpace(ui.scheduleEntry.Text); expr != "" {
+		plan, err := schedule.Parse(expr)
+		if err != nil {
+			ui.upcomingLabel.SetText(scheduleError(err).Error())
+			return
+		}
+		times = schedule.Upcoming(plan, time.Now(), 5)
+	} else if ui.upcoming != nil {
+		times = ui.upcoming(5)
+	}
+	if len(times) == 0 {
+		ui.upcomingLabel.SetText("暂无计划")
+		return
+	}
+
+	weekdays := []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+	lines := make([]string, 0, len(times))
+	for _, t := range times {
+		lines = append(lines, t.Format("01-02 ")+weekdays[t.Weekday()]+t.Format(" 15:04"))
+	}
+	ui.upcomingLabel.SetText(strings.Join(lines, "\n"))
+}
+
+// refreshUsage shows what was downloaded today and this month, in total
+// and per source.
+func (ui *settingsUI) refreshUsage() {
+	if ui.usage == nil {
+		return
+	}
+	usage := ui.usage(time.Now())
+	lines := []string{
+		"今日已下载 " + formatBytes(usage.Day),
+		"本月已下载 " + formatBytes(usage.Month),
+	}
+	for _, su := range usage.Sources {
+		lines = append(lines, fmt.Sprintf("%s：今日 %s，本月 %s", su.Name, formatBytes(su.Day), formatBytes(su.Month)))
+	}
+	ui.usageLabel.SetText(strings.Join(lines, "\n"))
+}
+
+func formatBytes(n int64) string {
+	return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+}
+
+func formatCap(mb int) string {
+	if mb <= 0 {
+		return ""
+	}
+	return strconv.Itoa(mb)
+}
+
+func parseCap(text, name string) (int, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, nil
+	}
+	mb, err := strconv.Atoi(text)
+	if err != nil || mb < 0 {
+		return 0, fmt.Errorf("%s需为不小于 0 的整数（MB）", name)
+	}
+	return mb, nil
 }
 
 func (ui *settingsUI) Show() {
+	ui.refreshUsage()
+	if proxyModeByLabel(ui.proxySelect.Selected).value == config.ProxyPAC {
+		ui.runProxyTest()
+	}
 	ui.window.Show()
 	ui.window.RequestFocus()
 }
 
 func (ui *settingsUI) configFromInputs() (config.Config, error) {
 	minutes, ok := ui.labelToMinutes[ui.intervalSelect.Selected]
+	if custom := strings.TrimSpace(ui.intervalEntry.Text); custom != "" {
+		parsed, err := config.ParseInterval(custom)
+		if err != nil || parsed < config.MinIntervalMinutes || parsed > config.MaxIntervalMinutes {
+			return config.Config{}, fmt.Errorf("自定义周期需在 %s 到 %s 之间", config.FormatInterval(config.MinIntervalMinutes), config.FormatInterval(config.MaxIntervalMinutes))
+		}
+		minutes, ok = parsed, true
+	}
 	if !ok {
 		return config.Config{}, errors.New("请选择更换周期")
 	}
 
+	scheduleExpr := strings.TrimSpace(ui.scheduleEntry.Text)
+	if scheduleExpr != "" {
+		if _, err := schedule.Parse(scheduleExpr); err != nil {
+			return config.Config{}, scheduleError(err)
+		}
+	}
+
 	layout := config.LayoutStretch
 	switch ui.layoutSelect.Selected {
 	case "平铺":
@@ -220,11 +538,135 @@ func (ui *settingsUI) configFromInputs() (config.Config, error) {
 		layout = config.LayoutCenter
 	}
 
-	return config.Config{
-		IntervalMinutes: minutes,
-		Layout:          layout,
-		AutoStart:       ui.autoStartCheck.Checked,
-	}, nil
+	location, err := ui.locationFromInputs()
+	if err != nil {
+		return config.Config{}, err
+	}
+	proxy, err := ui.proxyFromInputs()
+	if err != nil {
+		return config.Config{}, err
+	}
+	dailyMB, err := parseCap(ui.dailyEntry.Text, "每日上限")
+	if err != nil {
+		return config.Config{}, err
+	}
+	monthlyMB, err := parseCap(ui.monthlyEntry.Text, "每月上限")
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	cfg := *ui.currentCfg
+	cfg.IntervalMinutes = minutes
+	cfg.Schedule = scheduleExpr
+	cfg.Layout = layout
+	cfg.AutoStart = ui.autoStartCheck.Checked
+	cfg.Credit = ui.creditCheck.Checked
+	cfg.Location = location
+	cfg.DayNight.Enabled = ui.dayNightCheck.Checked
+	cfg.Festival.Enabled = ui.festivalCheck.Checked
+	cfg.Festival.Overlay = ui.termLabelCheck.Checked
+	cfg.Proxy = proxy
+	cfg.Network.DailyMB = dailyMB
+	cfg.Network.MonthlyMB = monthlyMB
+	return cfg, nil
+}
+
+type proxyMode struct {
+	label       string
+	value       string
+	placeholder string
+}
+
+var proxyModes = []proxyMode{
+	{label: "跟随系统", value: config.ProxySystem},
+	{label: "不使用代理", value: config.ProxyNone},
+	{label: "HTTP(S)", value: config.ProxyHTTP, placeholder: "如 127.0.0.1:7890 或 https://proxy:443"},
+	{label: "SOCKS5", value: config.ProxySOCKS5, placeholder: "如 127.0.0.1:1080"},
+	{label: "PAC 脚本", value: config.ProxyPAC, placeholder: "如 http://192.168.1.1/proxy.pac"},
+}
+
+func proxyModeByLabel(label string) proxyMode {
+	for _, mode := range proxyModes {
+		if mode.label == label {
+			return mode
+		}
+	}
+	return proxyModes[0]
+}
+
+func proxyModeByValue(value string) proxyMode {
+	for _, mode := range proxyModes {
+		if mode.value == value {
+			return mode
+		}
+	}
+	return proxyModes[0]
+}
+
+func (ui *settingsUI) proxyFromInputs() (config.Proxy, error) {
+	mode := proxyModeByLabel(ui.proxySelect.Selected)
+	proxy := ui.currentCfg.Proxy
+	proxy.Mode = mode.value
+	proxy.URL = ""
+	if mode.placeholder != "" {
+		proxy.URL = strings.TrimSpace(ui.proxyEntry.Text)
+		if proxy.URL == "" {
+			return config.Proxy{}, errors.New("请填写代理地址")
+		}
+	}
+	return proxy, nil
+}
+
+// runProxyTest checks the proxy as currently entered, before it is saved.
+func (ui *settingsUI) runProxyTest() {
+	proxy, err := ui.proxyFromInputs()
+	if err != nil {
+		ui.proxyStatus.SetText(err.Error())
+		return
+	}
+	ui.proxyTestBtn.Disable()
+	ui.proxyStatus.SetText("正在连接…")
+	go func() {
+		err := ui.testProxy(proxy)
+		if err != nil {
+			ui.proxyStatus.SetText("连接失败：" + err.Error())
+		} else {
+			ui.proxyStatus.SetText("连接成功")
+		}
+		ui.proxyTestBtn.Enable()
+	}()
+}
+
+func (ui *settingsUI) locationFromInputs() (config.Location, error) {
+	if city, ok := config.CityByName(ui.citySelect.Selected); ok {
+		return config.Location{City: city.Name, Latitude: city.Latitude, Longitude: city.Longitude}, nil
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(ui.latitudeEntry.Text), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return config.Location{}, errors.New("纬度需在 -90 到 90 之间")
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(ui.longitudeEntry.Text), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return config.Location{}, errors.New("经度需在 -180 到 180 之间")
+	}
+	return config.Location{Latitude: lat, Longitude: lon}, nil
+}
+
+func (ui *settingsUI) refreshSunTimes() {
+	location, err := ui.locationFromInputs()
+	if err != nil {
+		ui.sunLabel.SetText("")
+		return
+	}
+	times := solar.TimesFor(time.Now(), location.Latitude, location.Longitude)
+	switch {
+	case times.AlwaysUp:
+		ui.sunLabel.SetText("今日极昼")
+	case times.AlwaysDown:
+		ui.sunLabel.SetText("今日极夜")
+	default:
+		ui.sunLabel.SetText("今日日出 " + times.Sunrise.Format("15:04") + " · 日落 " + times.Sunset.Format("15:04"))
+	}
 }
 
 func (ui *settingsUI) applyAutoStart(current, next config.Config) error {
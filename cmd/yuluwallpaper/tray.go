@@ -0,0 +1,11 @@
+//go:build windows || darwin || linux
+
+package main
+
+import "fyne.io/systray"
+
+// setTrayTooltip sets the text shown when hovering over the tray icon.
+// Fyne has no API for it, but its tray is fyne.io/systray.
+func setTrayTooltip(text string) {
+	systray.SetTooltip(text)
+}
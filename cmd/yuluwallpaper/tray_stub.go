@@ -0,0 +1,5 @@
+//go:build !windows && !darwin && !linux
+
+package main
+
+func setTrayTooltip(string) {}
@@ -0,0 +1,49 @@
+package app
+
+import "time"
+
+const (
+	// breakerThreshold is how many failures in a row open a breaker.
+	breakerThreshold = 3
+
+	breakerMinCooldown = 5 * time.Minute
+	breakerMaxCooldown = time.Hour
+)
+
+// breaker stops trying a source that keeps failing. Once open it lets one
+// attempt through after the cooldown; another failure reopens it with a
+// doubled cooldown, a success closes it.
+type breaker struct {
+	failures  int
+	cooldown  time.Duration
+	openUntil time.Time
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	return !now.Before(b.openUntil)
+}
+
+func (b *breaker) success() {
+	*b = breaker{}
+}
+
+// failure records a failed attempt and reports whether the breaker opened.
+// A server's Retry-After opens it at once, for at least that long.
+func (b *breaker) failure(now time.Time, retryAfter time.Duration) bool {
+	b.failures++
+	if b.failures < breakerThreshold {
+		if retryAfter <= 0 {
+			return false
+		}
+		b.openUntil = now.Add(retryAfter)
+		return true
+	}
+	switch {
+	case b.cooldown == 0:
+		b.cooldown = breakerMinCooldown
+	case b.cooldown < breakerMaxCooldown:
+		b.cooldown = min(2*b.cooldown, breakerMaxCooldown)
+	}
+	b.openUntil = now.Add(max(b.cooldown, retryAfter))
+	return true
+}
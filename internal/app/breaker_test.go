@@ -0,0 +1,51 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/httpclient"
+)
+
+func TestBreakerHonorsRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var b breaker
+	if !b.failure(now, time.Hour) {
+		t.Fatal("a Retry-After did not open the breaker")
+	}
+	if b.allow(now.Add(59*time.Minute)) || !b.allow(now.Add(time.Hour)) {
+		t.Errorf("breaker open until %s, want %s", b.openUntil, now.Add(time.Hour))
+	}
+
+	b = breaker{}
+	b.failure(now, 0)
+	b.failure(now, 0)
+	b.failure(now, 2*time.Hour)
+	if got := b.openUntil.Sub(now); got != 2*time.Hour {
+		t.Errorf("cooldown after threshold = %s, want the longer Retry-After 2h0m0s", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	throttled := func(d time.Duration) error {
+		return fmt.Errorf("src: %w", &httpclient.RetryAfterError{Status: "429 Too Many Requests", After: d})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"single", throttled(time.Hour), time.Hour},
+		{"shortest of all", errors.Join(throttled(time.Hour), throttled(10*time.Minute)), 10 * time.Minute},
+		{"one without", errors.Join(throttled(time.Hour), errors.New("timeout")), 0},
+		{"breaker skipped", errors.Join(throttled(time.Hour), fmt.Errorf("b: %w", errBreakerOpen)), time.Hour},
+		{"plain", errors.New("timeout"), 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.err); got != tt.want {
+			t.Errorf("%s: retryAfter = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"yuluwallpaper/internal/generative"
+	"yuluwallpaper/internal/overlay"
+	"yuluwallpaper/internal/source"
+	"yuluwallpaper/internal/sysinfo"
+)
+
+// FallbackStep names where an offline wallpaper came from. The empty step
+// means sources are working normally.
+type FallbackStep string
+
+const (
+	FallbackQueue     FallbackStep = "queue"
+	FallbackFavorites FallbackStep = "favorites"
+	FallbackHistory   FallbackStep = "history"
+	FallbackEmbedded  FallbackStep = "embedded"
+	FallbackQuote     FallbackStep = "quote"
+)
+
+//go:embed fallback/*.jpg
+var embeddedWallpapers embed.FS
+
+// fallbackFiles holds the wallpapers built into the binary; tests replace
+// it to do without them.
+var fallbackFiles fs.FS = embeddedWallpapers
+
+// fallback walks the offline chain after every source failed: prefetched
+// images for any source preference, favorites, recent wallpapers, the
+// wallpapers built into the binary and finally a generated quote card.
+func (s *Service) fallback(now time.Time) (*source.Image, fingerprint, FallbackStep, error) {
+	steps := []struct {
+		step FallbackStep
+		load func() (*source.Image, error)
+	}{
+		{FallbackQueue, s.fallbackQueue},
+		{FallbackFavorites, func() (*source.Image, error) { return themedImage(s.favoritesDir()) }},
+		{FallbackHistory, s.fallbackHistory},
+		{FallbackEmbedded, fallbackEmbedded},
+		{FallbackQuote, func() (*source.Image, error) { return s.quoteCard(now) }},
+	}
+	var errs []error
+	for _, step := range steps {
+		img, err := step.load()
+		if err != nil {
+			log.Printf("fallback %s: %v", step.step, err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.step, err))
+			continue
+		}
+		log.Printf("fallback: using an image from %s", step.step)
+		return img, fingerprintOf(img.Data), step.step, nil
+	}
+	return nil, fingerprint{}, "", errors.Join(errs...)
+}
+
+func (s *Service) fallbackQueue() (*source.Image, error) {
+	img, _, ok := s.popQueued(nil)
+	if !ok {
+		return nil, errors.New("queue is empty")
+	}
+	return img, nil
+}
+
+// fallbackHistory picks a kept copy of a recent wallpaper other than the
+// current one.
+func (s *Service) fallbackHistory() (*source.Image, error) {
+	entries := s.history()
+	var kept []historyEntry
+	for i, entry := range entries {
+		if entry.Path != "" && (i != len(entries)-1 || len(entries) == 1) {
+			kept = append(kept, entry)
+		}
+	}
+	rand.Shuffle(len(kept), func(i, j int) { kept[i], kept[j] = kept[j], kept[i] })
+	for _, entry := range kept {
+		data, err := os.ReadFile(entry.Path)
+		if err != nil {
+			continue
+		}
+		img, err := source.ReadImage(bytes.NewReader(data), "")
+		if err != nil {
+			return nil, err
+		}
+		img.Meta = entry.Meta
+		return img, nil
+	}
+	return nil, errors.New("no wallpapers kept")
+}
+
+func fallbackEmbedded() (*source.Image, error) {
+	names, err := fs.Glob(fallbackFiles, "fallback/*.jpg")
+	if err != nil || len(names) == 0 {
+		return nil, errors.New("no embedded wallpapers")
+	}
+	data, err := fs.ReadFile(fallbackFiles, names[rand.Intn(len(names))])
+	if err != nil {
+		return nil, err
+	}
+	return source.ReadImage(bytes.NewReader(data), "image/jpeg")
+}
+
+// quoteCard renders a quote onto a generated background at screen size.
+// Without the overlay font the background alone is used.
+func (s *Service) quoteCard(now time.Time) (*source.Image, error) {
+	width, height, err := sysinfo.ScreenSize()
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 1920, 1080
+	}
+	background, err := generative.Render("gradient", now.Format("2006-01-02"), width, height)
+	if err != nil {
+		return nil, err
+	}
+	q := overlay.Sayings[rand.Intn(len(overlay.Sayings))]
+	card, meta := background, source.Metadata{Title: q.Text, Author: q.Author}
+	if withQuote, err := overlay.Quote(background, s.fontData, q.Text, q.Author); err == nil {
+		card, meta.Drawn = withQuote, true
+	} else {
+		log.Printf("fallback quote: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, card, &jpeg.Options{Quality: 92}); err != nil {
+		return nil, err
+	}
+	return &source.Image{Data: buf.Bytes(), ContentType: "image/jpeg", Meta: meta}, nil
+}
+
+func (s *Service) favoritesDir() string {
+	return filepath.Join(s.assetsDir, "favorites")
+}
+
+// AddFavorite copies the current wallpaper, as downloaded, into the
+// favorites folder, which the offline fallback draws from.
+func (s *Service) AddFavorite() error {
+	entries := s.history()
+	if len(entries) == 0 || entries[len(entries)-1].Path == "" {
+		return errors.New("no current wallpaper")
+	}
+	path := entries[len(entries)-1].Path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.favoritesDir(), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.favoritesDir(), filepath.Base(path)), data, 0o644)
+}
+
+// Degraded reports the fallback step the current wallpaper came from, or
+// "" when sources are working.
+func (s *Service) Degraded() FallbackStep {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.degraded
+}
+
+// SetDegradedHandler registers fn to be called, from the service's
+// goroutine, whenever Degraded changes. It must be called before Run.
+func (s *Service) SetDegradedHandler(fn func(FallbackStep)) {
+	s.onDegraded = fn
+}
+
+func (s *Service) setDegraded(step FallbackStep) {
+	s.mu.Lock()
+	changed := s.degraded != step
+	s.degraded = step
+	s.mu.Unlock()
+	if changed && s.onDegraded != nil {
+		s.onDegraded(step)
+	}
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"yuluwallpaper/internal/source"
+)
+
+// captureLog collects what the service logs during the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestFallbackChain(t *testing.T) {
+	down := &stubSource{name: "down", err: errors.New("connection refused")}
+	s := stubService(t, 1, down)
+	now := time.Now()
+	t.Cleanup(func() { fallbackFiles = embeddedWallpapers })
+
+	// Fill every step: a queued image, a favorite and two wallpapers in
+	// the history, the older of which is what the history step offers.
+	path, err := s.saveQueued(&source.Image{Data: noiseImage("queued", 1), ContentType: "image/png"}, fingerprintOf(noiseImage("queued", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.saveQueue([]queuedImage{{Path: path, ContentType: "image/png", Preferred: "elsewhere", SHA256: fingerprintOf(noiseImage("queued", 1)).sum, Fetched: now}})
+	if err := os.MkdirAll(s.favoritesDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.favoritesDir(), "fav.png"), noiseImage("favorite", 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		data := noiseImage("history", i)
+		s.recordShown(fingerprintOf(data).entry(now), &source.Image{Data: data, ContentType: "image/png"})
+	}
+
+	var reported []FallbackStep
+	s.SetDegradedHandler(func(step FallbackStep) { reported = append(reported, step) })
+	logs := captureLog(t)
+
+	for _, tc := range []struct {
+		step   FallbackStep
+		want   []byte
+		remove func()
+	}{
+		// Queued images are used whatever source they were fetched for.
+		{FallbackQueue, noiseImage("queued", 1), func() {}},
+		{FallbackFavorites, noiseImage("favorite", 1), func() { os.RemoveAll(s.favoritesDir()) }},
+		{FallbackHistory, noiseImage("history", 1), func() {
+			for _, e := range s.history() {
+				os.Remove(e.Path)
+			}
+		}},
+		{FallbackEmbedded, nil, func() { fallbackFiles = fstest.MapFS{} }},
+		{FallbackQuote, nil, nil},
+	} {
+		logs.Reset()
+		img, _, ok := s.obtain(now, "", "", true)
+		if !ok {
+			t.Fatalf("%s: nothing obtained; log:\n%s", tc.step, logs)
+		}
+		if s.Degraded() != tc.step || reported[len(reported)-1] != tc.step {
+			t.Errorf("degraded %q, reported %v, want %q", s.Degraded(), reported, tc.step)
+		}
+		if tc.want != nil && !bytes.Equal(img.Data, tc.want) {
+			t.Errorf("%s: not the expected image", tc.step)
+		}
+		if !strings.Contains(logs.String(), "fallback: using an image from "+string(tc.step)) {
+			t.Errorf("%s: log does not say so:\n%s", tc.step, logs)
+		}
+		if tc.remove != nil {
+			tc.remove()
+		}
+	}
+
+	// By now every step before the quote card has failed, and each says
+	// why in turn.
+	var order []int
+	for _, msg := range []string{"fallback queue: queue is empty", "fallback favorites:", "fallback history: no wallpapers kept", "fallback embedded: no embedded wallpapers"} {
+		i := strings.Index(logs.String(), msg)
+		if i < 0 {
+			t.Errorf("log lacks %q:\n%s", msg, logs)
+		}
+		order = append(order, i)
+	}
+	for i := 1; i < len(order); i++ {
+		if order[i] < order[i-1] {
+			t.Errorf("steps logged out of order:\n%s", logs)
+		}
+	}
+
+	// Once the source works again, and its breaker lets it be tried, the
+	// service is no longer degraded.
+	down.err = nil
+	s.breakers = make(map[string]*breaker)
+	if _, _, ok := s.obtain(now, "", "", true); !ok || s.Degraded() != "" || reported[len(reported)-1] != "" {
+		t.Errorf("after recovering: degraded %q, reported %v", s.Degraded(), reported)
+	}
+}
+
+func TestFreshInstallOffline(t *testing.T) {
+	s := stubService(t, 3, &stubSource{name: "yulu"})
+	s.net.Offline = true
+	logs := captureLog(t)
+
+	img, _, ok := s.obtain(time.Now(), "", "", true)
+	if !ok || s.Degraded() != FallbackEmbedded {
+		t.Fatalf("obtained %v from %q; log:\n%s", ok, s.Degraded(), logs)
+	}
+	names, _ := fs.Glob(embeddedWallpapers, "fallback/*.jpg")
+	found := false
+	for _, name := range names {
+		data, _ := embeddedWallpapers.ReadFile(name)
+		found = found || bytes.Equal(data, img.Data)
+	}
+	if !found {
+		t.Errorf("got a %s image that is not one of %v", img.ContentType, names)
+	}
+	if !strings.Contains(logs.String(), "no network connectivity, using images already on disk") {
+		t.Errorf("log does not explain the offline refresh:\n%s", logs)
+	}
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/imagehash"
+	"yuluwallpaper/internal/source"
+)
+
+const (
+	// historyKey is the state store key of the wallpapers shown so far.
+	historyKey = "history"
+	// historyLimit caps how many entries the state store keeps, however
+	// many days dedup looks back.
+	historyLimit = 5000
+	// historyFiles is how many recent wallpapers keep a copy on disk for
+	// the offline fallback.
+	historyFiles = 30
+)
+
+// errUnchanged means every image fetched was a recent wallpaper again.
+var errUnchanged = errors.New("no new image")
+
+type historyEntry struct {
+	SHA256 string `json:"sha256"`
+	// PHash is the hex difference hash, empty when the image could not
+	// be decoded.
+	PHash string    `json:"phash,omitempty"`
+	Shown time.Time `json:"shown"`
+	// Path is the copy kept in assets/history, empty once it is removed.
+	Path string `json:"path,omitempty"`
+	// Meta is what the source said about the image.
+	Meta source.Metadata `json:"meta"`
+}
+
+// fingerprint identifies an image exactly and perceptually.
+type fingerprint struct {
+	sum    string
+	phash  uint64
+	hashed bool
+}
+
+func fingerprintOf(data []byte) fingerprint {
+	sum := sha256.Sum256(data)
+	fp := fingerprint{sum: hex.EncodeToString(sum[:])}
+	if phash, err := imagehash.Decode(data); err == nil {
+		fp.phash, fp.hashed = phash, true
+	}
+	return fp
+}
+
+func (e historyEntry) fingerprint() fingerprint {
+	fp := fingerprint{sum: e.SHA256}
+	if phash, err := strconv.ParseUint(e.PHash, 16, 64); err == nil {
+		fp.phash, fp.hashed = phash, true
+	}
+	return fp
+}
+
+func (fp fingerprint) entry(shown time.Time) historyEntry {
+	entry := historyEntry{SHA256: fp.sum, Shown: shown}
+	if fp.hashed {
+		entry.PHash = strconv.FormatUint(fp.phash, 16)
+	}
+	return entry
+}
+
+func (s *Service) history() []historyEntry {
+	var entries []historyEntry
+	s.store.Get(historyKey, &entries)
+	return entries
+}
+
+// recordShown appends entry, keeping a copy of img, and drops what dedup
+// and the offline fallback no longer look at.
+func (s *Service) recordShown(entry historyEntry, img *source.Image) {
+	if path, err := s.keepCopy(entry.SHA256, img); err != nil {
+		log.Printf("save history copy failed: %v", err)
+	} else {
+		entry.Path = path
+	}
+	entries := append(s.history(), entry)
+	cutoff := entry.Shown.AddDate(0, 0, -s.cfg.Dedup.Days)
+	drop := 0
+	for drop < len(entries)-s.cfg.Dedup.Recent && entries[drop].Shown.Before(cutoff) {
+		drop++
+	}
+	drop = max(drop, len(entries)-historyLimit)
+	for _, old := range entries[:drop] {
+		removeUnused(old.Path, entries[drop:])
+	}
+	entries = entries[drop:]
+
+	kept := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Path == "" {
+			continue
+		}
+		if kept++; kept > historyFiles {
+			path := entries[i].Path
+			entries[i].Path = ""
+			removeUnused(path, entries)
+		}
+	}
+	if err := s.store.Put(historyKey, entries); err != nil {
+		log.Printf("save history failed: %v", err)
+	}
+}
+
+func (s *Service) keepCopy(sum string, img *source.Image) (string, error) {
+	dir := filepath.Join(s.assetsDir, "history")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	ext := img.Ext()
+	if ext == "" {
+		ext = ".img"
+	}
+	path := filepath.Join(dir, sum[:16]+ext)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	return path, os.WriteFile(path, img.Data, 0o644)
+}
+
+// removeUnused deletes path unless an entry still refers to it; the same
+// image can be shown more than once.
+func removeUnused(path string, entries []historyEntry) {
+	if path == "" {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Path == path {
+			return
+		}
+	}
+	_ = os.Remove(path)
+}
+
+// duplicate explains why fp counts as a recent wallpaper, or returns "".
+func duplicate(entries []historyEntry, fp fingerprint, dedup config.Dedup, now time.Time) string {
+	for i := len(entries) - 1; i >= 0 && i >= len(entries)-dedup.Recent; i-- {
+		if entries[i].SHA256 == fp.sum {
+			return "the same as a recent wallpaper"
+		}
+	}
+	if !fp.hashed || dedup.Distance <= 0 {
+		return ""
+	}
+	cutoff := now.AddDate(0, 0, -dedup.Days)
+	for i := len(entries) - 1; i >= 0 && !entries[i].Shown.Before(cutoff); i-- {
+		phash, err := strconv.ParseUint(entries[i].PHash, 16, 64)
+		if err != nil {
+			continue
+		}
+		if d := imagehash.Distance(fp.phash, phash); d <= dedup.Distance {
+			return "like the wallpaper of " + entries[i].Shown.Format("2006-01-02 15:04") + " (distance " + strconv.Itoa(d) + ")"
+		}
+	}
+	return ""
+}
+
+// fetchNew calls fetch until it gets an image that is not one of seen,
+// with up to dedup.Retries extra attempts.
+func fetchNew(ctx context.Context, fetch func() (*source.Image, error), seen []historyEntry, dedup config.Dedup) (*source.Image, fingerprint, error) {
+	for attempt := 0; ; attempt++ {
+		img, err := fetch()
+		switch {
+		case errors.Is(err, source.ErrNotModified):
+			log.Printf("image unchanged since the last download")
+		case err != nil:
+			return nil, fingerprint{}, err
+		default:
+			fp := fingerprintOf(img.Data)
+			reason := duplicate(seen, fp, dedup, time.Now())
+			if reason == "" {
+				return img, fp, nil
+			}
+			log.Printf("image %.12s is %s", fp.sum, reason)
+		}
+		if attempt >= dedup.Retries || ctx.Err() != nil {
+			return nil, fingerprint{}, errUnchanged
+		}
+	}
+}
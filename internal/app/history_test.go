@@ -0,0 +1,205 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/source"
+	"yuluwallpaper/internal/state"
+)
+
+func TestHistoryKeepsMetadata(t *testing.T) {
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(config.Default(), t.TempDir(), store)
+	meta := source.Metadata{Title: "Lake", Author: "Jane Doe", Copyright: "© Jane Doe / Example"}
+	for i, data := range [][]byte{testImage(t, 0x20), testImage(t, 0xe0)} {
+		img := &source.Image{Data: data, ContentType: "image/png", Meta: meta}
+		if i == 1 {
+			img.Meta = source.Metadata{Title: "current"}
+		}
+		entry := fingerprintOf(data).entry(time.Now())
+		entry.Meta = img.Meta
+		s.recordShown(entry, img)
+	}
+
+	// The current wallpaper is never the fallback, so the first one,
+	// read back from disk, must come with its metadata.
+	img, err := s.fallbackHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Meta != meta {
+		t.Errorf("meta %+v, want %+v", img.Meta, meta)
+	}
+}
+
+func testImage(t *testing.T, gray uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCreditLine(t *testing.T) {
+	for _, tc := range []struct {
+		meta source.Metadata
+		want string
+	}{
+		{source.Metadata{}, ""},
+		{source.Metadata{Title: "Lake", Author: "Jane"}, "Lake · Jane"},
+		{source.Metadata{Title: "Lake", Author: "Jane", Copyright: "© Jane / Example"}, "Lake · © Jane / Example"},
+		{source.Metadata{Author: " Jane ", Copyright: "CC BY 4.0"}, "Jane · CC BY 4.0"},
+	} {
+		if got := creditLine(tc.meta); got != tc.want {
+			t.Errorf("creditLine(%+v) = %q, want %q", tc.meta, got, tc.want)
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	entry := func(sum string, phash uint64, daysAgo int) historyEntry {
+		return fingerprint{sum: sum, phash: phash, hashed: true}.entry(now.AddDate(0, 0, -daysAgo))
+	}
+	history := []historyEntry{
+		entry("old", 0xff00ff00ff00ff00, 40),
+		entry("a", 0x0f0f0f0f0f0f0f0f, 3),
+		entry("b", 0x00000000ffffffff, 1),
+	}
+	dedup := config.Dedup{Recent: 10, Distance: 6, Days: 30}
+	for _, tc := range []struct {
+		name  string
+		fp    fingerprint
+		dedup config.Dedup
+		dup   bool
+	}{
+		{"same file", fingerprint{sum: "a"}, dedup, true},
+		{"same file beyond recent", fingerprint{sum: "a"}, config.Dedup{Recent: 1, Distance: 6, Days: 30}, false},
+		{"identical hash", fingerprint{sum: "x", phash: 0x00000000ffffffff, hashed: true}, dedup, true},
+		{"distance at the threshold", fingerprint{sum: "x", phash: 0x0f0f0f0f0f0f0f0f ^ 0x3f, hashed: true}, dedup, true},
+		{"distance past the threshold", fingerprint{sum: "x", phash: 0x0f0f0f0f0f0f0f0f ^ 0x7f, hashed: true}, dedup, false},
+		{"like one shown before days", fingerprint{sum: "x", phash: 0xff00ff00ff00ff00, hashed: true}, dedup, false},
+		{"like one shown within days", fingerprint{sum: "x", phash: 0xff00ff00ff00ff00, hashed: true}, config.Dedup{Recent: 10, Distance: 6, Days: 60}, true},
+		{"zero threshold", fingerprint{sum: "x", phash: 0x00000000ffffffff, hashed: true}, config.Dedup{Recent: 10, Days: 30}, false},
+		{"disabled", fingerprint{sum: "x", phash: 0x00000000ffffffff, hashed: true}, config.Dedup{Recent: 10, Distance: -1, Days: 30}, false},
+		{"not decodable", fingerprint{sum: "x"}, dedup, false},
+	} {
+		reason := duplicate(history, tc.fp, tc.dedup, now)
+		if (reason != "") != tc.dup {
+			t.Errorf("%s: duplicate = %q, want duplicate %v", tc.name, reason, tc.dup)
+		}
+	}
+}
+
+// fakeFetch returns the images in turn, then keeps returning the last one.
+// A nil image stands for an ErrNotModified reply.
+func fakeFetch(images ...[]byte) (func() (*source.Image, error), *int) {
+	calls := new(int)
+	return func() (*source.Image, error) {
+		data := images[min(*calls, len(images)-1)]
+		*calls++
+		if data == nil {
+			return nil, source.ErrNotModified
+		}
+		return &source.Image{Data: data, ContentType: "image/png"}, nil
+	}, calls
+}
+
+func TestFetchNew(t *testing.T) {
+	current, other := noiseImage("fetch", 1), noiseImage("fetch", 2)
+	seen := []historyEntry{fingerprintOf(current).entry(time.Now())}
+	failure := errors.New("offline")
+
+	for _, tc := range []struct {
+		name    string
+		images  [][]byte
+		retries int
+		want    []byte
+		err     error
+		calls   int
+	}{
+		{"new image", [][]byte{other}, 0, other, nil, 1},
+		{"repeat is not applied", [][]byte{current, other}, 0, nil, errUnchanged, 1},
+		{"retry finds a new image", [][]byte{current, other}, 2, other, nil, 2},
+		{"retries run out", [][]byte{current}, 2, nil, errUnchanged, 3},
+		{"not modified", [][]byte{nil}, 0, nil, errUnchanged, 1},
+		{"not modified then new", [][]byte{nil, other}, 1, other, nil, 2},
+	} {
+		fetch, calls := fakeFetch(tc.images...)
+		dedup := config.Dedup{Recent: 10, Retries: tc.retries, Distance: 6, Days: 30}
+		img, fp, err := fetchNew(context.Background(), fetch, seen, dedup)
+		if !errors.Is(err, tc.err) || *calls != tc.calls {
+			t.Errorf("%s: err %v after %d calls, want %v after %d", tc.name, err, *calls, tc.err, tc.calls)
+			continue
+		}
+		if tc.want != nil && (img == nil || !bytes.Equal(img.Data, tc.want) || fp.sum != fingerprintOf(tc.want).sum) {
+			t.Errorf("%s: got a different image", tc.name)
+		}
+	}
+
+	// Errors other than repeats are returned at once, without retrying.
+	calls := 0
+	_, _, err := fetchNew(context.Background(), func() (*source.Image, error) {
+		calls++
+		return nil, failure
+	}, seen, config.Dedup{Recent: 10, Retries: 3})
+	if !errors.Is(err, failure) || calls != 1 {
+		t.Errorf("failure: err %v after %d calls", err, calls)
+	}
+
+	// A cancelled refresh stops retrying.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fetch, n := fakeFetch(current)
+	if _, _, err := fetchNew(ctx, fetch, seen, config.Dedup{Recent: 10, Retries: 3}); !errors.Is(err, errUnchanged) || *n != 1 {
+		t.Errorf("cancelled: err %v after %d calls", err, *n)
+	}
+}
+
+// TestRefreshKeepsCurrentWallpaper runs a refresh that gets the current
+// wallpaper again: nothing is applied or recorded, and no retry is
+// scheduled.
+func TestRefreshKeepsCurrentWallpaper(t *testing.T) {
+	stub := &stubSource{name: "stub"}
+	s := stubService(t, -1, stub)
+	img, err := stub.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.recordShown(fingerprintOf(img.Data).entry(time.Now()), img)
+	stub.mu.Lock()
+	stub.fetches = 0
+	stub.mu.Unlock()
+
+	if _, _, ok := s.obtain(time.Now(), "", "", true); ok {
+		t.Error("the current wallpaper was obtained again")
+	}
+	if len(s.history()) != 1 || !s.retryAt.IsZero() || s.failures != 0 {
+		t.Errorf("history %d entries, retry at %v, %d failures", len(s.history()), s.retryAt, s.failures)
+	}
+
+	// With a retry allowed, the next fetch gives a new image.
+	s.cfg.Dedup.Retries = 1
+	stub.mu.Lock()
+	stub.fetches = 0
+	stub.mu.Unlock()
+	got, _, ok := s.obtain(time.Now(), "", "", true)
+	if !ok || bytes.Equal(got.Data, img.Data) || stub.count() != 2 {
+		t.Errorf("obtained %v after %d fetches, want a new image after 2", ok, stub.count())
+	}
+}
@@ -0,0 +1,66 @@
+package app
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"yuluwallpaper/internal/source"
+)
+
+func saveImage(img *source.Image, destDir string) (string, error) {
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return "", err
+	}
+
+	ext := img.Ext()
+	if ext == "" {
+		ext = ".img"
+	}
+
+	tmp, err := os.CreateTemp(destDir, "wallpaper-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(img.Data); err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	finalPath := filepath.Join(destDir, "wallpaper"+ext)
+	_ = os.Remove(finalPath)
+	if err := os.Rename(tmp.Name(), finalPath); err != nil {
+		return "", err
+	}
+	return finalPath, nil
+}
+
+func themedImage(dir string) (*source.Image, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, entry := range entries {
+		if !entry.IsDir() && source.IsImageFile(entry.Name()) {
+			images = append(images, entry.Name())
+		}
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images in %s", dir)
+	}
+	file, err := os.Open(filepath.Join(dir, images[rand.Intn(len(images))]))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return source.ReadImage(file, "")
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/netstate"
+	"yuluwallpaper/internal/source"
+)
+
+// watchNetwork feeds network status changes to the run loop. Where no
+// monitor is available the status stays unknown, which counts as online.
+func (s *Service) watchNetwork() {
+	err := netstate.Watch(s.ctx, func(status netstate.Status) {
+		select {
+		case s.netCh <- status:
+		default:
+			select {
+			case <-s.netCh:
+			default:
+			}
+			s.netCh <- status
+		}
+	})
+	if err != nil {
+		log.Printf("network monitor unavailable: %v", err)
+	}
+}
+
+// networkChanged runs a postponed or failed refresh as soon as the network
+// may be used again, instead of waiting for the next tick.
+func (s *Service) networkChanged(status netstate.Status) {
+	wasBlocked := s.localReason() != ""
+	s.net = status
+	log.Printf("network: offline=%t metered=%t", status.Offline, status.Metered)
+	if wasBlocked && s.localReason() == "" && (s.pending || !s.retryAt.IsZero()) && !s.rule.Paused() {
+		log.Printf("network: usable again, running the pending refresh")
+		s.change(false)
+	}
+}
+
+// localReason explains why nothing may be downloaded right now, or
+// returns "".
+func (s *Service) localReason() string {
+	switch {
+	case s.net.Offline:
+		return "no network connectivity"
+	case s.net.Metered && s.cfg.Network.Metered != config.MeteredIgnore:
+		return "metered connection"
+	case s.overBudget(time.Now()):
+		return "bandwidth budget used up"
+	}
+	return ""
+}
+
+// local picks an image without the network: a prefetched one for the
+// current source preference, then one from a local source, else the
+// offline fallback chain.
+func (s *Service) local(now time.Time, preferred string) (*source.Image, fingerprint, FallbackStep, error) {
+	match := func(item queuedImage) bool { return item.Preferred == preferred }
+	if img, fp, ok := s.popQueued(match); ok {
+		return img, fp, "", nil
+	}
+	if candidates := s.offlineSources(); len(candidates) > 0 {
+		ctx, cancel := context.WithTimeout(s.ctx, fetchTimeout)
+		img, err := s.fetchFirst(ctx, candidates)
+		cancel()
+		if err == nil {
+			return img, fingerprintOf(img.Data), "", nil
+		}
+	}
+	img, fp, step, err := s.fallback(now)
+	if err != nil {
+		return nil, fingerprint{}, "", errors.New("every offline step failed")
+	}
+	return img, fp, step, nil
+}
@@ -0,0 +1,249 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/source"
+)
+
+const (
+	// queueKey is the state store key of the prefetched images.
+	queueKey = "queue"
+	// queueMaxAge drops prefetched images nobody asked for, such as those
+	// for a source no longer in use.
+	queueMaxAge = 7 * 24 * time.Hour
+)
+
+// queuedImage is an image downloaded, validated and checked against the
+// history ahead of time. Preferred is the source preference it was fetched
+// for, so night images are not shown by day.
+type queuedImage struct {
+	Path        string          `json:"path"`
+	ContentType string          `json:"content_type"`
+	Meta        source.Metadata `json:"meta"`
+	Preferred   string          `json:"preferred,omitempty"`
+	SHA256      string          `json:"sha256"`
+	PHash       string          `json:"phash,omitempty"`
+	Fetched     time.Time       `json:"fetched"`
+}
+
+// entry describes the image as if shown when it was fetched, so queued
+// images are compared like recent wallpapers.
+func (q queuedImage) entry() historyEntry {
+	return historyEntry{SHA256: q.SHA256, PHash: q.PHash, Shown: q.Fetched}
+}
+
+func (s *Service) queue() []queuedImage {
+	var queue []queuedImage
+	s.store.Get(queueKey, &queue)
+	return queue
+}
+
+func (s *Service) saveQueue(queue []queuedImage) {
+	if err := s.store.Put(queueKey, queue); err != nil {
+		log.Printf("save prefetch queue failed: %v", err)
+	}
+}
+
+// nextImage pops a prefetched image when one fits, and fetches otherwise.
+// Themed days always fetch, as the queue holds regular images.
+func (s *Service) nextImage(ctx context.Context, preferred, theme string) (*source.Image, fingerprint, error) {
+	if theme == "" {
+		match := func(item queuedImage) bool { return item.Preferred == preferred }
+		if img, fp, ok := s.popQueued(match); ok {
+			return img, fp, nil
+		}
+	}
+	// A download in the background would hold the sources up.
+	s.cancelPrefetch()
+	fetch := func() (*source.Image, error) { return s.fetch(ctx, preferred, theme) }
+	return fetchNew(ctx, fetch, s.history(), s.cfg.Dedup)
+}
+func (s *Service) popQueued(match func(queuedImage) bool) (*source.Image, fingerprint, bool) {
+	queue := s.queue()
+	if len(queue) == 0 {
+		return nil, fingerprint{}, false
+	}
+	history := s.history()
+	defer func() { s.saveQueue(queue) }()
+	for i := 0; i < len(queue); i++ {
+		item := queue[i]
+		if match != nil && !match(item) {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		i--
+		data, err := os.ReadFile(item.Path)
+		_ = os.Remove(item.Path)
+		if err != nil {
+			log.Printf("prefetched image %s: %v", item.Path, err)
+			continue
+		}
+		fp := item.entry().fingerprint()
+		if reason := duplicate(history, fp, s.cfg.Dedup, time.Now()); reason != "" {
+			log.Printf("prefetched image %.12s is %s", fp.sum, reason)
+			continue
+		}
+		img, err := source.ReadImage(bytes.NewReader(data), item.ContentType)
+		if err != nil {
+			log.Printf("prefetched image %s: %v", item.Path, err)
+			continue
+		}
+		img.Meta = item.Meta
+		log.Printf("using prefetched image %.12s, %d left", fp.sum, len(queue))
+		return img, fp, true
+	}
+	return nil, fingerprint{}, false
+}
+
+// prefetchJob is one background download, set up on the run loop so the
+// goroutine doing it reads no service state.
+type prefetchJob struct {
+	preferred  string
+	candidates []source.Source
+	seen       []historyEntry
+	dedup      config.Dedup
+}
+
+type prefetchResult struct {
+	job  prefetchJob
+	img  *source.Image
+	fp   fingerprint
+	path string
+	err  error
+}
+
+// topUp starts downloading one more image into the queue if it is short
+// for the current source preference and no download is running. Failures
+// back off like refreshes do, and nothing is fetched while a refresh is
+// waiting to be retried.
+func (s *Service) topUp(now time.Time) {
+	if s.prefetching || s.cfg.Prefetch <= 0 || s.rule.Paused() || s.localReason() != "" || !s.retryAt.IsZero() || now.Before(s.prefetchAt) {
+		return
+	}
+	job := prefetchJob{preferred: s.settingsAt(now).Source, seen: s.history(), dedup: s.cfg.Dedup}
+	count := 0
+	for _, item := range s.pruneQueue(s.queue(), now) {
+		job.seen = append(job.seen, item.entry())
+		if item.Preferred == job.preferred {
+			count++
+		}
+	}
+	if count >= s.cfg.Prefetch {
+		return
+	}
+	job.candidates = s.candidates(job.preferred)
+
+	ctx, cancel := context.WithTimeout(s.ctx, fetchTimeout)
+	abandon := make(chan struct{})
+	s.prefetching = true
+	s.prefetchCancel = func() {
+		cancel()
+		close(abandon)
+	}
+	s.prefetchWG.Add(1)
+	go func() {
+		defer s.prefetchWG.Done()
+		defer cancel()
+		result := prefetchResult{job: job}
+		fetch := func() (*source.Image, error) { return s.fetchFirst(ctx, job.candidates) }
+		result.img, result.fp, result.err = fetchNew(ctx, fetch, job.seen, job.dedup)
+		if result.err == nil {
+			result.path, result.err = s.saveQueued(result.img, result.fp)
+		}
+		select {
+		case s.prefetchCh <- result:
+		case <-abandon:
+			result.discard()
+		case <-s.stopCh:
+			result.discard()
+		}
+	}()
+}
+
+// discard removes the file of a result nobody will queue.
+func (r prefetchResult) discard() {
+	if r.path != "" {
+		_ = os.Remove(r.path)
+	}
+}
+
+// prefetched adds a finished background download to the queue, on the run
+// loop.
+func (s *Service) prefetched(result prefetchResult, now time.Time) {
+	s.prefetching, s.prefetchCancel = false, nil
+	switch {
+	case errors.Is(result.err, context.Canceled):
+		return
+	case result.err != nil:
+		delay := max(retryDelays[min(s.prefetchFailures, len(retryDelays)-1)], retryAfter(result.err))
+		s.prefetchFailures++
+		s.prefetchAt = now.Add(delay)
+		log.Printf("prefetch failed, trying again in %s: %v", delay, result.err)
+		return
+	}
+	s.prefetchFailures, s.prefetchAt = 0, time.Time{}
+	entry := result.fp.entry(now)
+	queue := append(s.queue(), queuedImage{
+		Path:        result.path,
+		ContentType: result.img.ContentType,
+		Meta:        result.img.Meta,
+		Preferred:   result.job.preferred,
+		SHA256:      entry.SHA256,
+		PHash:       entry.PHash,
+		Fetched:     now,
+	})
+	s.saveQueue(queue)
+	log.Printf("prefetched image %.12s, %d queued", result.fp.sum, len(queue))
+}
+
+// cancelPrefetch stops a running background download and waits for it to
+// finish, dropping what it fetched, so a refresh need not queue behind it
+// and sources can be closed safely.
+func (s *Service) cancelPrefetch() {
+	if s.prefetchCancel == nil {
+		return
+	}
+	s.prefetchCancel()
+	s.prefetchWG.Wait()
+	s.prefetching, s.prefetchCancel = false, nil
+}
+
+func (s *Service) saveQueued(img *source.Image, fp fingerprint) (string, error) {
+	dir := filepath.Join(s.assetsDir, "queue")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	ext := img.Ext()
+	if ext == "" {
+		ext = ".img"
+	}
+	path := filepath.Join(dir, fp.sum[:16]+ext)
+	return path, os.WriteFile(path, img.Data, 0o644)
+}
+
+// pruneQueue drops entries that are too old or whose file is gone.
+func (s *Service) pruneQueue(queue []queuedImage, now time.Time) []queuedImage {
+	kept := queue[:0]
+	for _, item := range queue {
+		if now.Sub(item.Fetched) > queueMaxAge {
+			_ = os.Remove(item.Path)
+			continue
+		}
+		if _, err := os.Stat(item.Path); err != nil {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(kept) != len(queue) {
+		s.saveQueue(kept)
+	}
+	return kept
+}
@@ -0,0 +1,216 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/source"
+)
+
+// stubSource returns a different noise image on every fetch, after block
+// is closed if it is set.
+type stubSource struct {
+	name  string
+	block chan struct{}
+	// err, if set, is what every fetch returns.
+	err error
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func (s *stubSource) Name() string { return s.name }
+
+func (s *stubSource) Fetch(ctx context.Context) (*source.Image, error) {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	s.fetches++
+	n := s.fetches
+	s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &source.Image{Data: noiseImage(s.name, n), ContentType: "image/png", Meta: source.Metadata{Title: s.name}}, nil
+}
+
+func (s *stubSource) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// noiseImage is an image unlike any other name and n gives.
+func noiseImage(name string, n int) []byte {
+	seed := int64(n)
+	for _, c := range name {
+		seed = seed*31 + int64(c)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// stubService is a service whose sources are the stubs, in order.
+func stubService(t *testing.T, prefetch int, stubs ...*stubSource) *Service {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Prefetch = prefetch
+	cfg.SourceOrder = config.OrderRoundRobin
+	s := NewService(cfg, t.TempDir(), nil)
+	for _, stub := range stubs {
+		s.sources = append(s.sources, configuredSource{cfg: config.SourceConfig{Name: stub.name, Enabled: true, Weight: 1}, src: stub})
+	}
+	t.Cleanup(s.closeSources)
+	return s
+}
+
+// fillQueue runs background downloads the way the run loop does until
+// topUp has nothing more to do.
+func fillQueue(t *testing.T, s *Service, now time.Time) {
+	t.Helper()
+	for i := 0; ; i++ {
+		s.topUp(now)
+		if !s.prefetching {
+			return
+		}
+		if i > 10 {
+			t.Fatal("queue never filled up")
+		}
+		s.prefetched(<-s.prefetchCh, now)
+	}
+}
+
+func queueFiles(t *testing.T, s *Service) []string {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(s.assetsDir, "queue", "*"))
+	return files
+}
+
+func TestPrefetchQueue(t *testing.T) {
+	stub := &stubSource{name: "stub"}
+	s := stubService(t, 3, stub)
+	now := time.Now()
+
+	fillQueue(t, s, now)
+	if n := len(s.queue()); n != 3 || stub.count() != 3 || len(queueFiles(t, s)) != 3 {
+		t.Fatalf("%d queued, %d fetched, files %v; want 3", n, stub.count(), queueFiles(t, s))
+	}
+
+	// A refresh takes a queued image instead of fetching.
+	img, fp, err := s.nextImage(context.Background(), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.count() != 3 || len(s.queue()) != 2 || len(queueFiles(t, s)) != 2 {
+		t.Errorf("after popping: %d fetched, %d queued", stub.count(), len(s.queue()))
+	}
+	if fp.sum != fingerprintOf(img.Data).sum || img.Meta.Title != "stub" {
+		t.Errorf("popped image %.12s with meta %+v", fp.sum, img.Meta)
+	}
+
+	// Topping up fetches just the one that was used.
+	fillQueue(t, s, now)
+	if stub.count() != 4 || len(s.queue()) != 3 {
+		t.Errorf("after topping up: %d fetched, %d queued", stub.count(), len(s.queue()))
+	}
+
+	// Images nobody used within queueMaxAge are dropped with their files.
+	if kept := s.pruneQueue(s.queue(), now.Add(queueMaxAge+time.Minute)); len(kept) != 0 {
+		t.Errorf("%d images kept past queueMaxAge", len(kept))
+	}
+	if len(s.queue()) != 0 || len(queueFiles(t, s)) != 0 {
+		t.Errorf("expired images left: queue %d, files %v", len(s.queue()), queueFiles(t, s))
+	}
+}
+
+func TestPrefetchPreferredSource(t *testing.T) {
+	day, night := &stubSource{name: "day"}, &stubSource{name: "night"}
+	s := stubService(t, 2, day, night)
+	now := time.Now()
+
+	s.rule.Source = "night"
+	fillQueue(t, s, now)
+	if night.count() != 2 || day.count() != 0 {
+		t.Fatalf("fetched %d night and %d day images, want 2 night", night.count(), day.count())
+	}
+
+	// Images for the night are not shown by day, and day images are
+	// topped up on their own.
+	img, _, err := s.nextImage(context.Background(), "day", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Meta.Title != "day" || day.count() != 1 || len(s.queue()) != 2 {
+		t.Errorf("got a %s image, %d day fetches, %d queued", img.Meta.Title, day.count(), len(s.queue()))
+	}
+	s.rule.Source = "day"
+	fillQueue(t, s, now)
+	if day.count() != 3 || len(s.queue()) != 4 {
+		t.Errorf("%d day fetches and %d queued, want 3 and 4", day.count(), len(s.queue()))
+	}
+
+	img, _, err = s.nextImage(context.Background(), "night", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Meta.Title != "night" || night.count() != 2 {
+		t.Errorf("got a %s image after %d night fetches, want a queued night image", img.Meta.Title, night.count())
+	}
+}
+
+func TestPrefetchCancelWaits(t *testing.T) {
+	stub := &stubSource{name: "stub", block: make(chan struct{})}
+	s := stubService(t, 1, stub)
+
+	s.topUp(time.Now())
+	if !s.prefetching {
+		t.Fatal("no download started")
+	}
+	// Let the download finish and write its file, then cancel before the
+	// run loop takes the result: the file must not be left behind.
+	close(stub.block)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(queueFiles(t, s)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("download never saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.closeSources()
+	if s.prefetching || len(queueFiles(t, s)) != 0 || len(s.queue()) != 0 {
+		t.Errorf("after closing: prefetching %v, files %v, queue %d", s.prefetching, queueFiles(t, s), len(s.queue()))
+	}
+	if s.sources != nil {
+		t.Error("sources not closed")
+	}
+}
+
+func TestPrefetchStopDiscards(t *testing.T) {
+	stub := &stubSource{name: "stub"}
+	s := stubService(t, 1, stub)
+	s.topUp(time.Now())
+	s.Stop()
+	s.prefetchWG.Wait()
+	if files := queueFiles(t, s); len(files) != 0 {
+		t.Errorf("files left after Stop: %v", files)
+	}
+}
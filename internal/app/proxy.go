@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/httpclient"
+	"yuluwallpaper/internal/secrets"
+	"yuluwallpaper/internal/source"
+)
+
+// testTimeout bounds the settings window's connection test.
+const testTimeout = 20 * time.Second
+
+// ProxyOptions resolves the proxy login named in cfg from creds.
+func ProxyOptions(cfg config.Proxy, creds secrets.Store) httpclient.ProxyOptions {
+	opts := httpclient.ProxyOptions{Mode: cfg.Mode, URL: cfg.URL}
+	if cfg.Credentials != "" {
+		cred, ok := creds.Lookup(cfg.Credentials)
+		if !ok {
+			log.Printf("proxy: credentials %q not found", cfg.Credentials)
+		}
+		opts.Username, opts.Password = cred.Username, cred.Password
+	}
+	return opts
+}
+
+// newClient builds the shared client, falling back to the system proxy
+// when the configured one is unusable.
+func newClient(opts httpclient.ProxyOptions) (*http.Client, httpclient.ProxyOptions) {
+	client, err := httpclient.New(httpclient.Options{Proxy: opts})
+	if err == nil {
+		return client, opts
+	}
+	log.Printf("proxy: %v, using the system proxy", err)
+	opts = httpclient.ProxyOptions{Mode: config.ProxySystem}
+	client, _ = httpclient.New(httpclient.Options{Proxy: opts})
+	return client, opts
+}
+
+// TestConnection reaches the built-in endpoint through proxy, for the
+// settings window's test button. A PAC script that cannot be loaded or
+// run is reported as such, since requests would otherwise quietly go
+// direct.
+func TestConnection(ctx context.Context, proxy config.Proxy, secretsPath string) error {
+	creds, err := secrets.Load(secretsPath)
+	if err != nil {
+		return err
+	}
+	proxy = config.Normalize(config.Config{Proxy: proxy}).Proxy
+	if proxy.Mode == config.ProxyPAC {
+		if _, err := httpclient.CheckPAC(proxy.URL, source.YuluURL); err != nil {
+			return fmt.Errorf("pac script: %w", err)
+		}
+	}
+	client, err := httpclient.New(httpclient.Options{Proxy: ProxyOptions(proxy, creds)})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, testTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.YuluURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.CopyN(io.Discard, resp.Body, 4<<10)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -1,74 +1,334 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"yuluwallpaper/internal/calendar"
 	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/httpclient"
+	"yuluwallpaper/internal/netstate"
+	"yuluwallpaper/internal/overlay"
+	"yuluwallpaper/internal/rules"
+	"yuluwallpaper/internal/schedule"
+	"yuluwallpaper/internal/solar"
+	"yuluwallpaper/internal/source"
+	"yuluwallpaper/internal/state"
+	"yuluwallpaper/internal/sysinfo"
 	"yuluwallpaper/internal/wallpaper"
 )
 
-const WallpaperURL = "http://yulu.frogchou.com/api/v1/quotes/getdesktoppic"
+// wakeInterval bounds how long the run loop sleeps, so scheduled changes
+// still happen on time after the machine resumes from sleep.
+const wakeInterval = time.Minute
+
+// fetchTimeout bounds one refresh including fallbacks between sources.
+const fetchTimeout = 2 * time.Minute
+
+// retryDelays is how long to wait before trying again after a failed
+// refresh, independent of the regular schedule. The last delay repeats.
+var retryDelays = []time.Duration{
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	30 * time.Minute,
+}
 
 type Service struct {
 	mu          sync.Mutex
 	cfg         config.Config
 	assetsDir   string
+	store       *state.Store
+	client      *http.Client
+	proxy       httpclient.ProxyOptions
+	sources     []configuredSource
+	breakers    map[string]*breaker
+	nextSource  int
 	currentPath string
+	fontData    []byte
+	secretsPath string
+	plan        schedule.Schedule
+	nextChange  time.Time
+	rule        config.RuleAction
+	probeErr    string
+	failures    int
+	retryAt     time.Time
+
+	prefetchFailures int
+	prefetchAt       time.Time
+	prefetching      bool
+	prefetchCancel   func()
+	// prefetchWG tracks the background download, so cancelPrefetch can
+	// wait for it to let go of the sources.
+	prefetchWG sync.WaitGroup
+
+	// breakerMu guards breakers, and fetchMu keeps a background download
+	// and a refresh from using the sources at the same time.
+	breakerMu sync.Mutex
+	fetchMu   sync.Mutex
+
+	degraded   FallbackStep
+	onDegraded func(FallbackStep)
+	shown      source.Metadata
+	onShown    func(source.Metadata)
+
+	net     netstate.Status
+	pending bool
+
+	// usageMu guards the download usage log, which is loaded on first use
+	// and saved by flushUsage, and the running totals for usageDate.
+	usageMu    sync.Mutex
+	usage      usageLog
+	usageDirty bool
+	usageDate  string
+	usageDay   int64
+	usageMonth int64
 
-	refreshCh chan struct{}
-	updateCh  chan config.Config
-	stopCh    chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	refreshCh  chan struct{}
+	updateCh   chan config.Config
+	netCh      chan netstate.Status
+	prefetchCh chan prefetchResult
+	stopCh     chan struct{}
 }
 
-func NewService(cfg config.Config, assetsDir string) *Service {
+func NewService(cfg config.Config, assetsDir string, store *state.Store) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	if store == nil {
+		store, _ = state.Open("")
+	}
 	return &Service{
-		cfg:       cfg,
-		assetsDir: assetsDir,
-		refreshCh: make(chan struct{}, 1),
-		updateCh:  make(chan config.Config, 1),
-		stopCh:    make(chan struct{}),
+		cfg:        config.Normalize(cfg),
+		assetsDir:  assetsDir,
+		store:      store,
+		breakers:   make(map[string]*breaker),
+		ctx:        ctx,
+		cancel:     cancel,
+		refreshCh:  make(chan struct{}, 1),
+		updateCh:   make(chan config.Config, 1),
+		netCh:      make(chan netstate.Status, 1),
+		prefetchCh: make(chan prefetchResult),
+		stopCh:     make(chan struct{}),
 	}
 }
 
+// SetOverlayFont sets the font used for text drawn onto wallpapers. It must
+// be called before Run.
+func (s *Service) SetOverlayFont(data []byte) {
+	s.fontData = data
+}
+
+// SetSecretsPath sets the file source credentials are read from. It must
+// be called before Run.
+func (s *Service) SetSecretsPath(path string) {
+	s.secretsPath = path
+}
+
 func (s *Service) Run() {
-	s.refresh()
+	s.buildSources()
+	defer s.closeSources()
+	go s.watchNetwork()
+	if entries := s.history(); len(entries) > 0 {
+		s.setShown(entries[len(entries)-1].Meta)
+	}
 
-	interval := config.IntervalDuration(s.cfg.IntervalMinutes)
-	if interval <= 0 {
-		interval = config.IntervalDuration(config.Default().IntervalMinutes)
+	s.rule = rules.Evaluate(s.cfg.Rules, s.ruleEnv(time.Now()))
+	if !s.rule.Paused() {
+		s.refresh()
 	}
+	s.reschedule(time.Now())
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(s.wait())
+	defer timer.Stop()
+	flush := time.NewTicker(usageFlushInterval)
+	defer flush.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			s.refresh()
+		case <-timer.C:
+			now := time.Now()
+			s.applyRules(now)
+			if next := s.NextChange(); !next.IsZero() && !now.Before(next) {
+				s.refresh()
+				s.reschedule(now)
+			} else if !s.retryAt.IsZero() && !now.Before(s.retryAt) && !s.rule.Paused() {
+				s.change(false)
+			}
 		case <-s.refreshCh:
 			s.refresh()
+			s.reschedule(time.Now())
 		case newCfg := <-s.updateCh:
-			oldLayout := s.cfg.Layout
+			now := time.Now()
+			old := s.settingsAt(now)
 			s.cfg = config.Normalize(newCfg)
-			ticker.Stop()
-			ticker = time.NewTicker(config.IntervalDuration(s.cfg.IntervalMinutes))
-			if oldLayout != s.cfg.Layout && s.currentPath != "" {
-				if err := wallpaper.Set(s.currentPath, wallpaper.Layout(s.cfg.Layout)); err != nil {
-					log.Printf("apply layout failed: %v", err)
-				}
-			}
+			s.buildSources()
+			s.rule = rules.Evaluate(s.cfg.Rules, s.ruleEnv(now))
+			s.reschedule(now)
+			s.applySettings(old, now)
+		case status := <-s.netCh:
+			s.networkChanged(status)
+		case result := <-s.prefetchCh:
+			s.prefetched(result, time.Now())
+		case <-flush.C:
+			s.flushUsage(time.Now())
 		case <-s.stopCh:
 			return
 		}
+		s.topUp(time.Now())
+		resetTimer(timer, s.wait())
+	}
+}
+
+// applyRules re-evaluates the rules and applies whatever changed: a new
+// source refreshes, a new layout is re-applied and interval or pause
+// changes reschedule.
+func (s *Service) applyRules(now time.Time) {
+	old := s.settingsAt(now)
+	oldRule := s.rule
+	s.rule = rules.Evaluate(s.cfg.Rules, s.ruleEnv(now))
+	if s.rule == oldRule {
+		return
+	}
+	log.Printf("rules: active action is now %+v", s.rule)
+	if s.rule.IntervalMinutes != oldRule.IntervalMinutes || s.rule.Paused() != oldRule.Paused() {
+		s.reschedule(now)
+	}
+	s.applySettings(old, now)
+}
+
+func (s *Service) applySettings(old config.PhaseSettings, now time.Time) {
+	current := s.settingsAt(now)
+	switch {
+	case old.Source != current.Source && !s.rule.Paused():
+		s.refresh()
+		s.reschedule(now)
+	case old.Layout != current.Layout && s.currentPath != "":
+		if err := wallpaper.Set(s.currentPath, wallpaper.Layout(current.Layout)); err != nil {
+			log.Printf("apply layout failed: %v", err)
+		}
+	}
+}
+
+func (s *Service) ruleEnv(now time.Time) rules.Env {
+	env := rules.Env{Now: now}
+	needs := rules.NeedsOf(s.cfg.Rules)
+	var errs []string
+	if needs.Power {
+		power, err := sysinfo.PowerSource()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("power source: %v", err))
+		}
+		env.Power = string(power)
+	}
+	if needs.SSID {
+		ssid, err := sysinfo.WiFiSSID()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("wifi ssid: %v", err))
+		}
+		env.SSID = ssid
+	}
+	if needs.Monitors {
+		count, err := sysinfo.MonitorCount()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("monitor count: %v", err))
+		}
+		env.Monitors = count
+	}
+	if probeErr := strings.Join(errs, "; "); probeErr != s.probeErr {
+		s.probeErr = probeErr
+		if probeErr != "" {
+			log.Printf("rules: %s", probeErr)
+		}
+	}
+	return env
+}
+
+func (s *Service) NextChange() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nextChange
+}
+
+func (s *Service) UpcomingChanges(n int) []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plan == nil || s.nextChange.IsZero() {
+		return nil
 	}
+	return append([]time.Time{s.nextChange}, schedule.Upcoming(s.plan, s.nextChange, n-1)...)
+}
+
+func (s *Service) reschedule(now time.Time) {
+	plan := planFor(s.cfg, s.rule)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plan = plan
+	s.nextChange = time.Time{}
+	if plan != nil {
+		s.nextChange = plan.Next(now.Round(0))
+	}
+}
+
+func (s *Service) wait() time.Duration {
+	next := s.NextChange()
+	if !s.retryAt.IsZero() && (next.IsZero() || s.retryAt.Before(next)) {
+		next = s.retryAt
+	}
+	if next.IsZero() {
+		return wakeInterval
+	}
+	d := time.Until(next)
+	if d > wakeInterval {
+		return wakeInterval
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// planFor returns nil while a rule pauses rotation.
+func planFor(cfg config.Config, rule config.RuleAction) schedule.Schedule {
+	if rule.Paused() {
+		return nil
+	}
+	var plan schedule.Schedule
+	switch {
+	case rule.IntervalMinutes > 0:
+		plan = schedule.Every(config.IntervalDuration(rule.IntervalMinutes))
+	case cfg.Schedule != "":
+		plan, _ = schedule.Parse(cfg.Schedule)
+	}
+	if plan == nil {
+		interval := config.IntervalDuration(cfg.IntervalMinutes)
+		if interval <= 0 {
+			interval = config.IntervalDuration(config.Default().IntervalMinutes)
+		}
+		plan = schedule.Every(interval)
+	}
+	if cfg.DayNight.Enabled {
+		plan = schedule.Earliest(plan, solar.Transitions{Latitude: cfg.Location.Latitude, Longitude: cfg.Location.Longitude})
+	}
+	return plan
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
 }
 
 func (s *Service) RequestRefresh() {
@@ -91,84 +351,219 @@ func (s *Service) UpdateConfig(cfg config.Config) {
 }
 
 func (s *Service) Stop() {
+	s.cancel()
 	close(s.stopCh)
+	s.flushUsage(time.Now())
 }
 
 func (s *Service) refresh() {
-	path, err := downloadImage(WallpaperURL, s.assetsDir)
+	s.change(true)
+}
+
+// change fetches and applies a new wallpaper. When every source fails it
+// falls back to offline images if offline is set; a retry leaves the
+// current wallpaper alone instead, so an outage does not cycle it.
+func (s *Service) change(offline bool) {
+	now := time.Now()
+	s.rule = rules.Evaluate(s.cfg.Rules, s.ruleEnv(now))
+	settings := s.settingsAt(now)
+	theme := s.theme(now)
+
+	img, fp, ok := s.obtain(now, settings.Source, theme, offline)
+	if !ok {
+		return
+	}
+	path, err := saveImage(img, s.assetsDir)
 	if err != nil {
-		log.Printf("download failed: %v", err)
+		log.Printf("save wallpaper failed: %v", err)
 		return
 	}
-	if err := wallpaper.Set(path, wallpaper.Layout(s.cfg.Layout)); err != nil {
+	opts := overlay.Options{Font: s.fontData}
+	if theme != "" && s.cfg.Festival.Overlay {
+		opts.Caption = theme
+	}
+	if s.cfg.Credit && !img.Meta.Drawn {
+		opts.Credit = creditLine(img.Meta)
+	}
+	if captioned, err := overlay.Apply(path, opts); err != nil {
+		log.Printf("overlay failed: %v", err)
+	} else {
+		path = captioned
+	}
+	if err := wallpaper.Set(path, wallpaper.Layout(settings.Layout)); err != nil {
 		log.Printf("set wallpaper failed: %v", err)
 		return
 	}
 
+	entry := fp.entry(now)
+	entry.Meta = img.Meta
+	s.recordShown(entry, img)
+
 	s.mu.Lock()
 	s.currentPath = path
 	s.mu.Unlock()
+	s.setShown(img.Meta)
 }
 
-func downloadImage(url, destDir string) (string, error) {
-	if err := os.MkdirAll(destDir, 0o755); err != nil {
-		return "", err
+// creditLine joins what is known about an image into one line, leaving
+// out an author the copyright notice already names.
+func creditLine(meta source.Metadata) string {
+	var parts []string
+	for _, part := range []string{meta.Title, meta.Author, meta.Copyright} {
+		part = strings.TrimSpace(part)
+		if part == "" || part == meta.Author && strings.Contains(meta.Copyright, part) {
+			continue
+		}
+		parts = append(parts, part)
 	}
+	return strings.Join(parts, " · ")
+}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+// Shown returns what the source said about the current wallpaper.
+func (s *Service) Shown() source.Metadata {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shown
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+// SetShownHandler registers fn to be called, from the service's goroutine,
+// with the metadata of each wallpaper applied. It must be called before
+// Run.
+func (s *Service) SetShownHandler(fn func(source.Metadata)) {
+	s.onShown = fn
+}
+
+func (s *Service) setShown(meta source.Metadata) {
+	s.mu.Lock()
+	s.shown = meta
+	s.mu.Unlock()
+	if s.onShown != nil {
+		s.onShown(meta)
 	}
+}
 
-	ext := extensionFromContentType(resp.Header.Get("Content-Type"))
-	if ext == "" {
-		ext = ".img"
+// obtain gets the next image: downloaded or prefetched when the network
+// may be used, and from disk otherwise. It reports false when the current
+// wallpaper should stay.
+func (s *Service) obtain(now time.Time, preferred, theme string, offline bool) (*source.Image, fingerprint, bool) {
+	if reason := s.localReason(); reason != "" {
+		s.pending = true
+		if !offline || !s.net.Offline && s.cfg.Network.Metered == config.MeteredSkip {
+			log.Printf("%s, postponing the refresh", reason)
+			return nil, fingerprint{}, false
+		}
+		log.Printf("%s, using images already on disk", reason)
+		img, fp, step, err := s.local(now, preferred)
+		if err != nil {
+			log.Printf("no local image: %v", err)
+			return nil, fingerprint{}, false
+		}
+		s.setDegraded(step)
+		return img, fp, true
 	}
 
-	tmp, err := os.CreateTemp(destDir, "wallpaper-*")
+	ctx, cancel := context.WithTimeout(s.ctx, fetchTimeout)
+	defer cancel()
+	img, fp, err := s.nextImage(ctx, preferred, theme)
+	if errors.Is(err, errUnchanged) {
+		log.Printf("keeping the current wallpaper: %v", err)
+		s.failures, s.retryAt, s.pending = 0, time.Time{}, false
+		return nil, fingerprint{}, false
+	}
 	if err != nil {
-		return "", err
+		log.Printf("download failed: %v", err)
+		s.scheduleRetry(now, retryAfter(err))
+		if !offline {
+			return nil, fingerprint{}, false
+		}
+		var step FallbackStep
+		if img, fp, step, err = s.fallback(now); err != nil {
+			log.Printf("offline fallback failed: %v", err)
+			return nil, fingerprint{}, false
+		}
+		s.setDegraded(step)
+		return img, fp, true
 	}
-	defer func() {
-		_ = tmp.Close()
-		_ = os.Remove(tmp.Name())
-	}()
+	s.failures, s.retryAt, s.pending = 0, time.Time{}, false
+	s.setDegraded("")
+	return img, fp, true
+}
+
+// scheduleRetry backs off after a failed refresh, and waits at least as
+// long as the servers asked to through Retry-After.
+func (s *Service) scheduleRetry(now time.Time, retryAfter time.Duration) {
+	delay := max(retryDelays[min(s.failures, len(retryDelays)-1)], retryAfter)
+	s.failures++
+	s.retryAt = now.Add(delay)
+	log.Printf("retrying in %s", delay)
+}
 
-	if _, err := io.Copy(tmp, resp.Body); err != nil {
-		return "", err
+func (s *Service) theme(t time.Time) string {
+	if !s.cfg.Festival.Enabled {
+		return ""
 	}
-	if err := tmp.Close(); err != nil {
-		return "", err
+	name, _ := calendar.Theme(t)
+	return name
+}
+
+// fetch prefers a themed image on solar terms and festivals, falling back
+// to the regular sources when none is available.
+func (s *Service) fetch(ctx context.Context, preferred, theme string) (*source.Image, error) {
+	candidates := s.candidates(preferred)
+	if theme != "" {
+		img, err := s.fetchTheme(ctx, candidates, theme)
+		if err == nil {
+			return img, nil
+		}
+		log.Printf("themed image for %s: %v", theme, err)
 	}
+	return s.fetchFirst(ctx, candidates)
+}
 
-	finalPath := filepath.Join(destDir, "wallpaper"+ext)
-	_ = os.Remove(finalPath)
-	if err := os.Rename(tmp.Name(), finalPath); err != nil {
-		return "", err
+func (s *Service) fetchTheme(ctx context.Context, candidates []source.Source, theme string) (*source.Image, error) {
+	if s.cfg.Festival.ThemedDir != "" {
+		img, err := themedImage(filepath.Join(s.cfg.Festival.ThemedDir, theme))
+		if err == nil {
+			return img, nil
+		}
+		log.Printf("themed folder for %s: %v", theme, err)
+	}
+	for _, src := range candidates {
+		themed, ok := src.(source.Themed)
+		if !ok {
+			continue
+		}
+		img, err := s.attempt(src, func() (*source.Image, error) {
+			return themed.FetchTheme(ctx, s.cfg.Festival.Param, theme)
+		})
+		if err == nil {
+			return img, nil
+		}
+		if !errors.Is(err, errBreakerOpen) {
+			log.Printf("source %s: themed fetch failed: %v", src.Name(), err)
+		}
 	}
-	return finalPath, nil
+	return nil, errors.New("no themed image available")
 }
 
-func extensionFromContentType(contentType string) string {
-	contentType = strings.ToLower(contentType)
-	switch {
-	case strings.Contains(contentType, "image/png"):
-		return ".png"
-	case strings.Contains(contentType, "image/jpeg"):
-		return ".jpg"
-	case strings.Contains(contentType, "image/jpg"):
-		return ".jpg"
-	case strings.Contains(contentType, "image/bmp"):
-		return ".bmp"
-	case strings.Contains(contentType, "image/gif"):
-		return ".gif"
-	default:
-		return ""
+// settingsAt resolves the image endpoint and layout in effect at t. The
+// active rule wins over the day/night phase, which wins over the defaults.
+func (s *Service) settingsAt(t time.Time) config.PhaseSettings {
+	settings := config.PhaseSettings{Layout: s.cfg.Layout}
+	if s.cfg.DayNight.Enabled {
+		phase := s.cfg.DayNight.For(solar.PhaseAt(t, s.cfg.Location.Latitude, s.cfg.Location.Longitude))
+		if phase.Source != "" {
+			settings.Source = phase.Source
+		}
+		if phase.Layout != "" {
+			settings.Layout = phase.Layout
+		}
+	}
+	if s.rule.Source != "" {
+		settings.Source = s.rule.Source
+	}
+	if s.rule.Layout != "" {
+		settings.Layout = s.rule.Layout
 	}
+	return settings
 }
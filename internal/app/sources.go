@@ -0,0 +1,254 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/httpclient"
+	"yuluwallpaper/internal/secrets"
+	"yuluwallpaper/internal/source"
+)
+
+type configuredSource struct {
+	cfg config.SourceConfig
+	src source.Source
+}
+
+func (s *Service) buildSources() {
+	s.closeSources()
+	creds, err := secrets.Load(s.secretsPath)
+	if err != nil {
+		log.Printf("secrets load failed: %v", err)
+	}
+	s.client, s.proxy = newClient(ProxyOptions(s.cfg.Proxy, creds))
+	env := source.Env{
+		Client:   s.client,
+		State:    s.store,
+		Secrets:  creds,
+		CacheDir: filepath.Join(s.assetsDir, "cache"),
+		Proxy:    s.proxy,
+		Usage:    s.addUsage,
+		Font:     s.fontData,
+	}
+	for _, cfg := range s.cfg.Sources {
+		src, err := source.New(cfg, env)
+		if err != nil {
+			log.Printf("skipping source: %v", err)
+			continue
+		}
+		s.sources = append(s.sources, configuredSource{cfg: cfg, src: src})
+	}
+	s.nextSource = 0
+}
+
+// offlineSources lists the enabled sources that never use the network, in
+// rotation order.
+func (s *Service) offlineSources() []source.Source {
+	offline := make(map[string]bool)
+	for _, cs := range s.sources {
+		switch cs.cfg.Type {
+		case config.SourceFolder, config.SourceGenerate:
+			offline[cs.cfg.Name] = true
+		}
+	}
+	var list []source.Source
+	for _, src := range s.rotation() {
+		if offline[src.Name()] {
+			list = append(list, src)
+		}
+	}
+	return list
+}
+
+// closeSources closes the sources once the background download, if any,
+// has stopped using them.
+func (s *Service) closeSources() {
+	s.cancelPrefetch()
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+	for _, cs := range s.sources {
+		if closer, ok := cs.src.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("source %s: close failed: %v", cs.cfg.Name, err)
+			}
+		}
+	}
+	s.sources = nil
+}
+
+// candidates lists the sources to try for one refresh, in order. A
+// preferred source, named by a day/night phase or a rule, goes first; it may
+// also be a URL, which is fetched like the built-in yulu endpoint.
+func (s *Service) candidates(preferred string) []source.Source {
+	var list []source.Source
+	if preferred != "" {
+		if src := s.preferredSource(preferred); src != nil {
+			list = append(list, src)
+		}
+	}
+	for _, src := range s.rotation() {
+		if src.Name() != preferred {
+			list = append(list, src)
+		}
+	}
+	return list
+}
+
+func (s *Service) preferredSource(name string) source.Source {
+	for _, cs := range s.sources {
+		if cs.cfg.Name == name {
+			return cs.src
+		}
+	}
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		src, err := source.New(config.SourceConfig{Name: name, Type: config.SourceYulu, URL: name}, source.Env{Client: s.client, State: s.store, Proxy: s.proxy, Usage: s.addUsage})
+		if err == nil {
+			return src
+		}
+	}
+	log.Printf("unknown source %q", name)
+	return nil
+}
+
+// rotation orders the enabled sources for this refresh: a weighted random
+// draw without replacement, or round-robin starting after the last pick.
+func (s *Service) rotation() []source.Source {
+	var enabled []configuredSource
+	for _, cs := range s.sources {
+		if cs.cfg.Enabled {
+			enabled = append(enabled, cs)
+		}
+	}
+	ordered := make([]source.Source, 0, len(enabled))
+	if len(enabled) == 0 {
+		return ordered
+	}
+
+	if s.cfg.SourceOrder == config.OrderRoundRobin {
+		start := s.nextSource % len(enabled)
+		s.nextSource = start + 1
+		for i := range enabled {
+			ordered = append(ordered, enabled[(start+i)%len(enabled)].src)
+		}
+		return ordered
+	}
+
+	for len(enabled) > 0 {
+		total := 0
+		for _, cs := range enabled {
+			total += cs.cfg.Weight
+		}
+		pick := rand.Intn(total)
+		for i, cs := range enabled {
+			if pick < cs.cfg.Weight {
+				ordered = append(ordered, cs.src)
+				enabled = append(enabled[:i], enabled[i+1:]...)
+				break
+			}
+			pick -= cs.cfg.Weight
+		}
+	}
+	return ordered
+}
+
+func (s *Service) fetchFirst(ctx context.Context, candidates []source.Source) (*source.Image, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("no enabled sources")
+	}
+	var errs []error
+	for _, src := range candidates {
+		img, err := s.attempt(src, func() (*source.Image, error) { return src.Fetch(ctx) })
+		if err == nil {
+			return img, nil
+		}
+		switch {
+		case errors.Is(err, source.ErrNotModified):
+			log.Printf("source %s: image unchanged", src.Name())
+		case !errors.Is(err, errBreakerOpen):
+			log.Printf("source %s: fetch failed: %v", src.Name(), err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+var errBreakerOpen = errors.New("skipped after repeated failures")
+
+// attempt runs fetch unless the source's circuit breaker is open, and
+// records the outcome. Cancellation does not count against the source.
+func (s *Service) attempt(src source.Source, fetch func() (*source.Image, error)) (*source.Image, error) {
+	s.breakerMu.Lock()
+	b := s.breakers[src.Name()]
+	if b == nil {
+		b = &breaker{}
+		s.breakers[src.Name()] = b
+	}
+	now := time.Now()
+	allowed := b.allow(now)
+	s.breakerMu.Unlock()
+	if !allowed {
+		return nil, errBreakerOpen
+	}
+	s.fetchMu.Lock()
+	img, err := fetch()
+	s.fetchMu.Unlock()
+	wait, _ := httpclient.RetryAfterOf(err)
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	switch {
+	case err == nil, errors.Is(err, source.ErrNotModified):
+		b.success()
+	case errors.Is(err, context.Canceled):
+	case b.failure(now, wait):
+		log.Printf("source %s: %d failures in a row, pausing it for %s", src.Name(), b.failures, b.openUntil.Sub(now).Round(time.Second))
+	}
+	return img, err
+}
+
+// retryAfter is how long every source that failed asked to be left alone,
+// the shortest of their Retry-After waits. It is zero when any failure
+// came without one, so the normal retry schedule applies. Sources skipped
+// by their breaker do not count either way.
+func retryAfter(err error) time.Duration {
+	var wait time.Duration
+	for _, err := range flatten(err) {
+		if errors.Is(err, errBreakerOpen) {
+			continue
+		}
+		after, ok := httpclient.RetryAfterOf(err)
+		if !ok {
+			return 0
+		}
+		if wait == 0 || after < wait {
+			wait = after
+		}
+	}
+	return wait
+}
+
+// flatten lists the errors joined into err, or err itself.
+func flatten(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		if err == nil {
+			return nil
+		}
+		return []error{err}
+	}
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, flatten(err)...)
+	}
+	return errs
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	usageKey = "usage"
+	// usageDays is how long daily totals are kept, enough to cover the
+	// current and the previous month.
+	usageDays = 62
+	// usageFlushInterval is how often counted downloads are saved.
+	usageFlushInterval = time.Minute
+)
+
+// usageLog maps a day (2006-01-02, local time) to the bytes each source
+// downloaded that day.
+type usageLog map[string]map[string]int64
+
+// Usage is what the sources downloaded today and this month, in bytes.
+type Usage struct {
+	Day     int64
+	Month   int64
+	Sources []SourceUsage
+}
+
+type SourceUsage struct {
+	Name  string
+	Day   int64
+	Month int64
+}
+
+// addUsage is called by the sources' HTTP clients, possibly from several
+// goroutines. It only counts in memory; flushUsage saves the log.
+func (s *Service) addUsage(name string, n int64) {
+	s.recordUsage(name, n, time.Now())
+}
+
+func (s *Service) recordUsage(name string, n int64, now time.Time) {
+	if n <= 0 {
+		return
+	}
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	s.usageTotalsLocked(now)
+	today := now.Format(time.DateOnly)
+	if s.usage[today] == nil {
+		s.usage[today] = make(map[string]int64)
+	}
+	s.usage[today][name] += n
+	s.usageDay += n
+	s.usageMonth += n
+	s.usageDirty = true
+}
+
+// flushUsage saves the usage log if anything was downloaded since the last
+// flush, dropping days older than usageDays.
+func (s *Service) flushUsage(now time.Time) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	if !s.usageDirty {
+		return
+	}
+	oldest := now.AddDate(0, 0, -usageDays).Format(time.DateOnly)
+	for day := range s.usage {
+		if day < oldest {
+			delete(s.usage, day)
+		}
+	}
+	if err := s.store.Put(usageKey, s.usage); err != nil {
+		log.Printf("save download usage failed: %v", err)
+		return
+	}
+	s.usageDirty = false
+}
+
+// usageTotalsLocked returns the totals of the day and the month containing
+// now. They are kept as running sums and only recounted when the day
+// changes. s.usageMu must be held.
+func (s *Service) usageTotalsLocked(now time.Time) (day, month int64) {
+	if s.usage == nil {
+		s.usage = usageLog{}
+		s.store.Get(usageKey, &s.usage)
+	}
+	today := now.Format(time.DateOnly)
+	if today != s.usageDate {
+		s.usageDate, s.usageDay, s.usageMonth = today, 0, 0
+		for d, sources := range s.usage {
+			if !strings.HasPrefix(d, today[:len("2006-01")]) {
+				continue
+			}
+			for _, n := range sources {
+				s.usageMonth += n
+				if d == today {
+					s.usageDay += n
+				}
+			}
+		}
+	}
+	return s.usageDay, s.usageMonth
+}
+
+// Usage totals the downloads of the day and the month containing now.
+func (s *Service) Usage(now time.Time) Usage {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	s.usageTotalsLocked(now)
+	days := s.usage
+	today, month := now.Format(time.DateOnly), now.Format("2006-01")
+	var usage Usage
+	bySource := make(map[string]*SourceUsage)
+	for day, sources := range days {
+		if !strings.HasPrefix(day, month) {
+			continue
+		}
+		for name, n := range sources {
+			su := bySource[name]
+			if su == nil {
+				su = &SourceUsage{Name: name}
+				bySource[name] = su
+			}
+			su.Month += n
+			usage.Month += n
+			if day == today {
+				su.Day += n
+				usage.Day += n
+			}
+		}
+	}
+	for _, su := range bySource {
+		usage.Sources = append(usage.Sources, *su)
+	}
+	sort.Slice(usage.Sources, func(i, j int) bool {
+		a, b := usage.Sources[i], usage.Sources[j]
+		if a.Month != b.Month {
+			return a.Month > b.Month
+		}
+		return a.Name < b.Name
+	})
+	return usage
+}
+
+// overBudget reports whether the daily or monthly cap has been reached.
+func (s *Service) overBudget(now time.Time) bool {
+	daily, monthly := int64(s.cfg.Network.DailyMB)<<20, int64(s.cfg.Network.MonthlyMB)<<20
+	if daily == 0 && monthly == 0 {
+		return false
+	}
+	s.usageMu.Lock()
+	day, month := s.usageTotalsLocked(now)
+	s.usageMu.Unlock()
+	return daily > 0 && day >= daily || monthly > 0 && month >= monthly
+}
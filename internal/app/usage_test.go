@@ -0,0 +1,80 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/state"
+)
+
+func TestUsageFlush(t *testing.T) {
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewService(config.Default(), t.TempDir(), store)
+	now := time.Date(2024, 3, 31, 23, 0, 0, 0, time.Local)
+
+	s.recordUsage("bing", 100, now)
+	s.recordUsage("unsplash", 50, now)
+	if store.Get(usageKey, &usageLog{}) {
+		t.Fatal("usage saved before a flush")
+	}
+	s.flushUsage(now)
+	var saved usageLog
+	if !store.Get(usageKey, &saved) || saved["2024-03-31"]["bing"] != 100 {
+		t.Fatalf("saved usage %v", saved)
+	}
+
+	// A new service picks up what was saved, and the totals roll over with
+	// the day and the month.
+	s = NewService(config.Default(), t.TempDir(), store)
+	if u := s.Usage(now); u.Day != 150 || u.Month != 150 || len(u.Sources) != 2 || u.Sources[0].Name != "bing" {
+		t.Errorf("usage %+v", u)
+	}
+	tomorrow := now.Add(2 * time.Hour)
+	s.recordUsage("bing", 10, tomorrow)
+	if u := s.Usage(tomorrow); u.Day != 10 || u.Month != 10 {
+		t.Errorf("usage on the next day %+v", u)
+	}
+	if u := s.Usage(now); u.Day != 150 || u.Month != 150 {
+		t.Errorf("usage of the previous day %+v", u)
+	}
+
+	// Stop saves what was counted since the last flush.
+	s.addUsage("bing", 20)
+	s.Stop()
+	saved = nil
+	if !store.Get(usageKey, &saved) || saved[time.Now().Format(time.DateOnly)]["bing"] != 20 {
+		t.Errorf("Stop did not flush usage: %v", saved)
+	}
+}
+
+func TestOverBudget(t *testing.T) {
+	cfg := config.Default()
+	cfg.Network.DailyMB = 1
+	cfg.Network.MonthlyMB = 2
+	s := NewService(cfg, t.TempDir(), nil)
+	day := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+
+	s.recordUsage("bing", 1<<20-1, day)
+	if s.overBudget(day) {
+		t.Error("over budget below the daily cap")
+	}
+	s.recordUsage("bing", 1, day)
+	if !s.overBudget(day) {
+		t.Error("not over budget at the daily cap")
+	}
+	next := day.AddDate(0, 0, 1)
+	if s.overBudget(next) {
+		t.Error("daily cap carried into the next day")
+	}
+	s.recordUsage("bing", 1<<20, next)
+	if !s.overBudget(next.AddDate(0, 0, 1)) {
+		t.Error("not over budget at the monthly cap")
+	}
+	if s.overBudget(day.AddDate(0, 1, 0)) {
+		t.Error("monthly cap carried into the next month")
+	}
+}
@@ -0,0 +1,248 @@
+package calendar
+
+import (
+	"math"
+	"time"
+)
+
+// Dates are reckoned in China Standard Time, as the traditional calendar is.
+var chinaTime = time.FixedZone("CST", 8*3600)
+
+var solarTermNames = []string{
+	"春分", "清明", "谷雨", "立夏", "小满", "芒种",
+	"夏至", "小暑", "大暑", "立秋", "处暑", "白露",
+	"秋分", "寒露", "霜降", "立冬", "小雪", "大雪",
+	"冬至", "小寒", "大寒", "立春", "雨水", "惊蛰",
+}
+
+type lunarFestival struct {
+	month, day int
+	name       string
+}
+
+var lunarFestivals = []lunarFestival{
+	{month: 1, day: 1, name: "春节"},
+	{month: 1, day: 15, name: "元宵"},
+	{month: 5, day: 5, name: "端午"},
+	{month: 7, day: 7, name: "七夕"},
+	{month: 8, day: 15, name: "中秋"},
+	{month: 9, day: 9, name: "重阳"},
+	{month: 12, day: 8, name: "腊八"},
+}
+
+type LunarDate struct {
+	Month int
+	Day   int
+	Leap  bool
+}
+
+// Theme returns the festival or solar term that falls on the calendar date
+// of t, festivals first.
+func Theme(t time.Time) (string, bool) {
+	if name, ok := Festival(t); ok {
+		return name, true
+	}
+	return SolarTerm(t)
+}
+
+func SolarTerm(t time.Time) (string, bool) {
+	day := dayNumber(t)
+	before := sunLongitude(dayStart(day))
+	after := sunLongitude(dayStart(day + 1))
+	if math.Floor(before/15) == math.Floor(after/15) {
+		return "", false
+	}
+	return solarTermNames[int(math.Floor(after/15))%24], true
+}
+
+func Festival(t time.Time) (string, bool) {
+	date := Lunar(t)
+	if date.Leap {
+		return "", false
+	}
+	for _, f := range lunarFestivals {
+		if f.month == date.Month && f.day == date.Day {
+			return f.name, true
+		}
+	}
+	if date.Month == 12 {
+		if next := Lunar(t.AddDate(0, 0, 1)); next.Month == 1 && next.Day == 1 && !next.Leap {
+			return "除夕", true
+		}
+	}
+	return "", false
+}
+
+func Lunar(t time.Time) LunarDate {
+	day := dayNumber(t)
+	from, to := winterSolstice(t.Year()-1), winterSolstice(t.Year())
+	if next, _ := newMoonOnOrBefore(to); day >= next {
+		from, to = to, winterSolstice(t.Year()+1)
+	}
+	starts := monthStarts(from, to)
+
+	leap := -1
+	if len(starts) == 14 {
+		for i := 1; i < len(starts)-1; i++ {
+			if !hasMajorTerm(starts[i], starts[i+1]) {
+				leap = i
+				break
+			}
+		}
+	}
+
+	month := 11
+	for i := 0; i < len(starts)-1; i++ {
+		if i > 0 && i != leap {
+			month = month%12 + 1
+		}
+		if day >= starts[i] && day < starts[i+1] {
+			return LunarDate{Month: month, Day: day - starts[i] + 1, Leap: i == leap}
+		}
+	}
+	return LunarDate{}
+}
+
+// monthStarts lists the first days of the lunar months from the eleventh
+// month containing one winter solstice up to and including the eleventh
+// month containing the next.
+func monthStarts(fromSolstice, toSolstice int) []int {
+	first, k := newMoonOnOrBefore(fromSolstice)
+	last, _ := newMoonOnOrBefore(toSolstice)
+	starts := []int{first}
+	for start := first; start < last; {
+		k++
+		start = newMoonDay(k)
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+func hasMajorTerm(start, end int) bool {
+	from := math.Floor(sunLongitude(dayStart(start)) / 30)
+	to := math.Floor(sunLongitude(dayStart(end)) / 30)
+	return from != to
+}
+
+func winterSolstice(year int) int {
+	for day := dayNumber(time.Date(year, 12, 18, 0, 0, 0, 0, chinaTime)); ; day++ {
+		if sunLongitude(dayStart(day+1)) >= 270 && sunLongitude(dayStart(day)) < 270 {
+			return day
+		}
+	}
+}
+
+func newMoonOnOrBefore(day int) (int, float64) {
+	k := math.Floor((dayStart(day)-2451550.09766)/29.530588861) + 1
+	for newMoonDay(k) > day {
+		k--
+	}
+	return newMoonDay(k), k
+}
+
+func newMoonDay(k float64) int {
+	return dayNumber(fromJulianDay(newMoon(k)))
+}
+
+// dayNumber counts days since the Unix epoch for the calendar date of t.
+func dayNumber(t time.Time) int {
+	y, m, d := t.Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+func dayStart(day int) float64 {
+	return julianDay(time.Unix(int64(day)*86400-8*3600, 0))
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix())/86400 + 2440587.5
+}
+
+func fromJulianDay(jd float64) time.Time {
+	return time.Unix(int64(math.Round((jd-2440587.5)*86400)), 0).In(chinaTime)
+}
+
+// deltaT approximates TT-UT in days for the years this calendar is used.
+const deltaT = 69.0 / 86400
+
+// sunLongitude returns the apparent ecliptic longitude of the sun in
+// degrees (Meeus, Astronomical Algorithms, ch. 25).
+func sunLongitude(jd float64) float64 {
+	t := (jd + deltaT - 2451545) / 36525
+	l0 := 280.46646 + 36000.76983*t + 0.0003032*t*t
+	m := rad(357.52911 + 35999.05029*t - 0.0001537*t*t)
+	c := (1.914602-0.004817*t-0.000014*t*t)*math.Sin(m) +
+		(0.019993-0.000101*t)*math.Sin(2*m) +
+		0.000289*math.Sin(3*m)
+	omega := rad(125.04 - 1934.136*t)
+	lambda := l0 + c - 0.00569 - 0.00478*math.Sin(omega)
+	return math.Mod(math.Mod(lambda, 360)+360, 360)
+}
+
+// newMoon returns the Julian day (UT) of lunation k, counted from the new
+// moon of 6 January 2000 (Meeus, Astronomical Algorithms, ch. 49).
+func newMoon(k float64) float64 {
+	t := k / 1236.85
+	t2, t3, t4 := t*t, t*t*t, t*t*t*t
+	jde := 2451550.09766 + 29.530588861*k + 0.00015437*t2 - 0.000000150*t3 + 0.00000000073*t4
+	e := 1 - 0.002516*t - 0.0000074*t2
+	m := rad(2.5534 + 29.10535670*k - 0.0000014*t2 - 0.00000011*t3)
+	mp := rad(201.5643 + 385.81693528*k + 0.0107582*t2 + 0.00001238*t3 - 0.000000058*t4)
+	f := rad(160.7108 + 390.67050284*k - 0.0016118*t2 - 0.00000227*t3 + 0.000000011*t4)
+	omega := rad(124.7746 - 1.56375588*k + 0.0020672*t2 + 0.00000215*t3)
+
+	jde += -0.40720*math.Sin(mp) +
+		0.17241*e*math.Sin(m) +
+		0.01608*math.Sin(2*mp) +
+		0.01039*math.Sin(2*f) +
+		0.00739*e*math.Sin(mp-m) -
+		0.00514*e*math.Sin(mp+m) +
+		0.00208*e*e*math.Sin(2*m) -
+		0.00111*math.Sin(mp-2*f) -
+		0.00057*math.Sin(mp+2*f) +
+		0.00056*e*math.Sin(2*mp+m) -
+		0.00042*math.Sin(3*mp) +
+		0.00042*e*math.Sin(m+2*f) +
+		0.00038*e*math.Sin(m-2*f) -
+		0.00024*e*math.Sin(2*mp-m) -
+		0.00017*math.Sin(omega) -
+		0.00007*math.Sin(mp+2*m) +
+		0.00004*math.Sin(2*mp-2*f) +
+		0.00004*math.Sin(3*m) +
+		0.00003*math.Sin(mp+m-2*f) +
+		0.00003*math.Sin(2*mp+2*f) -
+		0.00003*math.Sin(mp+m+2*f) +
+		0.00003*math.Sin(mp-m+2*f) -
+		0.00002*math.Sin(mp-m-2*f) -
+		0.00002*math.Sin(3*mp+m) +
+		0.00002*math.Sin(4*mp)
+
+	planetary := []struct{ coef, base, rate float64 }{
+		{0.000325, 299.77, 0.107408},
+		{0.000165, 251.88, 0.016321},
+		{0.000164, 251.83, 26.651886},
+		{0.000126, 349.42, 36.412478},
+		{0.000110, 84.66, 18.206239},
+		{0.000062, 141.74, 53.303771},
+		{0.000060, 207.14, 2.453732},
+		{0.000056, 154.84, 7.306860},
+		{0.000047, 34.52, 27.261239},
+		{0.000042, 207.19, 0.121824},
+		{0.000040, 291.34, 1.844379},
+		{0.000037, 161.72, 24.198154},
+		{0.000035, 239.56, 25.513099},
+		{0.000023, 331.55, 3.592518},
+	}
+	for i, p := range planetary {
+		arg := p.base + p.rate*k
+		if i == 0 {
+			arg -= 0.009173 * t2
+		}
+		jde += p.coef * math.Sin(rad(arg))
+	}
+	return jde - deltaT
+}
+
+func rad(d float64) float64 {
+	return d * math.Pi / 180
+}
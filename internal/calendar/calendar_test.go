@@ -0,0 +1,75 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 12, 0, 0, 0, chinaTime)
+}
+
+func TestFestival(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{date(2023, 1, 22), "春节"},
+		{date(2024, 2, 10), "春节"},
+		{date(2024, 2, 9), "除夕"},
+		{date(2024, 2, 24), "元宵"},
+		{date(2024, 6, 10), "端午"},
+		{date(2024, 9, 17), "中秋"},
+		{date(2023, 9, 29), "中秋"},
+		{date(2024, 9, 18), ""},
+	}
+	for _, tt := range tests {
+		got, ok := Festival(tt.date)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Festival(%s) = %q, %t, want %q", tt.date.Format(time.DateOnly), got, ok, tt.want)
+		}
+	}
+}
+
+func TestLunarLeapMonths(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want LunarDate
+	}{
+		{date(2020, 5, 22), LunarDate{Month: 4, Day: 30}},
+		{date(2020, 5, 23), LunarDate{Month: 4, Day: 1, Leap: true}},
+		{date(2020, 6, 21), LunarDate{Month: 5, Day: 1}},
+		{date(2023, 3, 22), LunarDate{Month: 2, Day: 1, Leap: true}},
+		{date(2023, 4, 20), LunarDate{Month: 3, Day: 1}},
+		{date(2025, 7, 25), LunarDate{Month: 6, Day: 1, Leap: true}},
+		{date(2025, 8, 23), LunarDate{Month: 7, Day: 1}},
+		{date(2033, 12, 22), LunarDate{Month: 11, Day: 1, Leap: true}},
+		{date(2034, 1, 20), LunarDate{Month: 12, Day: 1}},
+	}
+	for _, tt := range tests {
+		if got := Lunar(tt.date); got != tt.want {
+			t.Errorf("Lunar(%s) = %+v, want %+v", tt.date.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
+
+func TestSolarTerm(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{date(2024, 2, 4), "立春"},
+		{date(2024, 4, 4), "清明"},
+		{date(2024, 6, 21), "夏至"},
+		{date(2024, 9, 22), "秋分"},
+		{date(2023, 12, 22), "冬至"},
+		{date(2024, 12, 21), "冬至"},
+		{date(2024, 2, 5), ""},
+	}
+	for _, tt := range tests {
+		got, ok := SolarTerm(tt.date)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("SolarTerm(%s) = %q, %t, want %q", tt.date.Format(time.DateOnly), got, ok, tt.want)
+		}
+	}
+}
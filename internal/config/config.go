@@ -3,9 +3,17 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"yuluwallpaper/internal/schedule"
+	"yuluwallpaper/internal/solar"
 )
 
 const AppName = "yuluwallpaper"
@@ -21,9 +29,335 @@ const (
 )
 
 type Config struct {
-	IntervalMinutes int    `json:"interval_minutes"`
-	Layout          Layout `json:"layout"`
-	AutoStart       bool   `json:"auto_start"`
+	IntervalMinutes int            `json:"interval_minutes"`
+	Schedule        string         `json:"schedule,omitempty"`
+	Layout          Layout         `json:"layout"`
+	AutoStart       bool           `json:"auto_start"`
+	Location        Location       `json:"location"`
+	DayNight        DayNight       `json:"day_night"`
+	Festival        Festival       `json:"festival"`
+	Rules           []Rule         `json:"rules,omitempty"`
+	Sources         []SourceConfig `json:"sources"`
+	SourceOrder     string         `json:"source_order"`
+	Proxy           Proxy          `json:"proxy"`
+	Dedup           Dedup          `json:"dedup"`
+	// Prefetch is how many images to keep downloaded ahead of time; a
+	// negative value turns prefetching off.
+	Prefetch int     `json:"prefetch"`
+	Network  Network `json:"network"`
+	// Credit draws the title, author and copyright of each wallpaper in
+	// its bottom-right corner.
+	Credit bool `json:"credit,omitempty"`
+}
+
+const (
+	MeteredCache  = "cache"
+	MeteredSkip   = "skip"
+	MeteredIgnore = "ignore"
+)
+
+// Network says what a refresh does on a metered connection: use only
+// images already on disk, postpone until the connection is unmetered, or
+// download as usual.
+//
+// DailyMB and MonthlyMB cap what all sources together may download; once
+// either is reached, refreshes use images already on disk. Zero means no
+// cap.
+type Network struct {
+	Metered   string `json:"metered"`
+	DailyMB   int    `json:"daily_mb,omitempty"`
+	MonthlyMB int    `json:"monthly_mb,omitempty"`
+}
+
+// Dedup keeps an image identical to a recent wallpaper from being applied
+// again. Retries is how many more fetches a refresh may make for a
+// different image; with none, the current wallpaper is simply kept.
+//
+// Besides exact copies among the last Recent wallpapers, images whose
+// perceptual hash is within Distance bits of anything shown in the last
+// Days days count as the same photo. A negative Distance turns this off.
+type Dedup struct {
+	Recent   int `json:"recent"`
+	Retries  int `json:"retries,omitempty"`
+	Distance int `json:"distance"`
+	Days     int `json:"days"`
+}
+
+const (
+	MaxDedupRetries  = 5
+	MaxDedupDistance = 32
+	MaxPrefetch      = 20
+)
+
+const (
+	ProxyNone   = "none"
+	ProxySystem = "system"
+	ProxyHTTP   = "http"
+	ProxySOCKS5 = "socks5"
+	ProxyPAC    = "pac"
+)
+
+// Proxy says how every request leaves the machine. URL is the proxy
+// address for http and socks5, and the script location for pac.
+type Proxy struct {
+	Mode string `json:"mode"`
+	URL  string `json:"url,omitempty"`
+	// Credentials names an entry in secrets.json holding the proxy login.
+	Credentials string `json:"credentials,omitempty"`
+}
+
+const (
+	SourceYulu      = "yulu"
+	SourceFolder    = "folder"
+	SourceJSON      = "json"
+	SourceBing      = "bing"
+	SourceFeed      = "feed"
+	SourceWebDAV    = "webdav"
+	SourceS3        = "s3"
+	SourcePlugin    = "plugin"
+	SourceGenerate  = "generate"
+	SourceOnThisDay = "onthisday"
+)
+
+const (
+	HintResolution  = "resolution"
+	HintScale       = "scale"
+	HintOrientation = "orientation"
+	HintLanguage    = "lang"
+	HintNone        = "none"
+)
+
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+)
+
+const (
+	OrderWeighted   = "weighted"
+	OrderRoundRobin = "round_robin"
+)
+
+// SourceConfig describes one place wallpapers come from. Name is what
+// day/night phases and rules refer to in their source field.
+type SourceConfig struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	Weight  int    `json:"weight,omitempty"`
+	URL     string `json:"url,omitempty"`
+
+	Dirs      []string `json:"dirs,omitempty"`
+	Recursive bool     `json:"recursive,omitempty"`
+	Include   []string `json:"include,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
+
+	Headers       map[string]string `json:"headers,omitempty"`
+	Query         string            `json:"query,omitempty"`
+	ImagePath     string            `json:"image_path,omitempty"`
+	TitlePath     string            `json:"title_path,omitempty"`
+	AuthorPath    string            `json:"author_path,omitempty"`
+	CopyrightPath string            `json:"copyright_path,omitempty"`
+
+	Resolution string `json:"resolution,omitempty"`
+
+	// Hints names the query parameters a yulu source adds so the server
+	// can tailor the image: resolution, scale, orientation and lang, or
+	// none. Empty sends all of them to the built-in endpoint and none to
+	// other URLs. Orientation and Language override what the system
+	// reports; Category and Tags are sent whenever set.
+	Hints       []string `json:"hints,omitempty"`
+	Orientation string   `json:"orientation,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Category    string   `json:"category,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	Bucket    string `json:"bucket,omitempty"`
+	Prefix    string `json:"prefix,omitempty"`
+	Region    string `json:"region,omitempty"`
+	PathStyle bool   `json:"path_style,omitempty"`
+
+	Command        string   `json:"command,omitempty"`
+	Args           []string `json:"args,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+
+	Style string `json:"style,omitempty"`
+	Seed  string `json:"seed,omitempty"`
+	// Quote draws a saying onto generated wallpapers.
+	Quote bool `json:"quote,omitempty"`
+
+	// Credentials names an entry in secrets.json.
+	Credentials string `json:"credentials,omitempty"`
+
+	CABundle      string   `json:"ca_bundle,omitempty"`
+	PinSHA256     []string `json:"pin_sha256,omitempty"`
+	PublicKey     string   `json:"public_key,omitempty"`
+	RequireDigest bool     `json:"require_digest,omitempty"`
+}
+
+// Rule applies its action while every condition in When holds. Rules are
+// checked in order and the first rule to set a field wins.
+type Rule struct {
+	Name string        `json:"name,omitempty"`
+	When RuleCondition `json:"when"`
+	Then RuleAction    `json:"then"`
+}
+
+type RuleCondition struct {
+	Weekdays    []string `json:"weekdays,omitempty"`
+	Time        string   `json:"time,omitempty"`
+	Power       string   `json:"power,omitempty"`
+	SSIDs       []string `json:"ssid,omitempty"`
+	MinMonitors int      `json:"min_monitors,omitempty"`
+	MaxMonitors int      `json:"max_monitors,omitempty"`
+}
+
+type RuleAction struct {
+	Source          string `json:"source,omitempty"`
+	Layout          Layout `json:"layout,omitempty"`
+	IntervalMinutes int    `json:"interval_minutes,omitempty"`
+	// Pause is nil when the rule says nothing about pausing, so that an
+	// earlier rule can also keep rotation going with false.
+	Pause *bool `json:"pause,omitempty"`
+}
+
+// Paused reports whether the action stops rotation.
+func (a RuleAction) Paused() bool {
+	return a.Pause != nil && *a.Pause
+}
+
+const (
+	PowerAC      = "ac"
+	PowerBattery = "battery"
+)
+
+// Festival prefers themed images on the 24 solar terms and traditional
+// festivals: first from ThemedDir/<name>, then from the endpoint with the
+// name passed in the Param query parameter.
+type Festival struct {
+	Enabled   bool   `json:"enabled"`
+	Param     string `json:"param,omitempty"`
+	ThemedDir string `json:"themed_dir,omitempty"`
+	Overlay   bool   `json:"overlay"`
+}
+
+type Location struct {
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// DayNight switches wallpaper settings at local dawn, sunrise, sunset and
+// dusk. Empty dawn settings fall back to day, empty dusk settings to night.
+type DayNight struct {
+	Enabled bool          `json:"enabled"`
+	Dawn    PhaseSettings `json:"dawn"`
+	Day     PhaseSettings `json:"day"`
+	Dusk    PhaseSettings `json:"dusk"`
+	Night   PhaseSettings `json:"night"`
+}
+
+type PhaseSettings struct {
+	Source string `json:"source,omitempty"`
+	Layout Layout `json:"layout,omitempty"`
+}
+
+func (dn DayNight) For(phase solar.Phase) PhaseSettings {
+	switch phase {
+	case solar.PhaseDawn:
+		return dn.Dawn.or(dn.Day)
+	case solar.PhaseDusk:
+		return dn.Dusk.or(dn.Night)
+	case solar.PhaseNight:
+		return dn.Night
+	default:
+		return dn.Day
+	}
+}
+
+func (ps PhaseSettings) or(fallback PhaseSettings) PhaseSettings {
+	if ps.Source == "" {
+		ps.Source = fallback.Source
+	}
+	if ps.Layout == "" {
+		ps.Layout = fallback.Layout
+	}
+	return ps
+}
+
+type City struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+var cityPresets = []City{
+	{Name: "北京", Latitude: 39.9042, Longitude: 116.4074},
+	{Name: "上海", Latitude: 31.2304, Longitude: 121.4737},
+	{Name: "广州", Latitude: 23.1291, Longitude: 113.2644},
+	{Name: "深圳", Latitude: 22.5431, Longitude: 114.0579},
+	{Name: "杭州", Latitude: 30.2741, Longitude: 120.1551},
+	{Name: "南京", Latitude: 32.0603, Longitude: 118.7969},
+	{Name: "成都", Latitude: 30.5728, Longitude: 104.0668},
+	{Name: "重庆", Latitude: 29.5630, Longitude: 106.5516},
+	{Name: "武汉", Latitude: 30.5928, Longitude: 114.3055},
+	{Name: "西安", Latitude: 34.3416, Longitude: 108.9398},
+	{Name: "天津", Latitude: 39.3434, Longitude: 117.3616},
+	{Name: "沈阳", Latitude: 41.8057, Longitude: 123.4315},
+	{Name: "哈尔滨", Latitude: 45.8038, Longitude: 126.5349},
+	{Name: "昆明", Latitude: 25.0389, Longitude: 102.7183},
+	{Name: "乌鲁木齐", Latitude: 43.8256, Longitude: 87.6168},
+	{Name: "拉萨", Latitude: 29.6500, Longitude: 91.1000},
+	{Name: "香港", Latitude: 22.3193, Longitude: 114.1694},
+	{Name: "台北", Latitude: 25.0330, Longitude: 121.5654},
+}
+
+func CityPresets() []City {
+	return cityPresets
+}
+
+func CityByName(name string) (City, bool) {
+	for _, city := range cityPresets {
+		if city.Name == name {
+			return city, true
+		}
+	}
+	return City{}, false
+}
+
+const (
+	MinIntervalMinutes = 1
+	MaxIntervalMinutes = 30 * 24 * 60
+)
+
+// UnmarshalJSON accepts interval_minutes either as a number of minutes or as
+// a Go duration string such as "90m" or "3h".
+func (cfg *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	aux := struct {
+		*plain
+		IntervalMinutes json.RawMessage `json:"interval_minutes"`
+	}{plain: (*plain)(cfg)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.IntervalMinutes) == 0 || string(aux.IntervalMinutes) == "null" {
+		return nil
+	}
+
+	var minutes int
+	var text string
+	var err error
+	if json.Unmarshal(aux.IntervalMinutes, &text) == nil {
+		minutes, err = ParseInterval(text)
+	} else {
+		err = json.Unmarshal(aux.IntervalMinutes, &minutes)
+	}
+	if err != nil {
+		log.Printf("config: invalid interval_minutes %s: %v", aux.IntervalMinutes, err)
+		minutes = 0
+	}
+	cfg.IntervalMinutes = minutes
+	return nil
 }
 
 type IntervalOption struct {
@@ -58,6 +392,39 @@ func IntervalLabel(minutes int) string {
 	return ""
 }
 
+// ParseInterval reads a plain number of minutes ("15") or a Go duration
+// string ("90m", "3h", "1h30m").
+func ParseInterval(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("empty interval")
+	}
+	if minutes, err := strconv.Atoi(value); err == nil {
+		return minutes, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d%time.Minute != 0 {
+		return 0, fmt.Errorf("interval %s is not a whole number of minutes", d)
+	}
+	return int(d / time.Minute), nil
+}
+
+func FormatInterval(minutes int) string {
+	if label := IntervalLabel(minutes); label != "" {
+		return label
+	}
+	if minutes >= 60 && minutes%60 == 0 {
+		return fmt.Sprintf("%dh", minutes/60)
+	}
+	if minutes > 60 {
+		return fmt.Sprintf("%dh%dm", minutes/60, minutes%60)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
 func IntervalDuration(minutes int) time.Duration {
 	return time.Duration(minutes) * time.Minute
 }
@@ -67,18 +434,86 @@ func Default() Config {
 		IntervalMinutes: 60,
 		Layout:          LayoutFill,
 		AutoStart:       false,
+		Location:        Location{City: "北京", Latitude: 39.9042, Longitude: 116.4074},
+		Festival:        Festival{Param: "category"},
+		Sources:         []SourceConfig{{Name: "yulu", Type: SourceYulu, Enabled: true, Weight: 1}},
+		SourceOrder:     OrderWeighted,
+		Proxy:           Proxy{Mode: ProxySystem},
+		Dedup:           Dedup{Recent: 10, Distance: 6, Days: 30},
+		Prefetch:        3,
+		Network:         Network{Metered: MeteredCache},
 	}
 }
 
 func Normalize(cfg Config) Config {
-	if !validInterval(cfg.IntervalMinutes) {
+	switch {
+	case cfg.IntervalMinutes == 0:
+		cfg.IntervalMinutes = Default().IntervalMinutes
+	case !validInterval(cfg.IntervalMinutes):
+		log.Printf("config: interval %d minutes outside %d-%d, using %d", cfg.IntervalMinutes, MinIntervalMinutes, MaxIntervalMinutes, Default().IntervalMinutes)
 		cfg.IntervalMinutes = Default().IntervalMinutes
 	}
-	switch cfg.Layout {
-	case LayoutTile, LayoutStretch, LayoutFit, LayoutFill, LayoutCenter:
+	cfg.Schedule = strings.TrimSpace(cfg.Schedule)
+	if cfg.Schedule != "" {
+		if _, err := schedule.Parse(cfg.Schedule); err != nil {
+			log.Printf("config: ignoring schedule %q: %v", cfg.Schedule, err)
+			cfg.Schedule = ""
+		}
+	}
+	switch {
+	case validLayout(cfg.Layout):
+	case cfg.Layout == "":
+		cfg.Layout = Default().Layout
 	default:
+		log.Printf("config: unknown layout %q, using %q", cfg.Layout, Default().Layout)
 		cfg.Layout = Default().Layout
 	}
+	cfg.Location = normalizeLocation(cfg.Location)
+	cfg.Festival.Param = strings.TrimSpace(cfg.Festival.Param)
+	if cfg.Festival.Param == "" {
+		cfg.Festival.Param = Default().Festival.Param
+	}
+	cfg.Festival.ThemedDir = strings.TrimSpace(cfg.Festival.ThemedDir)
+	cfg.Rules = normalizeRules(cfg.Rules)
+	cfg.Sources = normalizeSources(cfg.Sources)
+	switch cfg.SourceOrder {
+	case OrderWeighted, OrderRoundRobin:
+	case "":
+		cfg.SourceOrder = Default().SourceOrder
+	default:
+		log.Printf("config: unknown source_order %q, using %q", cfg.SourceOrder, Default().SourceOrder)
+		cfg.SourceOrder = Default().SourceOrder
+	}
+	cfg.Proxy = normalizeProxy(cfg.Proxy)
+	cfg.Dedup = normalizeDedup(cfg.Dedup)
+	switch {
+	case cfg.Prefetch == 0:
+		cfg.Prefetch = Default().Prefetch
+	case cfg.Prefetch < 0:
+		cfg.Prefetch = -1
+	case cfg.Prefetch > MaxPrefetch:
+		log.Printf("config: prefetch %d above %d, using %d", cfg.Prefetch, MaxPrefetch, MaxPrefetch)
+		cfg.Prefetch = MaxPrefetch
+	}
+	switch cfg.Network.Metered {
+	case MeteredCache, MeteredSkip, MeteredIgnore:
+	case "":
+		cfg.Network.Metered = Default().Network.Metered
+	default:
+		log.Printf("config: unknown metered policy %q, using %q", cfg.Network.Metered, Default().Network.Metered)
+		cfg.Network.Metered = Default().Network.Metered
+	}
+	if cfg.Network.DailyMB < 0 || cfg.Network.MonthlyMB < 0 {
+		log.Printf("config: negative bandwidth cap, treating it as no cap")
+		cfg.Network.DailyMB, cfg.Network.MonthlyMB = max(cfg.Network.DailyMB, 0), max(cfg.Network.MonthlyMB, 0)
+	}
+	for _, phase := range []*PhaseSettings{&cfg.DayNight.Dawn, &cfg.DayNight.Day, &cfg.DayNight.Dusk, &cfg.DayNight.Night} {
+		phase.Source = strings.TrimSpace(phase.Source)
+		if phase.Layout != "" && !validLayout(phase.Layout) {
+			log.Printf("config: unknown day/night layout %q, using the main layout", phase.Layout)
+			phase.Layout = ""
+		}
+	}
 	return cfg
 }
 
@@ -109,6 +544,23 @@ func AssetsDir() (string, error) {
 	return filepath.Join(dir, "assets"), nil
 }
 
+func StatePath() (string, error) {
+	dir, err := AppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// SecretsPath is where source credentials are kept, apart from config.json.
+func SecretsPath() (string, error) {
+	dir, err := AppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "secrets.json"), nil
+}
+
 func LogPath() (string, error) {
 	dir, err := AppDir()
 	if err != nil {
@@ -152,11 +604,294 @@ func Save(cfg Config) error {
 	return os.WriteFile(path, data, 0o644)
 }
 
-func validInterval(minutes int) bool {
-	for _, opt := range intervalOptions {
-		if opt.Minutes == minutes {
-			return true
+func normalizeLocation(loc Location) Location {
+	loc.City = strings.TrimSpace(loc.City)
+	if city, ok := CityByName(loc.City); ok {
+		loc.Latitude, loc.Longitude = city.Latitude, city.Longitude
+		return loc
+	}
+	if loc.Latitude < -90 || loc.Latitude > 90 || loc.Longitude < -180 || loc.Longitude > 180 {
+		log.Printf("config: location %.4f,%.4f out of range, using %s", loc.Latitude, loc.Longitude, Default().Location.City)
+		return Default().Location
+	}
+	if loc.City == "" && loc.Latitude == 0 && loc.Longitude == 0 {
+		return Default().Location
+	}
+	return loc
+}
+
+func normalizeProxy(proxy Proxy) Proxy {
+	proxy.Mode = strings.ToLower(strings.TrimSpace(proxy.Mode))
+	proxy.URL = strings.TrimSpace(proxy.URL)
+	proxy.Credentials = strings.TrimSpace(proxy.Credentials)
+	switch proxy.Mode {
+	case ProxyNone, ProxySystem:
+	case ProxyHTTP, ProxySOCKS5, ProxyPAC:
+		if proxy.URL == "" {
+			log.Printf("config: %s proxy has no url, using the system proxy", proxy.Mode)
+			proxy.Mode = ProxySystem
+		}
+	case "":
+		proxy.Mode = Default().Proxy.Mode
+	default:
+		log.Printf("config: unknown proxy mode %q, using %q", proxy.Mode, Default().Proxy.Mode)
+		proxy.Mode = Default().Proxy.Mode
+	}
+	return proxy
+}
+
+func normalizeDedup(dedup Dedup) Dedup {
+	if dedup.Recent <= 0 {
+		dedup.Recent = Default().Dedup.Recent
+	}
+	if dedup.Retries < 0 || dedup.Retries > MaxDedupRetries {
+		retries := min(max(dedup.Retries, 0), MaxDedupRetries)
+		log.Printf("config: dedup retries %d outside 0-%d, using %d", dedup.Retries, MaxDedupRetries, retries)
+		dedup.Retries = retries
+	}
+	if dedup.Distance == 0 {
+		dedup.Distance = Default().Dedup.Distance
+	}
+	if dedup.Distance > MaxDedupDistance {
+		log.Printf("config: dedup distance %d above %d, using %d", dedup.Distance, MaxDedupDistance, MaxDedupDistance)
+		dedup.Distance = MaxDedupDistance
+	}
+	if dedup.Days <= 0 {
+		dedup.Days = Default().Dedup.Days
+	}
+	return dedup
+}
+
+func normalizeSources(sources []SourceConfig) []SourceConfig {
+	if len(sources) == 0 {
+		return Default().Sources
+	}
+	normalized := make([]SourceConfig, 0, len(sources))
+	seen := make(map[string]bool, len(sources))
+	for i, src := range sources {
+		src.Name = strings.TrimSpace(src.Name)
+		src.Type = strings.ToLower(strings.TrimSpace(src.Type))
+		src.URL = strings.TrimSpace(src.URL)
+		if src.Type == "" {
+			src.Type = SourceYulu
+		}
+		if src.Name == "" {
+			src.Name = fmt.Sprintf("%s-%d", src.Type, i+1)
+		}
+		if seen[src.Name] {
+			log.Printf("config: duplicate source name %q, dropping the later one", src.Name)
+			continue
+		}
+		seen[src.Name] = true
+		if src.Weight < 0 {
+			log.Printf("config: source %s has negative weight %d, using 1", src.Name, src.Weight)
+			src.Weight = 1
+		}
+		if src.Weight == 0 {
+			src.Weight = 1
+		}
+		if kept, dropped := sourceFields(src); len(dropped) > 0 {
+			log.Printf("config: source %s of type %s does not use %s, ignoring them", src.Name, src.Type, strings.Join(dropped, ", "))
+			src = kept
 		}
+		if strings.HasPrefix(strings.ToLower(src.URL), "http://") {
+			log.Printf("config: source %s uses plain http, images can be tampered with in transit", src.Name)
+		}
+		normalized = append(normalized, src)
+	}
+	return normalized
+}
+
+// sourceFields returns src with only the fields its type reads, and the
+// JSON names of the fields that were set but dropped. Sources of an unknown
+// type are returned as they are; creating them fails later.
+func sourceFields(src SourceConfig) (SourceConfig, []string) {
+	kept := SourceConfig{Name: src.Name, Type: src.Type, Enabled: src.Enabled, Weight: src.Weight}
+	switch src.Type {
+	case SourceYulu:
+		kept.URL, kept.Resolution = src.URL, src.Resolution
+		kept.Hints, kept.Orientation, kept.Language, kept.Category, kept.Tags = src.Hints, src.Orientation, src.Language, src.Category, src.Tags
+		kept.PublicKey, kept.RequireDigest = src.PublicKey, src.RequireDigest
+	case SourceFolder, SourceOnThisDay:
+		kept.Dirs, kept.Recursive, kept.Include, kept.Exclude = src.Dirs, src.Recursive, src.Include, src.Exclude
+	case SourceJSON:
+		kept.URL, kept.Headers, kept.Query = src.URL, src.Headers, src.Query
+		kept.ImagePath, kept.TitlePath, kept.AuthorPath, kept.CopyrightPath = src.ImagePath, src.TitlePath, src.AuthorPath, src.CopyrightPath
+	case SourceBing:
+		kept.URL, kept.Resolution = src.URL, src.Resolution
+	case SourceFeed:
+		kept.URL = src.URL
+	case SourceWebDAV:
+		kept.URL, kept.Credentials = src.URL, src.Credentials
+		kept.Recursive, kept.Include, kept.Exclude = src.Recursive, src.Include, src.Exclude
+	case SourceS3:
+		kept.URL, kept.Credentials = src.URL, src.Credentials
+		kept.Bucket, kept.Prefix, kept.Region, kept.PathStyle = src.Bucket, src.Prefix, src.Region, src.PathStyle
+		kept.Include, kept.Exclude = src.Include, src.Exclude
+	case SourcePlugin:
+		kept.Command, kept.Args, kept.TimeoutSeconds = src.Command, src.Args, src.TimeoutSeconds
+	case SourceGenerate:
+		kept.Style, kept.Seed, kept.Quote, kept.Resolution = src.Style, src.Seed, src.Quote, src.Resolution
+	default:
+		return src, nil
+	}
+	switch src.Type {
+	case SourceFolder, SourceOnThisDay, SourceGenerate:
+	default:
+		// Everything else downloads over HTTPS.
+		kept.CABundle, kept.PinSHA256 = src.CABundle, src.PinSHA256
+	}
+	return kept, setFields(src, kept)
+}
+
+// setFields lists the JSON names of the fields set in src but not in kept.
+func setFields(src, kept SourceConfig) []string {
+	var all, left map[string]json.RawMessage
+	data, _ := json.Marshal(src)
+	json.Unmarshal(data, &all)
+	data, _ = json.Marshal(kept)
+	json.Unmarshal(data, &left)
+	var dropped []string
+	for name := range all {
+		if _, ok := left[name]; !ok {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+func normalizeRules(rules []Rule) []Rule {
+	valid := make([]Rule, 0, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if err := validateCondition(rule.When); err != nil {
+			log.Printf("config: dropping rule %s: %v", name, err)
+			continue
+		}
+		rule.Then.Source = strings.TrimSpace(rule.Then.Source)
+		if rule.Then.Layout != "" && !validLayout(rule.Then.Layout) {
+			log.Printf("config: rule %s: unknown layout %q ignored", name, rule.Then.Layout)
+			rule.Then.Layout = ""
+		}
+		if rule.Then.IntervalMinutes != 0 && !validInterval(rule.Then.IntervalMinutes) {
+			log.Printf("config: rule %s: interval %d minutes ignored", name, rule.Then.IntervalMinutes)
+			rule.Then.IntervalMinutes = 0
+		}
+		valid = append(valid, rule)
+	}
+	return valid
+}
+
+func validateCondition(cond RuleCondition) error {
+	if _, err := WeekdayMask(cond.Weekdays); err != nil {
+		return err
+	}
+	if cond.Time != "" {
+		if _, _, err := ParseTimeRange(cond.Time); err != nil {
+			return err
+		}
+	}
+	switch cond.Power {
+	case "", PowerAC, PowerBattery:
+	default:
+		return fmt.Errorf("unknown power source %q", cond.Power)
+	}
+	if cond.MaxMonitors != 0 && cond.MaxMonitors < cond.MinMonitors {
+		return fmt.Errorf("max_monitors %d is below min_monitors %d", cond.MaxMonitors, cond.MinMonitors)
+	}
+	return nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"周日": time.Sunday, "周一": time.Monday, "周二": time.Tuesday, "周三": time.Wednesday,
+	"周四": time.Thursday, "周五": time.Friday, "周六": time.Saturday,
+}
+
+// WeekdayMask returns a bit per weekday (bit 0 is Sunday). Entries are
+// English abbreviations ("mon"), Chinese names ("周一"), cron-style numbers
+// (0 or 7 for Sunday) or ranges of those ("mon-fri").
+func WeekdayMask(values []string) (uint8, error) {
+	var mask uint8
+	for _, value := range values {
+		from, to, isRange := strings.Cut(value, "-")
+		start, ok := parseWeekday(from)
+		if !ok {
+			return 0, fmt.Errorf("unknown weekday %q", value)
+		}
+		end := start
+		if isRange {
+			if end, ok = parseWeekday(to); !ok {
+				return 0, fmt.Errorf("unknown weekday %q", value)
+			}
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			mask |= 1 << uint(day)
+			if day == end {
+				break
+			}
+		}
+	}
+	return mask, nil
+}
+
+func parseWeekday(value string) (time.Weekday, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if day, ok := weekdayNames[value]; ok {
+		return day, true
+	}
+	if len(value) > 3 {
+		if day, ok := weekdayNames[value[:3]]; ok {
+			return day, true
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= 7 {
+		return time.Weekday(n % 7), true
+	}
+	return 0, false
+}
+
+// ParseTimeRange reads "09:00-18:00" into minutes after midnight. A range
+// whose end is before its start wraps past midnight.
+func ParseTimeRange(value string) (int, int, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time range %q", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func parseClock(value string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(value), ":")
+	hour, errH := strconv.Atoi(hh)
+	minute, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+func validLayout(layout Layout) bool {
+	switch layout {
+	case LayoutTile, LayoutStretch, LayoutFit, LayoutFill, LayoutCenter:
+		return true
 	}
 	return false
 }
+
+func validInterval(minutes int) bool {
+	return minutes >= MinIntervalMinutes && minutes <= MaxIntervalMinutes
+}
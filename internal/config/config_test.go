@@ -0,0 +1,70 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeSchedule(t *testing.T) {
+	for expr, want := range map[string]string{
+		" 0 9 * * 1-5 ": "0 9 * * 1-5",
+		"0 0 31 2 *":    "",
+		"not a cron":    "",
+	} {
+		if got := Normalize(Config{Schedule: expr}).Schedule; got != want {
+			t.Errorf("Normalize schedule %q = %q, want %q", expr, got, want)
+		}
+	}
+}
+
+func TestNormalizeSourceFields(t *testing.T) {
+	cfg := Normalize(Config{Sources: []SourceConfig{
+		{Name: "photos", Type: SourceFolder, Dirs: []string{"/photos"}, URL: "https://example.com", Style: "aurora", Weight: 2},
+		{Name: "art", Type: SourceGenerate, Style: "aurora", Quote: true, CABundle: "ca.pem"},
+		{Name: "api", Type: SourceJSON, URL: "https://example.com/api", ImagePath: "url", PinSHA256: []string{"pin"}, Bucket: "b"},
+		{Name: "odd", Type: "custom", Bucket: "b"},
+	}})
+	want := []SourceConfig{
+		{Name: "photos", Type: SourceFolder, Dirs: []string{"/photos"}, Weight: 2},
+		{Name: "art", Type: SourceGenerate, Style: "aurora", Quote: true, Weight: 1},
+		{Name: "api", Type: SourceJSON, URL: "https://example.com/api", ImagePath: "url", PinSHA256: []string{"pin"}, Weight: 1},
+		{Name: "odd", Type: "custom", Bucket: "b", Weight: 1},
+	}
+	if !reflect.DeepEqual(cfg.Sources, want) {
+		t.Errorf("Normalize sources =\n%+v\nwant\n%+v", cfg.Sources, want)
+	}
+}
+
+// TestSourceFieldsCoverEveryField makes sure a new SourceConfig field is
+// given to the types that read it rather than always dropped.
+func TestSourceFieldsCoverEveryField(t *testing.T) {
+	var full SourceConfig
+	v := reflect.ValueOf(&full).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString("x")
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int:
+			f.SetInt(1)
+		case reflect.Slice:
+			f.Set(reflect.ValueOf([]string{"x"}))
+		case reflect.Map:
+			f.Set(reflect.ValueOf(map[string]string{"x": "x"}))
+		default:
+			t.Fatalf("field %s has unhandled kind %s", v.Type().Field(i).Name, f.Kind())
+		}
+	}
+	types := []string{SourceYulu, SourceFolder, SourceJSON, SourceBing, SourceFeed, SourceWebDAV, SourceS3, SourcePlugin, SourceGenerate, SourceOnThisDay}
+	unused := setFields(full, SourceConfig{})
+	for _, typ := range types {
+		full.Type = typ
+		_, dropped := sourceFields(full)
+		unused = slices.DeleteFunc(unused, func(name string) bool { return !slices.Contains(dropped, name) })
+	}
+	if len(unused) > 0 {
+		t.Errorf("no source type uses %v", unused)
+	}
+}
@@ -0,0 +1,179 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	tagOrientation      = 0x0112
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+
+	typeShort = 3
+	typeLong  = 4
+)
+
+var ErrNoExif = errors.New("no exif data")
+
+// Info is the little a wallpaper needs from a photo's EXIF data.
+type Info struct {
+	// Taken is DateTimeOriginal in local time, zero when missing.
+	Taken time.Time
+	// Orientation is the EXIF orientation, 1 (upright) when missing.
+	Orientation int
+}
+
+// Read extracts Info from a JPEG stream. It stops at the start of the
+// image data, so only the headers are read.
+func Read(r io.Reader) (Info, error) {
+	info := Info{Orientation: 1}
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return info, ErrNoExif
+	}
+	for {
+		marker, err := nextMarker(br)
+		if err != nil {
+			return info, ErrNoExif
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return info, ErrNoExif
+		}
+		var length uint16
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil || length < 2 {
+			return info, ErrNoExif
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return info, ErrNoExif
+		}
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseTIFF(segment[6:])
+		}
+	}
+}
+
+func nextMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, ErrNoExif
+	}
+	for b == 0xFF {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+func parseTIFF(data []byte) (Info, error) {
+	info := Info{Orientation: 1}
+	if len(data) < 8 {
+		return info, ErrNoExif
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info, ErrNoExif
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return info, ErrNoExif
+	}
+
+	exifOffset := uint32(0)
+	walkIFD(data, order, order.Uint32(data[4:]), func(tag, typ uint16, count uint32, value []byte) {
+		switch {
+		case tag == tagOrientation && typ == typeShort:
+			if o := int(order.Uint16(value)); o >= 1 && o <= 8 {
+				info.Orientation = o
+			}
+		case tag == tagExifIFD && typ == typeLong:
+			exifOffset = order.Uint32(value)
+		}
+	})
+	if exifOffset != 0 {
+		walkIFD(data, order, exifOffset, func(tag, typ uint16, count uint32, value []byte) {
+			if tag != tagDateTimeOriginal || count < 19 {
+				return
+			}
+			offset := order.Uint32(value)
+			if uint64(offset)+19 > uint64(len(data)) {
+				return
+			}
+			raw := strings.TrimRight(string(data[offset:offset+19]), "\x00 ")
+			if t, err := time.ParseInLocation("2006:01:02 15:04:05", raw, time.Local); err == nil {
+				info.Taken = t
+			}
+		})
+	}
+	return info, nil
+}
+
+// walkIFD calls fn for every entry of the IFD at offset. value is the raw
+// 4-byte value field, which holds either the value or its offset.
+func walkIFD(data []byte, order binary.ByteOrder, offset uint32, fn func(tag, typ uint16, count uint32, value []byte)) {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return
+	}
+	n := int(order.Uint16(data[offset:]))
+	for i := 0; i < n; i++ {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(data)) {
+			return
+		}
+		entry := data[start : start+12]
+		fn(order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:]), entry[8:12])
+	}
+}
+
+// Orient returns img turned upright according to an EXIF orientation.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	outW, outH := w, h
+	if orientation >= 5 {
+		outW, outH = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, outW, outH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+	"time"
+)
+
+// tiffBlock builds EXIF data with an Orientation in IFD0 and, unless
+// taken is empty, a DateTimeOriginal in the Exif IFD.
+func tiffBlock(order binary.ByteOrder, orientation int, taken string) []byte {
+	const ifd0, exifIFD, text = 8, 38, 56
+	data := make([]byte, text+20)
+	if order == binary.LittleEndian {
+		copy(data, "II")
+	} else {
+		copy(data, "MM")
+	}
+	order.PutUint16(data[2:], 42)
+	order.PutUint32(data[4:], ifd0)
+
+	entry := func(at int, tag, typ uint16, count, value uint32) {
+		order.PutUint16(data[at:], tag)
+		order.PutUint16(data[at+2:], typ)
+		order.PutUint32(data[at+4:], count)
+		if typ == typeShort {
+			order.PutUint16(data[at+8:], uint16(value))
+		} else {
+			order.PutUint32(data[at+8:], value)
+		}
+	}
+	order.PutUint16(data[ifd0:], 2)
+	entry(ifd0+2, tagOrientation, typeShort, 1, uint32(orientation))
+	entry(ifd0+14, tagExifIFD, typeLong, 1, exifIFD)
+	if taken != "" {
+		order.PutUint16(data[exifIFD:], 1)
+		entry(exifIFD+2, tagDateTimeOriginal, 2, 20, text)
+		copy(data[text:], taken)
+	}
+	return data
+}
+
+// withExif inserts an APP1 segment holding tiff right after the SOI
+// marker of a JPEG.
+func withExif(jpg, tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func plainJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	jpg := plainJPEG(t)
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		orientation int
+		taken       time.Time
+	}{
+		{"little endian", withExif(jpg, tiffBlock(binary.LittleEndian, 6, "2019:07:04 18:30:05")), 6, time.Date(2019, 7, 4, 18, 30, 5, 0, time.Local)},
+		{"big endian", withExif(jpg, tiffBlock(binary.BigEndian, 8, "2001:12:31 00:00:00")), 8, time.Date(2001, 12, 31, 0, 0, 0, 0, time.Local)},
+		{"no date", withExif(jpg, tiffBlock(binary.BigEndian, 3, "")), 3, time.Time{}},
+		{"unreadable date", withExif(jpg, tiffBlock(binary.LittleEndian, 1, "    :  :     :  :  ")), 1, time.Time{}},
+		{"orientation out of range", withExif(jpg, tiffBlock(binary.LittleEndian, 9, "")), 1, time.Time{}},
+	} {
+		info, err := Read(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if info.Orientation != tc.orientation || !info.Taken.Equal(tc.taken) {
+			t.Errorf("%s: %+v, want orientation %d taken %s", tc.name, info, tc.orientation, tc.taken)
+		}
+	}
+}
+
+func TestReadWithoutExif(t *testing.T) {
+	jpg := plainJPEG(t)
+	for name, data := range map[string][]byte{
+		"plain JPEG":     jpg,
+		"not a JPEG":     []byte("\x89PNG\r\n\x1a\n"),
+		"empty":          nil,
+		"truncated":      withExif(jpg, tiffBlock(binary.LittleEndian, 6, ""))[:20],
+		"bad byte order": withExif(jpg, append([]byte("XX"), tiffBlock(binary.LittleEndian, 6, "")[2:]...)),
+	} {
+		info, err := Read(bytes.NewReader(data))
+		if !errors.Is(err, ErrNoExif) || info.Orientation != 1 {
+			t.Errorf("%s: %+v, %v; want upright and ErrNoExif", name, info, err)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image with a marked top-left pixel, as stored by a camera.
+	red := color.RGBA{255, 0, 0, 255}
+	stored := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	stored.Set(0, 0, red)
+
+	for _, tc := range []struct {
+		orientation int
+		w, h        int
+		// corner is where the stored top-left pixel ends up.
+		corner image.Point
+	}{
+		{1, 3, 2, image.Pt(0, 0)},
+		{3, 3, 2, image.Pt(2, 1)},
+		{6, 2, 3, image.Pt(1, 0)}, // rotate 90° clockwise
+		{8, 2, 3, image.Pt(0, 2)}, // rotate 90° counter-clockwise
+	} {
+		out := Orient(stored, tc.orientation)
+		if b := out.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h {
+			t.Errorf("orientation %d: %dx%d, want %dx%d", tc.orientation, b.Dx(), b.Dy(), tc.w, tc.h)
+			continue
+		}
+		if got := color.RGBAModel.Convert(out.At(tc.corner.X, tc.corner.Y)); got != red {
+			t.Errorf("orientation %d: %v at %v, want the marked pixel", tc.orientation, got, tc.corner)
+		}
+	}
+}
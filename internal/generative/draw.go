@@ -0,0 +1,265 @@
+package generative
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+	"math/rand"
+	"sort"
+)
+
+// Drawing uses 16.16 fixed-point numbers instead of floats: compilers may
+// fuse float multiplies and adds on some architectures, and math functions
+// have per-architecture assembly, either of which would change pixels.
+// Integer arithmetic gives the same image everywhere.
+const (
+	fracBits = 16
+	one      = 1 << fracBits
+)
+
+// point is a position in 16.16 pixels.
+type point struct {
+	x, y int64
+}
+
+func fillVertical(img *image.RGBA, top, bottom color.RGBA) {
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		c := mix(top, bottom, int64(y)*one/int64(max(b.Dy()-1, 1)))
+		for x := 0; x < b.Dx(); x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+func fillCircle(img *image.RGBA, cx, cy, r int64, c color.RGBA) {
+	b := img.Bounds()
+	y0, y1 := max(floorDiv(cy-r, one), 0), min(floorDiv(cy+r, one)+1, int64(b.Dy()))
+	for y := y0; y < y1; y++ {
+		dy := y*one + one/2 - cy
+		half := isqrt(max(r*r-dy*dy, 0))
+		blendSpan(img, int(y), cx-half, cx+half, c)
+	}
+}
+
+// fillPolygon fills a convex or concave polygon with even-odd scanlines,
+// sampling at pixel centres so shared edges neither overlap nor gap.
+func fillPolygon(img *image.RGBA, pts []point, c color.RGBA) {
+	b := img.Bounds()
+	minY, maxY := pts[0].y, pts[0].y
+	for _, p := range pts[1:] {
+		minY, maxY = min(minY, p.y), max(maxY, p.y)
+	}
+	y0, y1 := max(floorDiv(minY, one), 0), min(ceilDiv(maxY, one), int64(b.Dy()))
+	var xs []int64
+	for y := y0; y < y1; y++ {
+		sy := y*one + one/2
+		xs = xs[:0]
+		for i, p := range pts {
+			q := pts[(i+1)%len(pts)]
+			if (p.y <= sy) == (q.y <= sy) {
+				continue
+			}
+			xs = append(xs, p.x+floorDiv((sy-p.y)*(q.x-p.x), q.y-p.y))
+		}
+		sort.Slice(xs, func(i, j int) bool { return xs[i] < xs[j] })
+		for i := 0; i+1 < len(xs); i += 2 {
+			blendSpan(img, int(y), xs[i], xs[i+1], c)
+		}
+	}
+}
+
+// blendSpan paints the pixels of row y whose centres lie in [from, to).
+func blendSpan(img *image.RGBA, y int, from, to int64, c color.RGBA) {
+	b := img.Bounds()
+	x0 := int(max(ceilDiv(from-one/2, one), 0))
+	x1 := int(min(ceilDiv(to-one/2, one), int64(b.Dx())))
+	for x := x0; x < x1; x++ {
+		if c.A == 255 {
+			img.SetRGBA(x, y, c)
+			continue
+		}
+		img.SetRGBA(x, y, mix(img.RGBAAt(x, y), color.RGBA{R: c.R, G: c.G, B: c.B, A: 255}, divRound(int64(c.A)*one, 255)))
+	}
+}
+
+// valueNoise is lattice value noise with smoothstep interpolation.
+type valueNoise struct {
+	perm   [512]int
+	values [256]int64
+}
+
+func newValueNoise(rng *rand.Rand) *valueNoise {
+	n := &valueNoise{}
+	for i := range n.values {
+		n.values[i] = rng.Int63n(one)
+	}
+	p := rng.Perm(256)
+	for i := range n.perm {
+		n.perm[i] = p[i&255]
+	}
+	return n
+}
+
+func (n *valueNoise) lattice(x, y int64) int64 {
+	return n.values[n.perm[n.perm[x&255]+int(y&255)]]
+}
+
+// at samples the noise at 16.16 coordinates, giving a value in [0, one).
+func (n *valueNoise) at(x, y int64) int64 {
+	ix, iy := x>>fracBits, y>>fracBits
+	fx, fy := smooth(x&(one-1)), smooth(y&(one-1))
+	top := lerp(n.lattice(ix, iy), n.lattice(ix+1, iy), fx)
+	bottom := lerp(n.lattice(ix, iy+1), n.lattice(ix+1, iy+1), fx)
+	return lerp(top, bottom, fy)
+}
+
+// fbm sums octaves of noise, each at half the weight of the one before,
+// into a value in [0, one).
+func (n *valueNoise) fbm(x, y int64, octaves int) int64 {
+	var sum, norm int64
+	for i := 0; i < octaves; i++ {
+		weight := int64(1) << (octaves - 1 - i)
+		sum += weight * n.at(x, y)
+		norm += weight
+		x, y = x*2, y*2
+	}
+	return divRound(sum, norm)
+}
+
+// mix blends a towards b by t in [0, one].
+func mix(a, b color.RGBA, t int64) color.RGBA {
+	t = clamp(t, 0, one)
+	return color.RGBA{
+		R: uint8(lerp(int64(a.R), int64(b.R), t)),
+		G: uint8(lerp(int64(a.G), int64(b.G), t)),
+		B: uint8(lerp(int64(a.B), int64(b.B), t)),
+		A: 255,
+	}
+}
+
+// shade scales c by f/1024.
+func shade(c color.RGBA, f int64) color.RGBA {
+	return color.RGBA{
+		R: uint8(clamp(divRound(int64(c.R)*f, 1024), 0, 255)),
+		G: uint8(clamp(divRound(int64(c.G)*f, 1024), 0, 255)),
+		B: uint8(clamp(divRound(int64(c.B)*f, 1024), 0, 255)),
+		A: 255,
+	}
+}
+
+// hsl converts a hue in degrees and saturation and lightness in thousandths
+// to RGB.
+func hsl(h, s, l int64) color.RGBA {
+	c := divRound((1000-abs(2*l-1000))*s, 1000)
+	x := divRound(c*(1000-abs(h*1000/60%2000-1000)), 1000)
+	m := l - c/2
+	var r, g, b int64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.RGBA{
+		R: uint8(clamp(divRound((r+m)*255, 1000), 0, 255)),
+		G: uint8(clamp(divRound((g+m)*255, 1000), 0, 255)),
+		B: uint8(clamp(divRound((b+m)*255, 1000), 0, 255)),
+		A: 255,
+	}
+}
+
+// sinTable holds sin(d°) in 16.16 for d in [0, 90].
+var sinTable = [91]int64{
+	0, 1144, 2287, 3430, 4572, 5712, 6850, 7987, 9121, 10252,
+	11380, 12505, 13626, 14742, 15855, 16962, 18064, 19161, 20252, 21336,
+	22415, 23486, 24550, 25607, 26656, 27697, 28729, 29753, 30767, 31772,
+	32768, 33754, 34729, 35693, 36647, 37590, 38521, 39441, 40348, 41243,
+	42126, 42995, 43852, 44695, 45525, 46341, 47143, 47930, 48703, 49461,
+	50203, 50931, 51643, 52339, 53020, 53684, 54332, 54963, 55578, 56175,
+	56756, 57319, 57865, 58393, 58903, 59396, 59870, 60326, 60764, 61183,
+	61584, 61966, 62328, 62672, 62997, 63303, 63589, 63856, 64104, 64332,
+	64540, 64729, 64898, 65048, 65177, 65287, 65376, 65446, 65496, 65526,
+	65536,
+}
+
+// direction returns the unit vector at deg degrees in 16.16.
+func direction(deg int) (int64, int64) {
+	return sinDeg(deg + 90), sinDeg(deg)
+}
+
+func sinDeg(deg int) int64 {
+	deg = (deg%360 + 360) % 360
+	switch {
+	case deg <= 90:
+		return sinTable[deg]
+	case deg <= 180:
+		return sinTable[180-deg]
+	case deg <= 270:
+		return -sinTable[deg-180]
+	default:
+		return -sinTable[360-deg]
+	}
+}
+
+// smooth is smoothstep on [0, one].
+func smooth(t int64) int64 {
+	return (t * t >> fracBits) * (3*one - 2*t) >> fracBits
+}
+
+// lerp moves from a towards b by t/one, rounding to nearest.
+func lerp(a, b, t int64) int64 {
+	return a + divRound((b-a)*t, one)
+}
+
+// isqrt returns the floor of the square root of n.
+func isqrt(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	u := uint64(n)
+	x := uint64(1) << ((bits.Len64(u) + 1) / 2)
+	for {
+		y := (x + u/x) / 2
+		if y >= x {
+			return int64(x)
+		}
+		x = y
+	}
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int64) int64 {
+	return -floorDiv(-a, b)
+}
+
+// divRound divides by a positive b, rounding halves up.
+func divRound(a, b int64) int64 {
+	return floorDiv(2*a+b, 2*b)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func clamp(v, lo, hi int64) int64 {
+	return max(lo, min(hi, v))
+}
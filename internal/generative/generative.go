@@ -0,0 +1,180 @@
+package generative
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"math/rand"
+)
+
+const (
+	StyleGradient  = "gradient"
+	StyleNoise     = "noise"
+	StyleGeometric = "geometric"
+	StyleLowPoly   = "lowpoly"
+)
+
+var Styles = []string{StyleGradient, StyleNoise, StyleGeometric, StyleLowPoly}
+
+// Render draws a wallpaper of the given style and size. Everything random
+// is drawn from the seed, so the same arguments always give the same
+// pixels. An empty style picks one from the seed.
+func Render(style, seed string, width, height int) (image.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+	rng := rand.New(rand.NewSource(seedValue(seed)))
+	if style == "" {
+		style = Styles[rng.Intn(len(Styles))]
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	pal := newPalette(rng)
+	switch style {
+	case StyleGradient:
+		drawGradient(img, rng, pal)
+	case StyleNoise:
+		drawNoise(img, rng, pal)
+	case StyleGeometric:
+		drawGeometric(img, rng, pal)
+	case StyleLowPoly:
+		drawLowPoly(img, rng, pal)
+	default:
+		return nil, fmt.Errorf("unknown style %q", style)
+	}
+	return img, nil
+}
+
+func seedValue(seed string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return int64(h.Sum64())
+}
+
+// palette is a few harmonious colors around a random base hue.
+type palette []color.RGBA
+
+func newPalette(rng *rand.Rand) palette {
+	hue := int64(rng.Intn(360))
+	spread := int64(20 + rng.Intn(41))
+	pal := make(palette, 4)
+	for i := range pal {
+		h := (hue + int64(i)*spread) % 360
+		s := int64(450 + rng.Intn(351))
+		l := int64(250 + i*120 + rng.Intn(81))
+		pal[i] = hsl(h, s, l)
+	}
+	return pal
+}
+
+// at maps t in [0, one] onto the palette, blending neighbouring colors.
+func (pal palette) at(t int64) color.RGBA {
+	t = clamp(t, 0, one) * int64(len(pal)-1)
+	i := int(t >> fracBits)
+	if i >= len(pal)-1 {
+		return pal[len(pal)-1]
+	}
+	return mix(pal[i], pal[i+1], t&(one-1))
+}
+
+func drawGradient(img *image.RGBA, rng *rand.Rand, pal palette) {
+	b := img.Bounds()
+	dx, dy := direction(rng.Intn(360))
+	w, h := int64(b.Dx()), int64(b.Dy())
+	span := abs(dx)*w + abs(dy)*h
+	cx, cy := w*int64(300+rng.Intn(401))/1000, h*int64(300+rng.Intn(401))/1000
+	diag := max(isqrt(w*w+h*h), 1)
+	for y := int64(0); y < h; y++ {
+		for x := int64(0); x < w; x++ {
+			// Offsets from the centre, in half pixels.
+			fx, fy := 2*x-w, 2*y-h
+			t := divRound((fx*dx+fy*dy)*one, 2*span) + one/2
+			c := pal.at(t)
+			dist := isqrt((x-cx)*(x-cx) + (y-cy)*(y-cy))
+			img.SetRGBA(int(x), int(y), shade(c, 870+256*(diag-dist)/diag))
+		}
+	}
+}
+
+func drawNoise(img *image.RGBA, rng *rand.Rand, pal palette) {
+	b := img.Bounds()
+	n := newValueNoise(rng)
+	scale := 3*one + rng.Int63n(3*one)
+	size := int64(max(b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			u, v := int64(x)*scale/size, int64(y)*scale/size
+			// Warp the domain with a second sample for flowing shapes.
+			w := n.fbm(u+one*52/10, v+one*13/10, 3)
+			t := n.fbm(u+2*w, v+2*w, 5)
+			img.SetRGBA(x, y, pal.at(t))
+		}
+	}
+}
+
+func drawGeometric(img *image.RGBA, rng *rand.Rand, pal palette) {
+	b := img.Bounds()
+	fillVertical(img, pal[0], pal[1])
+	w, h := int64(b.Dx())*one, int64(b.Dy())*one
+	unit := min(w, h)
+	count := 12 + rng.Intn(12)
+	for i := 0; i < count; i++ {
+		c := pal[rng.Intn(len(pal))]
+		c.A = uint8(60 + rng.Intn(100))
+		x, y := rng.Int63n(w), rng.Int63n(h)
+		size := unit * int64(50+rng.Intn(301)) / 1000
+		switch rng.Intn(3) {
+		case 0:
+			fillCircle(img, x, y, size/2, c)
+		case 1:
+			fillPolygon(img, []point{{x, y}, {x + size, y}, {x + size, y + size}, {x, y + size}}, c)
+		default:
+			fillPolygon(img, []point{{x, y - size/2}, {x + size/2, y + size/2}, {x - size/2, y + size/2}}, c)
+		}
+	}
+}
+
+func drawLowPoly(img *image.RGBA, rng *rand.Rand, pal palette) {
+	b := img.Bounds()
+	cols := int64(8 + rng.Intn(6))
+	w, h := int64(b.Dx()), int64(b.Dy())
+	rows := max(ceilDiv(h*cols, w), 1)
+	cellW, cellH := w*one/cols, h*one/rows
+
+	grid := make([][]point, rows+1)
+	for r := range grid {
+		grid[r] = make([]point, cols+1)
+		for c := range grid[r] {
+			// Computed from the whole size so the last row and column
+			// reach the edges exactly.
+			p := point{int64(c) * w * one / cols, int64(r) * h * one / rows}
+			if r > 0 && int64(r) < rows {
+				p.y += int64(rng.Intn(801)-400) * cellH / 1000
+			}
+			if c > 0 && int64(c) < cols {
+				p.x += int64(rng.Intn(801)-400) * cellW / 1000
+			}
+			grid[r][c] = p
+		}
+	}
+
+	dx, dy := direction(rng.Intn(360))
+	span := abs(dx)*w + abs(dy)*h
+	colorAt := func(tri []point) color.RGBA {
+		cx := (tri[0].x + tri[1].x + tri[2].x) / 3
+		cy := (tri[0].y + tri[1].y + tri[2].y) / 3
+		t := divRound((cx-w*one/2)*dx+(cy-h*one/2)*dy, span) + one/2
+		return shade(pal.at(t), int64(922+rng.Intn(205)))
+	}
+	for r := int64(0); r < rows; r++ {
+		for c := int64(0); c < cols; c++ {
+			a, b, cc, d := grid[r][c], grid[r][c+1], grid[r+1][c+1], grid[r+1][c]
+			first, second := []point{a, b, cc}, []point{a, cc, d}
+			if rng.Intn(2) == 0 {
+				first, second = []point{a, b, d}, []point{b, cc, d}
+			}
+			fillPolygon(img, first, colorAt(first))
+			fillPolygon(img, second, colorAt(second))
+		}
+	}
+}
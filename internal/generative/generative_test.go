@@ -0,0 +1,137 @@
+package generative
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/render.sha256")
+
+// goldenCases cover every style, an odd size, and a seed that picks the
+// style itself.
+var goldenCases = []struct {
+	style, seed   string
+	width, height int
+}{
+	{StyleGradient, "2024-02-10", 160, 90},
+	{StyleNoise, "2024-02-10", 160, 90},
+	{StyleGeometric, "2024-02-10", 160, 90},
+	{StyleLowPoly, "2024-02-10", 160, 90},
+	{StyleLowPoly, "golden", 97, 203},
+	{"", "golden", 120, 80},
+}
+
+// TestRenderGolden checks the pixels against hashes recorded on one
+// machine. Rendering uses integer arithmetic only, so the hashes must match
+// on every GOARCH; run with -update after changing how styles are drawn.
+func TestRenderGolden(t *testing.T) {
+	path := filepath.Join("testdata", "render.sha256")
+	got := make(map[string]string)
+	var names []string
+	for _, tc := range goldenCases {
+		img, err := Render(tc.style, tc.seed, tc.width, tc.height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := fmt.Sprintf("%s/%s/%dx%d", tc.style, tc.seed, tc.width, tc.height)
+		if tc.style == "" {
+			name = fmt.Sprintf("random/%s/%dx%d", tc.seed, tc.width, tc.height)
+		}
+		sum := sha256.Sum256(img.(*image.RGBA).Pix)
+		got[name] = hex.EncodeToString(sum[:])
+		names = append(names, name)
+	}
+
+	if *update {
+		var b strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&b, "%s  %s\n", got[name], name)
+		}
+		if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if sum, name, ok := strings.Cut(scanner.Text(), "  "); ok {
+			want[name] = sum
+		}
+	}
+	for _, name := range names {
+		if got[name] != want[name] {
+			t.Errorf("%s: sha256 %s, want %s", name, got[name], want[name])
+		}
+	}
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	for _, style := range Styles {
+		a, err := Render(style, "seed", 64, 48)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := Render(style, "seed", 64, 48)
+		c, _ := Render(style, "other", 64, 48)
+		if string(a.(*image.RGBA).Pix) != string(b.(*image.RGBA).Pix) {
+			t.Errorf("%s: same seed gave different pixels", style)
+		}
+		if string(a.(*image.RGBA).Pix) == string(c.(*image.RGBA).Pix) {
+			t.Errorf("%s: different seeds gave the same pixels", style)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	if _, err := Render(StyleNoise, "x", 0, 10); err == nil {
+		t.Error("zero width accepted")
+	}
+	if _, err := Render("plaid", "x", 10, 10); err == nil {
+		t.Error("unknown style accepted")
+	}
+}
+
+func TestFixedPoint(t *testing.T) {
+	for _, n := range []int64{0, 1, 2, 3, 4, 15, 16, 17, 1 << 40, 1<<40 - 1, 1<<62 + 12345} {
+		r := isqrt(n)
+		if r*r > n || (r+1)*(r+1) <= n {
+			t.Errorf("isqrt(%d) = %d", n, r)
+		}
+	}
+	for _, tc := range []struct{ a, b, floor, ceil, round int64 }{
+		{7, 2, 3, 4, 4},
+		{-7, 2, -4, -3, -3},
+		{6, 3, 2, 2, 2},
+		{-1, 4, -1, 0, 0},
+	} {
+		if got := floorDiv(tc.a, tc.b); got != tc.floor {
+			t.Errorf("floorDiv(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.floor)
+		}
+		if got := ceilDiv(tc.a, tc.b); got != tc.ceil {
+			t.Errorf("ceilDiv(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.ceil)
+		}
+		if got := divRound(tc.a, tc.b); got != tc.round {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.round)
+		}
+	}
+	for deg, want := range map[int][2]int64{0: {one, 0}, 90: {0, one}, 180: {-one, 0}, 270: {0, -one}, 360: {one, 0}, -90: {0, -one}} {
+		if dx, dy := direction(deg); dx != want[0] || dy != want[1] {
+			t.Errorf("direction(%d) = %d, %d, want %v", deg, dx, dy, want)
+		}
+	}
+}
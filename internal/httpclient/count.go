@@ -0,0 +1,52 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Counting returns a copy of client that reports how many body bytes each
+// response delivered to add, once the body is closed.
+func Counting(client *http.Client, add func(n int64)) *http.Client {
+	counted := *client
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	counted.Transport = &countingTransport{base: base, add: add}
+	return &counted
+}
+
+type countingTransport struct {
+	base http.RoundTripper
+	add  func(n int64)
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, add: t.add}
+	return resp, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	add  func(n int64)
+	n    int64
+	once sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.add(b.n) })
+	return err
+}
@@ -0,0 +1,227 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// headerTimeout bounds the wait for a response to start. The caller's
+	// context bounds everything else, including the body and retries.
+	headerTimeout = 30 * time.Second
+
+	maxAttempts = 3
+	baseDelay   = 500 * time.Millisecond
+	maxDelay    = 10 * time.Second
+
+	// maxRetryAfter is the longest Retry-After honored inside one request.
+	// Longer waits are returned as a RetryAfterError for the service's
+	// retry schedule to honor.
+	maxRetryAfter = time.Minute
+)
+
+// Options configures a client from New.
+type Options struct {
+	Proxy ProxyOptions
+	TLS   TLSOptions
+}
+
+// New returns a client for sources. It retries idempotent requests on
+// network errors, 429 and 5xx responses with exponential backoff and
+// jitter, and honors Retry-After.
+func New(opts Options) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.ResponseHeaderTimeout = headerTimeout
+	proxy, err := newProxyFunc(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	base.Proxy = proxy
+	if base.TLSClientConfig, err = tlsConfig(opts.TLS); err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: &Transport{Base: base}}, nil
+}
+
+// Transport adds retries to Base. A 429 or 503 response that still asks
+// the caller to wait is turned into a RetryAfterError.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RetryAfterError reports a server asking, through Retry-After, not to be
+// asked again for a while.
+type RetryAfterError struct {
+	Status string
+	After  time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Status, e.After)
+}
+
+// RetryAfterOf returns the wait a RetryAfterError in err's chain asks for.
+func RetryAfterOf(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return retryErr.After, true
+	}
+	return 0, false
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if after, ok := RetryAfter(resp, time.Now()); ok {
+		_, _ = io.CopyN(io.Discard, resp.Body, 4<<10)
+		resp.Body.Close()
+		return nil, &RetryAfterError{Status: resp.Status, After: after}
+	}
+	return resp, nil
+}
+
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if !retryable(req) {
+		return t.Base.RoundTrip(req)
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := t.Base.RoundTrip(req)
+		if attempt >= maxAttempts || req.Context().Err() != nil || permanent(err) {
+			return resp, err
+		}
+		var wait time.Duration
+		switch {
+		case err != nil:
+			wait = backoff(attempt)
+		case retryStatus(resp.StatusCode):
+			wait = backoff(attempt)
+			if after, ok := RetryAfter(resp, time.Now()); ok {
+				if after > maxRetryAfter {
+					return resp, nil
+				}
+				wait = after
+			}
+		default:
+			return resp, nil
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("http: %s %s failed, retrying in %s: %v", req.Method, req.URL.Redacted(), wait.Round(time.Millisecond), err)
+		} else {
+			log.Printf("http: %s %s returned %s, retrying in %s", req.Method, req.URL.Redacted(), resp.Status, wait.Round(time.Millisecond))
+			_, _ = io.CopyN(io.Discard, resp.Body, 4<<10)
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether req can safely be sent again.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// permanent reports errors that another attempt cannot fix, such as a
+// certificate that fails verification.
+func permanent(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &verifyErr) || errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) || errors.As(err, &invalid) || errors.Is(err, errPinMismatch)
+}
+
+func retryStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next := req.Clone(req.Context())
+	next.Body = body
+	return next, nil
+}
+
+// backoff is full-jitter exponential backoff: a random wait up to
+// baseDelay·2^(attempt-1), capped at maxDelay.
+func backoff(attempt int) time.Duration {
+	limit := baseDelay << (attempt - 1)
+	if limit > maxDelay || limit <= 0 {
+		limit = maxDelay
+	}
+	return time.Duration(rand.Int63n(int64(limit))) + time.Millisecond
+}
+
+// RetryAfter reads the Retry-After header of a 429 or 503 response, given
+// either in seconds or as an HTTP date.
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLongRetryAfterIsReturned(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	client, err := New(Options{Proxy: ProxyOptions{Mode: "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("got a response, want a RetryAfterError")
+	}
+	after, ok := RetryAfterOf(fmt.Errorf("source: %w", err))
+	if !ok || after != time.Hour {
+		t.Errorf("RetryAfterOf = %s, %t, want 1h0m0s, true", after, ok)
+	}
+	if requests != 1 {
+		t.Errorf("server saw %d requests, want 1", requests)
+	}
+}
+
+func TestShortRetryAfterIsWaitedOut(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+	client, err := New(Options{Proxy: ProxyOptions{Mode: "none"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Errorf("status %d after %d requests, want 200 after 2", resp.StatusCode, requests)
+	}
+	if _, ok := RetryAfterOf(errors.New("other")); ok {
+		t.Error("RetryAfterOf matched an unrelated error")
+	}
+}
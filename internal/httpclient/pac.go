@@ -0,0 +1,447 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	// pacTTL is how long a downloaded PAC script is used before fetching it
+	// again; pacRetry spaces out attempts while it cannot be fetched.
+	pacTTL      = time.Hour
+	pacRetry    = time.Minute
+	pacTimeout  = 15 * time.Second
+	maxPACBytes = 1 << 20
+	dnsTimeout  = 5 * time.Second
+	// pacEvalTimeout stops a script stuck in a loop.
+	pacEvalTimeout = 5 * time.Second
+)
+
+// pacResolver evaluates a proxy auto-config script locally. While the
+// script cannot be loaded or evaluated, requests go direct; CheckPAC
+// reports why.
+type pacResolver struct {
+	scriptURL string
+	username  string
+	password  string
+	client    *http.Client
+
+	mu        sync.Mutex
+	vm        *goja.Runtime
+	find      goja.Callable
+	fetched   time.Time
+	attempted time.Time
+	err       error
+}
+
+func newPAC(scriptURL, username, password string) *pacResolver {
+	// The script itself is always fetched without a proxy.
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = nil
+	return &pacResolver{
+		scriptURL: scriptURL,
+		username:  username,
+		password:  password,
+		client:    &http.Client{Transport: base, Timeout: pacTimeout},
+	}
+}
+
+// CheckPAC loads the script at scriptURL and evaluates it for target,
+// returning what FindProxyForURL answered. It is for the settings window,
+// which otherwise would not learn that requests are going direct.
+func CheckPAC(scriptURL, target string) (string, error) {
+	p := newPAC(scriptURL, "", "")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load()
+	if p.find == nil {
+		return "", p.err
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	return p.evaluate(u)
+}
+
+func (p *pacResolver) proxy(req *http.Request) (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.load()
+	if p.find == nil {
+		return nil, nil
+	}
+	result, err := p.evaluate(req.URL)
+	if err != nil {
+		log.Printf("http: pac script failed for %s, going direct: %v", req.URL.Hostname(), err)
+		return nil, nil
+	}
+	return p.parseResult(result)
+}
+
+// evaluate calls FindProxyForURL, interrupting scripts that run too long.
+func (p *pacResolver) evaluate(u *url.URL) (string, error) {
+	target := *u
+	target.User = nil
+	timer := time.AfterFunc(pacEvalTimeout, func() { p.vm.Interrupt("timed out") })
+	defer func() {
+		timer.Stop()
+		p.vm.ClearInterrupt()
+	}()
+	result, err := p.find(goja.Undefined(), p.vm.ToValue(target.String()), p.vm.ToValue(u.Hostname()))
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+func (p *pacResolver) load() {
+	now := time.Now()
+	if p.find != nil && now.Sub(p.fetched) < pacTTL || now.Sub(p.attempted) < pacRetry {
+		return
+	}
+	p.attempted = now
+	script, err := p.fetch()
+	if err == nil {
+		var vm *goja.Runtime
+		var find goja.Callable
+		if vm, find, err = compilePAC(script); err == nil {
+			p.vm, p.find, p.fetched, p.err = vm, find, now, nil
+			return
+		}
+	}
+	p.err = err
+	if p.find != nil {
+		log.Printf("http: reloading pac script %s failed, keeping the previous one: %v", p.scriptURL, err)
+	} else {
+		log.Printf("http: loading pac script %s failed, going direct: %v", p.scriptURL, err)
+	}
+}
+
+// compilePAC runs script in a fresh runtime with the PAC helper functions
+// and returns its FindProxyForURL.
+func compilePAC(script string) (*goja.Runtime, goja.Callable, error) {
+	vm := goja.New()
+	for name, fn := range pacBuiltins() {
+		if err := vm.Set(name, fn); err != nil {
+			return nil, nil, err
+		}
+	}
+	timer := time.AfterFunc(pacEvalTimeout, func() { vm.Interrupt("timed out") })
+	_, err := vm.RunString(script)
+	timer.Stop()
+	vm.ClearInterrupt()
+	if err != nil {
+		return nil, nil, err
+	}
+	find, ok := goja.AssertFunction(vm.Get("FindProxyForURL"))
+	if !ok {
+		return nil, nil, errors.New("script does not define FindProxyForURL")
+	}
+	return vm, find, nil
+}
+
+func (p *pacResolver) fetch() (string, error) {
+	u, err := url.Parse(p.scriptURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "file" || u.Scheme == "" {
+		data, err := os.ReadFile(u.Path)
+		return string(data), err
+	}
+	resp, err := p.client.Get(p.scriptURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPACBytes))
+	return string(data), err
+}
+
+// parseResult takes the first usable entry of a result such as
+// "PROXY a:8080; SOCKS5 b:1080; DIRECT".
+func (p *pacResolver) parseResult(result string) (*url.URL, error) {
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			return nil, nil
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		var scheme string
+		switch kind {
+		case "PROXY", "HTTP":
+			scheme = "http"
+		case "HTTPS":
+			scheme = "https"
+		case "SOCKS", "SOCKS5":
+			scheme = "socks5"
+		default:
+			continue
+		}
+		return proxyURL(scheme+"://"+fields[1], scheme, p.username, p.password)
+	}
+	return nil, nil
+}
+
+func pacBuiltins() map[string]any {
+	return map[string]any{
+		"isPlainHostName": func(host string) bool {
+			return !strings.Contains(host, ".")
+		},
+		"dnsDomainIs": func(host, domain string) bool {
+			return strings.HasSuffix(strings.ToLower(host), strings.ToLower(domain))
+		},
+		"localHostOrDomainIs": func(host, hostdom string) bool {
+			host, hostdom = strings.ToLower(host), strings.ToLower(hostdom)
+			if host == hostdom {
+				return true
+			}
+			name, _, _ := strings.Cut(hostdom, ".")
+			return !strings.Contains(host, ".") && host == name
+		},
+		"isResolvable": func(host string) bool {
+			return resolveIPv4(host) != nil
+		},
+		"isInNet": func(host, pattern, mask string) bool {
+			ip := resolveIPv4(host)
+			p, m := net.ParseIP(pattern).To4(), net.ParseIP(mask).To4()
+			if ip == nil || p == nil || m == nil {
+				return false
+			}
+			return ip.Mask(net.IPMask(m)).Equal(p.Mask(net.IPMask(m)))
+		},
+		"dnsResolve": func(host string) any {
+			if ip := resolveIPv4(host); ip != nil {
+				return ip.String()
+			}
+			return nil
+		},
+		"convert_addr": func(addr string) uint32 {
+			ip := net.ParseIP(addr).To4()
+			if ip == nil {
+				return 0
+			}
+			return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+		},
+		"myIpAddress": myIPAddress,
+		"dnsDomainLevels": func(host string) int {
+			return strings.Count(host, ".")
+		},
+		"shExpMatch":   shExpMatch,
+		"weekdayRange": func(args ...string) bool { return weekdayRange(time.Now(), args) },
+		"dateRange":    func(args ...string) bool { return dateRange(time.Now(), args) },
+		"timeRange":    func(args ...string) bool { return timeRange(time.Now(), args) },
+		"alert":        func(string) {},
+	}
+}
+
+func resolveIPv4(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.To4()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return nil
+	}
+	return ips[0].To4()
+}
+
+// myIPAddress finds the address of the interface used for outgoing
+// traffic. Dialing UDP sends no packets.
+func myIPAddress() string {
+	conn, err := net.Dial("udp4", "192.0.2.1:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// shExpMatch matches a shell expression where * is any run of characters
+// and ? is any single character; unlike path.Match, * also matches "/".
+func shExpMatch(s, pattern string) bool {
+	star, mark := -1, 0
+	i, j := 0, 0
+	for i < len(s) {
+		switch {
+		case j < len(pattern) && (pattern[j] == '?' || pattern[j] == s[i]):
+			i++
+			j++
+		case j < len(pattern) && pattern[j] == '*':
+			star, mark = j, i
+			j++
+		case star >= 0:
+			mark++
+			i, j = mark, star+1
+		default:
+			return false
+		}
+	}
+	for j < len(pattern) && pattern[j] == '*' {
+		j++
+	}
+	return j == len(pattern)
+}
+
+var pacWeekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// weekdayRange implements weekdayRange(wd1[, wd2][, "GMT"]).
+func weekdayRange(now time.Time, args []string) bool {
+	now, args = pacNow(now, args)
+	days := make([]int, 0, 2)
+	for _, arg := range args {
+		for i, name := range pacWeekdays {
+			if strings.EqualFold(arg, name) {
+				days = append(days, i)
+			}
+		}
+	}
+	if len(days) == 0 {
+		return false
+	}
+	today := int(now.Weekday())
+	if len(days) == 1 {
+		return today == days[0]
+	}
+	return inRange(days[0], today, days[1])
+}
+
+// timeRange implements timeRange(h), timeRange(h1, h2),
+// timeRange(h1, m1, h2, m2) and timeRange(h1, m1, s1, h2, m2, s2), each
+// optionally followed by "GMT". The end of a range is exclusive.
+func timeRange(now time.Time, args []string) bool {
+	now, args = pacNow(now, args)
+	nums := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil {
+			return false
+		}
+		nums[i] = n
+	}
+	h, m, sec := now.Clock()
+	switch len(nums) {
+	case 1:
+		return h == nums[0]
+	case 2:
+		return inRange(nums[0]*3600, h*3600+m*60+sec, nums[1]*3600-1)
+	case 4:
+		return inRange(nums[0]*3600+nums[1]*60, h*3600+m*60+sec, nums[2]*3600+nums[3]*60-1)
+	case 6:
+		return inRange(nums[0]*3600+nums[1]*60+nums[2], h*3600+m*60+sec, nums[3]*3600+nums[4]*60+nums[5]-1)
+	}
+	return false
+}
+
+var pacMonths = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+// dateRange implements every form of dateRange: a day of month, month
+// name or year, or a range between two of them with the same parts, such
+// as (1, "JUN", 15, "AUG") or ("DEC", 2024, "JAN", 2025), optionally
+// followed by "GMT". Both ends are inclusive.
+func dateRange(now time.Time, args []string) bool {
+	now, args = pacNow(now, args)
+	type part struct{ kind, value int } // kind: 0 year, 1 month, 2 day
+	parts := make([]part, 0, len(args))
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if n, err := strconv.Atoi(arg); err == nil {
+			if n > 31 {
+				parts = append(parts, part{0, n})
+			} else {
+				parts = append(parts, part{2, n})
+			}
+			continue
+		}
+		month := -1
+		for i, name := range pacMonths {
+			if strings.EqualFold(arg, name) {
+				month = i + 1
+			}
+		}
+		if month < 0 {
+			return false
+		}
+		parts = append(parts, part{1, month})
+	}
+	if len(parts) == 0 || len(parts) > 1 && len(parts)%2 != 0 {
+		return false
+	}
+	// key folds the parts present, most significant first, into one
+	// comparable number; today is folded the same way.
+	key := func(ps []part) (value int, kinds [3]bool) {
+		var fields [3]int
+		for _, p := range ps {
+			fields[p.kind], kinds[p.kind] = p.value, true
+		}
+		for kind, present := range kinds {
+			if present {
+				value = value*10000 + fields[kind]
+			}
+		}
+		return value, kinds
+	}
+	today := []part{{0, now.Year()}, {1, int(now.Month())}, {2, now.Day()}}
+	todayKey := func(kinds [3]bool) int {
+		var ps []part
+		for _, p := range today {
+			if kinds[p.kind] {
+				ps = append(ps, p)
+			}
+		}
+		v, _ := key(ps)
+		return v
+	}
+	if len(parts) == 1 {
+		v, kinds := key(parts)
+		return v == todayKey(kinds)
+	}
+	half := len(parts) / 2
+	from, fromKinds := key(parts[:half])
+	to, toKinds := key(parts[half:])
+	if fromKinds != toKinds {
+		return false
+	}
+	return inRange(from, todayKey(fromKinds), to)
+}
+
+// inRange reports whether v lies in [from, to], wrapping around when
+// from is after to, as in weekdayRange("FRI", "MON").
+func inRange(from, v, to int) bool {
+	if from <= to {
+		return from <= v && v <= to
+	}
+	return v >= from || v <= to
+}
+
+func pacNow(now time.Time, args []string) (time.Time, []string) {
+	if n := len(args); n > 0 && strings.EqualFold(args[n-1], "GMT") {
+		return now.UTC(), args[:n-1]
+	}
+	return now, args
+}
@@ -0,0 +1,150 @@
+package httpclient
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"yuluwallpaper/internal/config"
+)
+
+// ProxyOptions selects the proxy for every request. Mode is one of the
+// config.Proxy* values; an empty mode follows the system settings.
+type ProxyOptions struct {
+	Mode     string
+	URL      string
+	Username string
+	Password string
+}
+
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+func newProxyFunc(opts ProxyOptions) (proxyFunc, error) {
+	switch opts.Mode {
+	case config.ProxyNone:
+		return nil, nil
+	case config.ProxyHTTP:
+		u, err := proxyURL(opts.URL, "http", opts.Username, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		return http.ProxyURL(u), nil
+	case config.ProxySOCKS5:
+		u, err := proxyURL(opts.URL, "socks5", opts.Username, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		return http.ProxyURL(u), nil
+	case config.ProxyPAC:
+		if _, err := url.Parse(opts.URL); err != nil {
+			return nil, fmt.Errorf("pac url: %w", err)
+		}
+		return newPAC(opts.URL, opts.Username, opts.Password).proxy, nil
+	default:
+		return systemProxy(), nil
+	}
+}
+
+// proxyURL parses a proxy address, which may omit the scheme.
+func proxyURL(addr, scheme, username, password string) (*url.URL, error) {
+	if !strings.Contains(addr, "://") {
+		addr = scheme + "://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy address: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "socks", "socks5", "socks5h":
+		u.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy address %q has no host", addr)
+	}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	return u, nil
+}
+
+// systemProxy follows the proxy environment variables when any are set,
+// and the operating system's proxy settings otherwise.
+func systemProxy() proxyFunc {
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		if os.Getenv(name) != "" {
+			return http.ProxyFromEnvironment
+		}
+	}
+	settings, err := systemSettings()
+	if err != nil {
+		log.Printf("http: reading system proxy settings failed: %v", err)
+		return http.ProxyFromEnvironment
+	}
+	if settings.PAC != "" {
+		return newPAC(settings.PAC, "", "").proxy
+	}
+	return settings.proxy
+}
+
+// proxySettings are the manual proxies configured in the operating system,
+// each given as host:port.
+type proxySettings struct {
+	HTTP   string
+	HTTPS  string
+	SOCKS  string
+	PAC    string
+	Bypass []string
+}
+
+func (s proxySettings) proxy(req *http.Request) (*url.URL, error) {
+	if bypassed(req.URL.Hostname(), s.Bypass) {
+		return nil, nil
+	}
+	addr, scheme := s.HTTP, "http"
+	if req.URL.Scheme == "https" && s.HTTPS != "" {
+		addr = s.HTTPS
+	}
+	if addr == "" && s.SOCKS != "" {
+		addr, scheme = s.SOCKS, "socks5"
+	}
+	if addr == "" {
+		return nil, nil
+	}
+	return proxyURL(addr, scheme, "", "")
+}
+
+// bypassed reports whether host is loopback or matches an exception such as
+// "*.example.com", "10.*" or "<local>" (any name without a dot).
+func bypassed(host string, exceptions []string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, entry := range exceptions {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case entry == "<local>":
+			if !strings.Contains(host, ".") {
+				return true
+			}
+		case shExpMatch(host, entry):
+			return true
+		case strings.HasPrefix(entry, "*."), strings.HasPrefix(entry, "."):
+			if host == strings.TrimLeft(entry, "*.") {
+				return true
+			}
+		}
+	}
+	return false
+}
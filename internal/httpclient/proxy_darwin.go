@@ -0,0 +1,59 @@
+//go:build darwin
+
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// systemSettings reads the proxies of the active network service from
+// "scutil --proxy".
+func systemSettings() (proxySettings, error) {
+	out, err := exec.Command("scutil", "--proxy").Output()
+	if err != nil {
+		return proxySettings{}, err
+	}
+	values := make(map[string]string)
+	var settings proxySettings
+	inExceptions := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inExceptions {
+			if line == "}" {
+				inExceptions = false
+			} else if _, host, ok := strings.Cut(line, " : "); ok {
+				settings.Bypass = append(settings.Bypass, strings.TrimSpace(host))
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return proxySettings{}, err
+	}
+
+	if values["ProxyAutoConfigEnable"] == "1" && values["ProxyAutoConfigURLString"] != "" {
+		settings.PAC = values["ProxyAutoConfigURLString"]
+		return settings, nil
+	}
+	for prefix, addr := range map[string]*string{"HTTP": &settings.HTTP, "HTTPS": &settings.HTTPS, "SOCKS": &settings.SOCKS} {
+		if values[prefix+"Enable"] == "1" && values[prefix+"Proxy"] != "" {
+			*addr = net.JoinHostPort(values[prefix+"Proxy"], values[prefix+"Port"])
+		}
+	}
+	return settings, nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package httpclient
+
+// systemSettings has nothing beyond the environment variables to read on
+// this platform, so no proxy is used when they are unset.
+func systemSettings() (proxySettings, error) {
+	return proxySettings{}, nil
+}
@@ -0,0 +1,54 @@
+//go:build windows
+
+package httpclient
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// systemSettings reads the proxy configured in Internet Options.
+func systemSettings() (proxySettings, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.QUERY_VALUE)
+	if err != nil {
+		return proxySettings{}, err
+	}
+	defer key.Close()
+
+	var settings proxySettings
+	if pac, _, err := key.GetStringValue("AutoConfigURL"); err == nil && pac != "" {
+		settings.PAC = pac
+		return settings, nil
+	}
+	if enabled, _, err := key.GetIntegerValue("ProxyEnable"); err != nil || enabled == 0 {
+		return settings, nil
+	}
+	server, _, err := key.GetStringValue("ProxyServer")
+	if err != nil {
+		return settings, nil
+	}
+	// Either one "host:port" for every protocol or a list such as
+	// "http=host:port;https=host:port;socks=host:port".
+	if !strings.Contains(server, "=") {
+		settings.HTTP, settings.HTTPS = server, server
+	}
+	for _, part := range strings.Split(server, ";") {
+		scheme, addr, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(scheme)) {
+		case "http":
+			settings.HTTP = strings.TrimSpace(addr)
+		case "https":
+			settings.HTTPS = strings.TrimSpace(addr)
+		case "socks":
+			settings.SOCKS = strings.TrimSpace(addr)
+		}
+	}
+	if override, _, err := key.GetStringValue("ProxyOverride"); err == nil {
+		settings.Bypass = strings.Split(override, ";")
+	}
+	return settings, nil
+}
@@ -0,0 +1,70 @@
+package httpclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var errPinMismatch = errors.New("server certificate does not match any pinned key")
+
+// TLSOptions hardens connections to a self-hosted server.
+type TLSOptions struct {
+	// CABundle is a PEM file of certificates trusted in addition to the
+	// system roots.
+	CABundle string
+	// Pins are base64 SHA-256 hashes of a certificate's public key
+	// (SubjectPublicKeyInfo); one certificate in a verified chain must
+	// match.
+	Pins []string
+}
+
+func tlsConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("ca bundle: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca bundle %s: no certificates found", opts.CABundle)
+		}
+		config.RootCAs = roots
+	}
+
+	if len(opts.Pins) > 0 {
+		pins := make(map[string]bool, len(opts.Pins))
+		for _, pin := range opts.Pins {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+			if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin %q, want a base64 SHA-256 hash", pin)
+			}
+			pins[pin] = true
+		}
+		// Runs after the normal chain verification, so a pin narrows what
+		// is trusted but never replaces the usual checks. Only verified
+		// chains count: the server may send any extra certificate, including
+		// a copy of the pinned one.
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+						return nil
+					}
+				}
+			}
+			return errPinMismatch
+		}
+	}
+	return config, nil
+}
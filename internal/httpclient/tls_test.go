@@ -0,0 +1,159 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key, signed by parent or by itself.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) pin() string {
+	sum := sha256.Sum256(c.cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// bundle writes the certificates to a PEM file for TLSOptions.CABundle.
+func bundle(t *testing.T, certs ...*testCert) string {
+	t.Helper()
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serveTLS starts a server presenting leaf followed by extra.
+func serveTLS(t *testing.T, leaf *testCert, extra ...*testCert) string {
+	t.Helper()
+	chain := tls.Certificate{Certificate: [][]byte{leaf.cert.Raw}, PrivateKey: leaf.key}
+	for _, c := range extra {
+		chain.Certificate = append(chain.Certificate, c.cert.Raw)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{chain}}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func get(t *testing.T, url string, opts TLSOptions) error {
+	t.Helper()
+	config, err := tlsConfig(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestPins(t *testing.T) {
+	ca := newCert(t, "Home CA", true, nil)
+	leaf := newCert(t, "nas", false, ca)
+	url := serveTLS(t, leaf, ca)
+	caFile := bundle(t, ca)
+
+	if err := get(t, url, TLSOptions{CABundle: caFile, Pins: []string{leaf.pin()}}); err != nil {
+		t.Errorf("leaf pin: %v", err)
+	}
+	if err := get(t, url, TLSOptions{CABundle: caFile, Pins: []string{"sha256/" + ca.pin()}}); err != nil {
+		t.Errorf("CA pin: %v", err)
+	}
+	other := newCert(t, "other", true, nil)
+	if err := get(t, url, TLSOptions{CABundle: caFile, Pins: []string{other.pin()}}); !errors.Is(err, errPinMismatch) {
+		t.Errorf("mismatching pin: err %v, want %v", err, errPinMismatch)
+	}
+	if err := get(t, url, TLSOptions{Pins: []string{leaf.pin()}}); err == nil {
+		t.Error("a pin made an untrusted chain acceptable")
+	}
+}
+
+// TestPinIgnoresExtraCertificates covers an interceptor with a certificate
+// trusted by the system (say from a corporate CA) that also sends the
+// real server's certificate, whose public key anyone can copy.
+func TestPinIgnoresExtraCertificates(t *testing.T) {
+	realCA := newCert(t, "Home CA", true, nil)
+	real := newCert(t, "nas", false, realCA)
+	corpCA := newCert(t, "Corp CA", true, nil)
+	interceptor := newCert(t, "nas", false, corpCA)
+	url := serveTLS(t, interceptor, real, realCA)
+
+	err := get(t, url, TLSOptions{CABundle: bundle(t, corpCA), Pins: []string{real.pin(), realCA.pin()}})
+	if !errors.Is(err, errPinMismatch) {
+		t.Errorf("err %v, want %v", err, errPinMismatch)
+	}
+}
+
+func TestInvalidPin(t *testing.T) {
+	for _, pin := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := tlsConfig(TLSOptions{Pins: []string{pin}}); err == nil {
+			t.Errorf("pin %q accepted", pin)
+		}
+	}
+}
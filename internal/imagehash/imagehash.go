@@ -0,0 +1,80 @@
+// Package imagehash computes perceptual hashes, which stay close when the
+// same picture is re-encoded, resized or slightly recompressed.
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+
+	_ "golang.org/x/image/bmp"
+)
+
+const (
+	width  = 9
+	height = 8
+	// maxSamples bounds the pixels averaged per cell, so a 4K photo costs
+	// about as much as a thumbnail.
+	maxSamples = 16
+)
+
+// Difference is the 64-bit difference hash (dHash) of img: the picture is
+// shrunk to 9×8 grey cells and each bit says whether a cell is brighter
+// than its right-hand neighbour.
+func Difference(img image.Image) uint64 {
+	var cells [height][width]float64
+	b := img.Bounds()
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(b.Min.X+(x+1)*b.Dx()/width, x0+1)
+			cells[y][x] = average(img, x0, y0, x1, y1)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// average is the mean luma of the rectangle, sampled on a grid.
+func average(img image.Image, x0, y0, x1, y1 int) float64 {
+	stepX := max((x1-x0)/maxSamples, 1)
+	stepY := max((y1-y0)/maxSamples, 1)
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// Decode hashes encoded image data in any format the image package knows.
+func Decode(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return Difference(img), nil
+}
+
+// Distance is the number of bits in which a and b differ.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,120 @@
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// defaultDistance is the dedup distance the app uses unless configured.
+const defaultDistance = 6
+
+// photo draws a picture with broad shapes, like a photo has, from seed.
+func photo(seed int64, w, h int) image.Image {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	top := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{top.R, uint8(int(top.G) * y / h), uint8(int(top.B) * x / w), 255})
+		}
+	}
+	for i := 0; i < 12; i++ {
+		c := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+		cx, cy, r := rng.Intn(w), rng.Intn(h), w/16+rng.Intn(w/5)
+		for y := max(cy-r, 0); y < min(cy+r, h); y++ {
+			for x := max(cx-r, 0); x < min(cx+r, w); x++ {
+				if (x-cx)*(x-cx)+(y-cy)*(y-cy) <= r*r {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// reencode scales img to w×h and saves it as a JPEG of the given quality.
+func reencode(t *testing.T, img image.Image, w, h, quality int) []byte {
+	t.Helper()
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReencodedStaysClose(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		original := photo(seed, 960, 540)
+		want, err := Decode(encodePNG(t, original))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []struct{ w, h, quality int }{
+			{640, 360, 60},
+			{1920, 1080, 95},
+			{320, 180, 30},
+		} {
+			got, err := Decode(reencode(t, original, v.w, v.h, v.quality))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := Distance(want, got); d > defaultDistance {
+				t.Errorf("seed %d as %dx%d JPEG at quality %d: distance %d, want at most %d", seed, v.w, v.h, v.quality, d, defaultDistance)
+			}
+		}
+	}
+}
+
+func TestDifferentImagesAreFar(t *testing.T) {
+	var hashes []uint64
+	for seed := int64(1); seed <= 5; seed++ {
+		hashes = append(hashes, Difference(photo(seed, 960, 540)))
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if d := Distance(hashes[i], hashes[j]); d <= 3*defaultDistance {
+				t.Errorf("images %d and %d: distance %d, want well above %d", i+1, j+1, d, defaultDistance)
+			}
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff00, 0x00ff, 16},
+		{0, ^uint64(0), 64},
+	} {
+		if got := Distance(tc.a, tc.b); got != tc.want {
+			t.Errorf("Distance(%x, %x) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	if _, err := Decode([]byte("not an image")); err == nil {
+		t.Error("garbage decoded")
+	}
+}
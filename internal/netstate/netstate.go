@@ -0,0 +1,19 @@
+// Package netstate reports whether the machine is online and whether its
+// connection is metered, and notices when either changes.
+package netstate
+
+import "context"
+
+// Status is the network as the operating system sees it. The zero value,
+// used when nothing is known, means online and unmetered.
+type Status struct {
+	Offline bool
+	Metered bool
+}
+
+// Watch calls fn with the current status and again whenever it changes,
+// until ctx is done. It returns an error straight away where no network
+// monitor is available.
+func Watch(ctx context.Context, fn func(Status)) error {
+	return watch(ctx, fn)
+}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package netstate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	nmService   = "org.freedesktop.NetworkManager"
+	nmPath      = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+	nmInterface = "org.freedesktop.NetworkManager"
+
+	// NMMetered values.
+	meteredYes      = 1
+	meteredGuessYes = 3
+
+	// NMConnectivityState values.
+	connectivityUnknown = 0
+	connectivityFull    = 4
+)
+
+// NetworkManager reads Metered and Connectivity from NetworkManager over
+// D-Bus. Any bus works, so a stand-in object on a private bus can replace
+// the real service.
+type NetworkManager struct {
+	conn *dbus.Conn
+	obj  dbus.BusObject
+}
+
+func NewNetworkManager(conn *dbus.Conn) *NetworkManager {
+	return &NetworkManager{conn: conn, obj: conn.Object(nmService, nmPath)}
+}
+
+// Status reads the current state. Unknown connectivity counts as online,
+// since NetworkManager reports it when connectivity checks are disabled.
+func (nm *NetworkManager) Status() (Status, error) {
+	metered, err := nm.property("Metered")
+	if err != nil {
+		return Status{}, err
+	}
+	connectivity, err := nm.property("Connectivity")
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{
+		Offline: connectivity != connectivityFull && connectivity != connectivityUnknown,
+		Metered: metered == meteredYes || metered == meteredGuessYes,
+	}, nil
+}
+
+func (nm *NetworkManager) property(name string) (uint32, error) {
+	v, err := nm.obj.GetProperty(nmInterface + "." + name)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := v.Value().(uint32)
+	if !ok {
+		return 0, errors.New("unexpected type for " + name)
+	}
+	return value, nil
+}
+
+// Watch reports the status, then listens to StateChanged and property
+// changes and reports again whenever the status differs.
+func (nm *NetworkManager) Watch(ctx context.Context, fn func(Status)) error {
+	matches := [][]dbus.MatchOption{
+		{dbus.WithMatchObjectPath(nmPath), dbus.WithMatchInterface(nmInterface), dbus.WithMatchMember("StateChanged")},
+		{dbus.WithMatchObjectPath(nmPath), dbus.WithMatchInterface("org.freedesktop.DBus.Properties"), dbus.WithMatchMember("PropertiesChanged")},
+	}
+	for _, match := range matches {
+		if err := nm.conn.AddMatchSignal(match...); err != nil {
+			return err
+		}
+		defer nm.conn.RemoveMatchSignal(match...)
+	}
+	signals := make(chan *dbus.Signal, 16)
+	nm.conn.Signal(signals)
+	defer nm.conn.RemoveSignal(signals)
+
+	last, err := nm.Status()
+	if err != nil {
+		return err
+	}
+	fn(last)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig, ok := <-signals:
+			if !ok {
+				return errors.New("d-bus connection closed")
+			}
+			if sig.Path != nmPath {
+				continue
+			}
+			status, err := nm.Status()
+			if err != nil {
+				return err
+			}
+			if status != last {
+				last = status
+				fn(status)
+			}
+		}
+	}
+}
+
+func watch(ctx context.Context, fn func(Status)) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return NewNetworkManager(conn).Watch(ctx, fn)
+}
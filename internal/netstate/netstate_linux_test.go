@@ -0,0 +1,148 @@
+//go:build linux
+
+package netstate
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// privateBus starts a dbus-daemon of its own and returns its address. The
+// test is skipped where dbus-daemon is not installed.
+func privateBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	err = os.WriteFile(config, []byte(`<busconfig>
+  <type>session</type>
+  <listen>unix:dir=`+dir+`</listen>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("dbus-daemon: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestWatch exports a stand-in NetworkManager on a private bus and checks
+// that Watch reports the transitions its signals announce.
+func TestWatch(t *testing.T) {
+	address := privateBus(t)
+	server := connect(t, address)
+	// Connectivity changes are announced with StateChanged only, Metered
+	// changes with PropertiesChanged, so each path is tested on its own.
+	props, err := prop.Export(server, nmPath, prop.Map{nmInterface: {
+		"Connectivity": {Value: uint32(connectivityFull), Emit: prop.EmitFalse},
+		"Metered":      {Value: uint32(2), Emit: prop.EmitTrue},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := server.RequestName(nmService, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request name: %v, %v", reply, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	statuses := make(chan Status, 8)
+	done := make(chan error, 1)
+	nm := NewNetworkManager(connect(t, address))
+	go func() {
+		done <- nm.Watch(ctx, func(s Status) { statuses <- s })
+	}()
+	next := func(want Status) {
+		t.Helper()
+		select {
+		case got := <-statuses:
+			if got != want {
+				t.Fatalf("status %+v, want %+v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no status, want %+v", want)
+		}
+	}
+
+	next(Status{})
+
+	// Limited connectivity, announced by StateChanged.
+	props.SetMust(nmInterface, "Connectivity", uint32(3))
+	if err := server.Emit(nmPath, nmInterface+".StateChanged", uint32(60)); err != nil {
+		t.Fatal(err)
+	}
+	next(Status{Offline: true})
+
+	// A metered guess, announced by PropertiesChanged.
+	props.SetMust(nmInterface, "Metered", uint32(meteredGuessYes))
+	next(Status{Offline: true, Metered: true})
+
+	// A signal that changes nothing is not reported; the next change is.
+	if err := server.Emit(nmPath, nmInterface+".StateChanged", uint32(60)); err != nil {
+		t.Fatal(err)
+	}
+	props.SetMust(nmInterface, "Connectivity", uint32(connectivityUnknown))
+	props.SetMust(nmInterface, "Metered", uint32(meteredYes))
+	next(Status{Metered: true})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Watch did not return after cancel")
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	address := privateBus(t)
+	// Nobody owns the NetworkManager name on this bus.
+	if _, err := NewNetworkManager(connect(t, address)).Status(); err == nil {
+		t.Error("Status succeeded without NetworkManager")
+	}
+	if err := NewNetworkManager(connect(t, address)).Watch(context.Background(), func(Status) {}); err == nil {
+		t.Error("Watch succeeded without NetworkManager")
+	}
+}
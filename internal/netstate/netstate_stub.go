@@ -0,0 +1,12 @@
+//go:build !linux
+
+package netstate
+
+import (
+	"context"
+	"errors"
+)
+
+func watch(ctx context.Context, fn func(Status)) error {
+	return errors.New("network monitoring not supported on this platform")
+}
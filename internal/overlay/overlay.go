@@ -0,0 +1,190 @@
+package overlay
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+type Options struct {
+	Font    []byte
+	Caption string
+	// Credit is a line of small print, such as the title and author of
+	// the image.
+	Credit string
+}
+
+// Apply draws the caption in the top-right corner and the credit in the
+// bottom-right corner of the image at path and returns the path of the
+// rewritten image. PNG stays PNG; everything else is re-encoded as JPEG.
+func Apply(path string, opts Options) (string, error) {
+	caption, credit := strings.TrimSpace(opts.Caption), strings.TrimSpace(opts.Credit)
+	if caption == "" && credit == "" {
+		return path, nil
+	}
+	if len(opts.Font) == 0 {
+		return "", errors.New("overlay font not available")
+	}
+
+	src, err := decodeFile(path)
+	if err != nil {
+		return "", err
+	}
+	bounds := src.Bounds()
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, bounds, src, bounds.Min, draw.Src)
+
+	if caption != "" {
+		face, err := newFace(opts.Font, float64(bounds.Dy())/24)
+		if err != nil {
+			return "", err
+		}
+		defer face.Close()
+		drawCaption(canvas, face, caption)
+	}
+	if credit != "" {
+		face, err := newFace(opts.Font, float64(bounds.Dy())/60)
+		if err != nil {
+			return "", err
+		}
+		defer face.Close()
+		drawCredit(canvas, face, credit)
+	}
+
+	return encodeFile(path, canvas)
+}
+
+func drawCaption(canvas *image.RGBA, face font.Face, caption string) {
+	bounds := canvas.Bounds()
+	metrics := face.Metrics()
+	textWidth := font.MeasureString(face, caption).Ceil()
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	padding := textHeight / 2
+	margin := bounds.Dy() / 20
+
+	box := image.Rect(
+		bounds.Max.X-margin-textWidth-2*padding,
+		bounds.Min.Y+margin,
+		bounds.Max.X-margin,
+		bounds.Min.Y+margin+textHeight+2*padding,
+	)
+	draw.Draw(canvas, box, image.NewUniform(color.NRGBA{A: 110}), image.Point{}, draw.Over)
+
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(color.White),
+		Face: face,
+		Dot:  fixed.P(box.Min.X+padding, box.Min.Y+padding+metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(caption)
+}
+
+// drawCredit writes credit right-aligned above the bottom edge, shortened
+// to half the width, on a faint band so it stays legible on light images.
+func drawCredit(canvas *image.RGBA, face font.Face, credit string) {
+	bounds := canvas.Bounds()
+	metrics := face.Metrics()
+	credit = truncate(face, credit, fixed.I(bounds.Dx()/2))
+	textWidth := font.MeasureString(face, credit).Ceil()
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	padding := textHeight / 3
+	margin := bounds.Dy() / 40
+
+	box := image.Rect(
+		bounds.Max.X-margin-textWidth-2*padding,
+		bounds.Max.Y-margin-textHeight-2*padding,
+		bounds.Max.X-margin,
+		bounds.Max.Y-margin,
+	)
+	draw.Draw(canvas, box, image.NewUniform(color.NRGBA{A: 80}), image.Point{}, draw.Over)
+
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(color.NRGBA{R: 255, G: 255, B: 255, A: 220}),
+		Face: face,
+		Dot:  fixed.P(box.Min.X+padding, box.Min.Y+padding+metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(credit)
+}
+
+// truncate shortens text with an ellipsis until it fits maxWidth.
+func truncate(face font.Face, text string, maxWidth fixed.Int26_6) string {
+	if font.MeasureString(face, text) <= maxWidth {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && font.MeasureString(face, string(runes)+"…") > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
+
+func newFace(data []byte, size float64) (font.Face, error) {
+	parsed, err := opentype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if size < 12 {
+		size = 12
+	}
+	return opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+func encodeFile(path string, img image.Image) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".png" {
+		ext = ".jpg"
+	}
+	finalPath := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "overlay-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if ext == ".png" {
+		err = png.Encode(tmp, img)
+	} else {
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: 92})
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if finalPath != path {
+		_ = os.Remove(path)
+	}
+	_ = os.Remove(finalPath)
+	if err := os.Rename(tmp.Name(), finalPath); err != nil {
+		return "", err
+	}
+	return finalPath, nil
+}
@@ -0,0 +1,98 @@
+package overlay
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyCredit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallpaper.png")
+	writePNG(t, path, 800, 600)
+
+	out, err := Apply(path, Options{Font: goregular.TTF, Credit: "Lake at dawn · Jane Doe · © Example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != path {
+		t.Errorf("PNG rewritten to %s", out)
+	}
+	img, err := decodeFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	white := color.RGBAModel.Convert(color.White)
+	changed := func(r image.Rectangle) bool {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if color.RGBAModel.Convert(img.At(x, y)) != white {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if !changed(image.Rect(400, 540, 800, 600)) {
+		t.Error("no credit in the bottom-right corner")
+	}
+	if changed(image.Rect(0, 0, 800, 300)) {
+		t.Error("top half changed without a caption")
+	}
+}
+
+func TestApplyNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallpaper.jpg")
+	out, err := Apply(path, Options{Caption: " ", Credit: ""})
+	if err != nil || out != path {
+		t.Errorf("Apply = %q, %v; want the path untouched", out, err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	face, err := newFace(goregular.TTF, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+	if got := truncate(face, "short", 1000<<6); got != "short" {
+		t.Errorf("truncate = %q", got)
+	}
+	got := truncate(face, "a rather long credit line that cannot fit", 100<<6)
+	if len(got) >= len("a rather long credit line that cannot fit") || got[len(got)-len("…"):] != "…" {
+		t.Errorf("truncate = %q", got)
+	}
+}
+
+func TestPickSaying(t *testing.T) {
+	if PickSaying("2024-02-10") != PickSaying("2024-02-10") {
+		t.Error("same seed, different sayings")
+	}
+	seen := make(map[string]bool)
+	for _, seed := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		seen[PickSaying(seed).Text] = true
+	}
+	if len(seen) < 2 {
+		t.Error("every seed picks the same saying")
+	}
+}
@@ -0,0 +1,123 @@
+package overlay
+
+import (
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Saying is a quote and whom it is by.
+type Saying struct {
+	Text   string
+	Author string
+}
+
+// Sayings are drawn on quote cards and generated wallpapers.
+var Sayings = []Saying{
+	{"行到水穷处，坐看云起时。", "王维《终南别业》"},
+	{"山重水复疑无路，柳暗花明又一村。", "陆游《游山西村》"},
+	{"长风破浪会有时，直挂云帆济沧海。", "李白《行路难》"},
+	{"人生如逆旅，我亦是行人。", "苏轼《临江仙·送钱穆父》"},
+	{"千淘万漉虽辛苦，吹尽狂沙始到金。", "刘禹锡《浪淘沙》"},
+	{"路漫漫其修远兮，吾将上下而求索。", "屈原《离骚》"},
+}
+
+// PickSaying chooses one of Sayings by seed, so the same seed always
+// gets the same saying.
+func PickSaying(seed string) Saying {
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	return Sayings[h.Sum32()%uint32(len(Sayings))]
+}
+
+// Quote draws text in the middle of img, wrapped to fit, with attribution
+// on a line of its own beneath it.
+func Quote(img image.Image, fontData []byte, text, attribution string) (*image.RGBA, error) {
+	if len(fontData) == 0 {
+		return nil, errors.New("overlay font not available")
+	}
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, bounds, img, bounds.Min, draw.Src)
+
+	face, err := newFace(fontData, float64(bounds.Dy())/18)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+	small, err := newFace(fontData, float64(bounds.Dy())/32)
+	if err != nil {
+		return nil, err
+	}
+	defer small.Close()
+
+	maxWidth := fixed.I(bounds.Dx() * 7 / 10)
+	lines := wrap(face, text, maxWidth)
+	lineHeight := (face.Metrics().Ascent + face.Metrics().Descent).Ceil() * 13 / 10
+	smallHeight := (small.Metrics().Ascent + small.Metrics().Descent).Ceil()
+	height := len(lines) * lineHeight
+	if attribution != "" {
+		height += smallHeight * 2
+	}
+	padding := lineHeight / 2
+	top := bounds.Min.Y + (bounds.Dy()-height)/2
+	band := image.Rect(bounds.Min.X, top-padding, bounds.Max.X, top+height+padding)
+	draw.Draw(canvas, band, image.NewUniform(color.NRGBA{A: 90}), image.Point{}, draw.Over)
+
+	y := top + face.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		drawCentered(canvas, face, line, y)
+		y += lineHeight
+	}
+	if attribution != "" {
+		drawCentered(canvas, small, "—— "+attribution, y+smallHeight/2)
+	}
+	return canvas, nil
+}
+
+func drawCentered(canvas *image.RGBA, face font.Face, text string, baseline int) {
+	bounds := canvas.Bounds()
+	width := font.MeasureString(face, text).Ceil()
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(color.White),
+		Face: face,
+		Dot:  fixed.P(bounds.Min.X+(bounds.Dx()-width)/2, baseline),
+	}
+	drawer.DrawString(text)
+}
+
+// wrap breaks text into lines no wider than maxWidth. Chinese has no
+// spaces, so lines break between any two characters, preferring spaces
+// when the text has them.
+func wrap(face font.Face, text string, maxWidth fixed.Int26_6) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		var line []rune
+		lastSpace := -1
+		for _, r := range paragraph {
+			line = append(line, r)
+			if r == ' ' {
+				lastSpace = len(line) - 1
+			}
+			if font.MeasureString(face, string(line)) <= maxWidth || len(line) == 1 {
+				continue
+			}
+			cut := len(line) - 1
+			if lastSpace > 0 {
+				cut = lastSpace
+			}
+			lines = append(lines, strings.TrimSpace(string(line[:cut])))
+			line = []rune(strings.TrimLeft(string(line[cut:]), " "))
+			lastSpace = -1
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
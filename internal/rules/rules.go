@@ -0,0 +1,105 @@
+package rules
+
+import (
+	"strings"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+// Env is the machine state rules are matched against. Probes are only run
+// for conditions that some rule actually uses.
+type Env struct {
+	Now      time.Time
+	Power    string
+	SSID     string
+	Monitors int
+}
+
+type Needs struct {
+	Power    bool
+	SSID     bool
+	Monitors bool
+}
+
+func NeedsOf(rules []config.Rule) Needs {
+	var needs Needs
+	for _, rule := range rules {
+		needs.Power = needs.Power || rule.When.Power != ""
+		needs.SSID = needs.SSID || len(rule.When.SSIDs) > 0
+		needs.Monitors = needs.Monitors || rule.When.MinMonitors > 0 || rule.When.MaxMonitors > 0
+	}
+	return needs
+}
+
+// Evaluate merges the actions of all matching rules. Earlier rules take
+// precedence field by field, Pause included: the first matching rule that
+// sets it decides.
+func Evaluate(rules []config.Rule, env Env) config.RuleAction {
+	var action config.RuleAction
+	for _, rule := range rules {
+		if !Matches(rule.When, env) {
+			continue
+		}
+		if action.Source == "" {
+			action.Source = rule.Then.Source
+		}
+		if action.Layout == "" {
+			action.Layout = rule.Then.Layout
+		}
+		if action.IntervalMinutes == 0 {
+			action.IntervalMinutes = rule.Then.IntervalMinutes
+		}
+		if action.Pause == nil {
+			action.Pause = rule.Then.Pause
+		}
+	}
+	return action
+}
+
+func Matches(cond config.RuleCondition, env Env) bool {
+	if len(cond.Weekdays) > 0 {
+		mask, err := config.WeekdayMask(cond.Weekdays)
+		if err != nil || mask&(1<<uint(env.Now.Weekday())) == 0 {
+			return false
+		}
+	}
+	if cond.Time != "" {
+		start, end, err := config.ParseTimeRange(cond.Time)
+		if err != nil || !inRange(env.Now.Hour()*60+env.Now.Minute(), start, end) {
+			return false
+		}
+	}
+	if cond.Power != "" && cond.Power != env.Power {
+		return false
+	}
+	if len(cond.SSIDs) > 0 && !containsFold(cond.SSIDs, env.SSID) {
+		return false
+	}
+	if cond.MinMonitors > 0 && env.Monitors < cond.MinMonitors {
+		return false
+	}
+	if cond.MaxMonitors > 0 && env.Monitors > cond.MaxMonitors {
+		return false
+	}
+	return true
+}
+
+func inRange(minute, start, end int) bool {
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func containsFold(values []string, target string) bool {
+	if target == "" {
+		return false
+	}
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
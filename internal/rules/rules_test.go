@@ -0,0 +1,72 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+func boolPtr(v bool) *bool { return &v }
+
+func TestEvaluatePrecedence(t *testing.T) {
+	weekend := config.RuleCondition{Weekdays: []string{"sat", "sun"}}
+	battery := config.RuleCondition{Power: config.PowerBattery}
+	rules := []config.Rule{
+		{Name: "weekend", When: weekend, Then: config.RuleAction{Source: "bing", Pause: boolPtr(false)}},
+		{Name: "battery", When: battery, Then: config.RuleAction{Source: "folder", Layout: config.LayoutFit, Pause: boolPtr(true)}},
+		{Name: "always", Then: config.RuleAction{IntervalMinutes: 120}},
+	}
+	saturday := time.Date(2024, 2, 10, 12, 0, 0, 0, time.Local)
+	monday := time.Date(2024, 2, 12, 12, 0, 0, 0, time.Local)
+
+	for _, tc := range []struct {
+		name   string
+		env    Env
+		source string
+		layout config.Layout
+		pause  bool
+	}{
+		// The weekend rule comes first, so it keeps rotation going on
+		// battery, as it picks the source.
+		{"weekend on battery", Env{Now: saturday, Power: config.PowerBattery}, "bing", config.LayoutFit, false},
+		{"weekday on battery", Env{Now: monday, Power: config.PowerBattery}, "folder", config.LayoutFit, true},
+		{"weekday on AC", Env{Now: monday, Power: config.PowerAC}, "", "", false},
+	} {
+		action := Evaluate(rules, tc.env)
+		if action.Source != tc.source || action.Layout != tc.layout || action.Paused() != tc.pause || action.IntervalMinutes != 120 {
+			t.Errorf("%s: %+v (paused %v), want source %q layout %q paused %v", tc.name, action, action.Paused(), tc.source, tc.layout, tc.pause)
+		}
+	}
+}
+
+func TestEvaluateUnsetPause(t *testing.T) {
+	// A rule without pause leaves the decision to later rules.
+	rules := []config.Rule{
+		{Then: config.RuleAction{Source: "bing"}},
+		{Then: config.RuleAction{Pause: boolPtr(true)}},
+	}
+	if action := Evaluate(rules, Env{Now: time.Now()}); !action.Paused() || action.Source != "bing" {
+		t.Errorf("action %+v, want bing and paused", action)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	night := time.Date(2024, 2, 10, 23, 30, 0, 0, time.Local)
+	for _, tc := range []struct {
+		cond config.RuleCondition
+		env  Env
+		want bool
+	}{
+		{config.RuleCondition{Time: "22:00-07:00"}, Env{Now: night}, true},
+		{config.RuleCondition{Time: "09:00-18:00"}, Env{Now: night}, false},
+		{config.RuleCondition{SSIDs: []string{"Office"}}, Env{Now: night, SSID: "office"}, true},
+		{config.RuleCondition{SSIDs: []string{"Office"}}, Env{Now: night}, false},
+		{config.RuleCondition{MinMonitors: 2}, Env{Now: night, Monitors: 1}, false},
+		{config.RuleCondition{MaxMonitors: 1}, Env{Now: night, Monitors: 1}, true},
+	} {
+		if got := Matches(tc.cond, tc.env); got != tc.want {
+			t.Errorf("Matches(%+v, %+v) = %v, want %v", tc.cond, tc.env, got, tc.want)
+		}
+	}
+}
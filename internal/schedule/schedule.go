@@ -0,0 +1,258 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNeverFires means a cron expression is valid but names no date that
+// exists, such as the 31st of February.
+var ErrNeverFires = errors.New("schedule never fires")
+
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// Parse accepts either a five-field cron expression ("0 9,13,18 * * 1-5")
+// or a list of daily times ("09:00, 13:30, 18:00").
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("empty schedule")
+	}
+	if strings.Contains(expr, ":") {
+		return parseDaily(expr)
+	}
+	return parseCron(expr)
+}
+
+func Upcoming(sched Schedule, after time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for len(times) < n {
+		next := sched.Next(after)
+		if next.IsZero() {
+			break
+		}
+		times = append(times, next)
+		after = next
+	}
+	return times
+}
+
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+// Earliest combines schedules, firing whenever any of them does.
+func Earliest(scheds ...Schedule) Schedule {
+	return earliest(scheds)
+}
+
+type earliest []Schedule
+
+func (e earliest) Next(after time.Time) time.Time {
+	var next time.Time
+	for _, sched := range e {
+		t := sched.Next(after)
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
+
+type every time.Duration
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+type clock struct {
+	hour, minute int
+}
+
+type daily []clock
+
+func parseDaily(expr string) (Schedule, error) {
+	fields := strings.FieldsFunc(expr, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '，'
+	})
+	var times daily
+	for _, field := range fields {
+		hh, mm, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid time %q", field)
+		}
+		hour, err := strconv.Atoi(hh)
+		if err != nil || hour < 0 || hour > 23 {
+			return nil, fmt.Errorf("invalid time %q", field)
+		}
+		minute, err := strconv.Atoi(mm)
+		if err != nil || minute < 0 || minute > 59 {
+			return nil, fmt.Errorf("invalid time %q", field)
+		}
+		times = append(times, clock{hour: hour, minute: minute})
+	}
+	if len(times) == 0 {
+		return nil, errors.New("empty schedule")
+	}
+	sort.Slice(times, func(i, j int) bool {
+		if times[i].hour != times[j].hour {
+			return times[i].hour < times[j].hour
+		}
+		return times[i].minute < times[j].minute
+	})
+	return times, nil
+}
+
+func (d daily) Next(after time.Time) time.Time {
+	y, m, day := after.Date()
+	for offset := 0; offset <= 1; offset++ {
+		for _, c := range d {
+			candidate := time.Date(y, m, day+offset, c.hour, c.minute, 0, 0, after.Location())
+			if candidate.After(after) {
+				return candidate
+			}
+		}
+	}
+	return time.Time{}
+}
+
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+	c := &cron{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59, nil, 0); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23, nil, 0); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31, nil, 0); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12, monthNames, 1); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7, dayNames, 0); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	// Every date that exists, the 29th of February included, comes within
+	// Next's search window from the start of a leap year.
+	if c.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("%w: no day of month %s exists in month %s", ErrNeverFires, fields[2], fields[3])
+	}
+	return c, nil
+}
+
+func parseField(field string, min, max int, names []string, nameBase int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" && rangePart != "?" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseValue(from, names, nameBase); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = parseValue(to, names, nameBase); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range in %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, names []string, nameBase int) (int, error) {
+	lower := strings.ToLower(value)
+	for i, name := range names {
+		if lower == name {
+			return i + nameBase, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+func (c *cron) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// 2100 is no leap year, so the 29th of February can be eight years
+	// apart.
+	limit := t.AddDate(9, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseNeverFires(t *testing.T) {
+	for _, expr := range []string{
+		"0 0 31 2 *",
+		"0 0 30 feb *",
+		"0 0 31 4,6,9,11 *",
+		"0 0 30-31 2 ?",
+	} {
+		if _, err := Parse(expr); !errors.Is(err, ErrNeverFires) {
+			t.Errorf("Parse(%q) = %v, want ErrNeverFires", expr, err)
+		}
+	}
+	// Rare but possible dates are fine, and a weekday makes any day of the
+	// month possible since either may match.
+	for _, expr := range []string{
+		"0 0 29 2 *",
+		"0 0 31 1-12 *",
+		"0 0 31 2 mon",
+	} {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("Parse(%q) = %v", expr, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "0 0 * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-3 * * * *", "25:00"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+	for _, tc := range []struct {
+		expr        string
+		after, want time.Time
+	}{
+		{"0 9,13,18 * * 1-5", at(2024, 2, 9, 13, 0), at(2024, 2, 9, 18, 0)},
+		{"0 9,13,18 * * 1-5", at(2024, 2, 9, 18, 0), at(2024, 2, 12, 9, 0)},
+		{"*/15 * * * *", at(2024, 2, 9, 13, 7), at(2024, 2, 9, 13, 15)},
+		{"30 8 1 * sun", at(2024, 2, 2, 0, 0), at(2024, 2, 4, 8, 30)},
+		{"0 0 29 2 *", at(2024, 3, 1, 0, 0), at(2028, 2, 29, 0, 0)},
+		// 2100 is no leap year.
+		{"0 0 29 2 *", at(2097, 1, 1, 0, 0), at(2104, 2, 29, 0, 0)},
+		{"09:00, 13:30", at(2024, 2, 9, 13, 30), at(2024, 2, 10, 9, 0)},
+	} {
+		sched, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.expr, err)
+		}
+		if got := sched.Next(tc.after); !got.Equal(tc.want) {
+			t.Errorf("%q after %s = %s, want %s", tc.expr, tc.after, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Credential is what a source needs to log in. Which fields matter depends
+// on the source type.
+type Credential struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+// Store holds credentials by name. It is read from secrets.json next to
+// config.json, so config.json can be shared without leaking passwords.
+type Store map[string]Credential
+
+// Load reads the secrets file. A missing file is an empty store.
+func Load(path string) (Store, error) {
+	store := make(Store)
+	if path == "" {
+		return store, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return store, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return make(Store), err
+	}
+	return store, nil
+}
+
+// Lookup returns the named credential. Environment variables such as
+// YULUWALLPAPER_<NAME>_PASSWORD or YULUWALLPAPER_<NAME>_SECRET_ACCESS_KEY
+// override the file, with the name upper-cased and dashes turned into
+// underscores.
+func (s Store) Lookup(name string) (Credential, bool) {
+	cred, ok := s[name]
+	prefix := "YULUWALLPAPER_" + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_", ".", "_").Replace(name)) + "_"
+	for suffix, field := range map[string]*string{
+		"USERNAME":          &cred.Username,
+		"PASSWORD":          &cred.Password,
+		"ACCESS_KEY_ID":     &cred.AccessKeyID,
+		"SECRET_ACCESS_KEY": &cred.SecretAccessKey,
+		"SESSION_TOKEN":     &cred.SessionToken,
+	} {
+		if value, set := os.LookupEnv(prefix + suffix); set {
+			*field, ok = value, true
+		}
+	}
+	return cred, ok
+}
@@ -0,0 +1,157 @@
+package solar
+
+import (
+	"math"
+	"time"
+)
+
+type Phase string
+
+const (
+	PhaseDawn  Phase = "dawn"
+	PhaseDay   Phase = "day"
+	PhaseDusk  Phase = "dusk"
+	PhaseNight Phase = "night"
+)
+
+const (
+	sunriseAltitude = -0.833
+	civilAltitude   = -6.0
+	julianEpoch2000 = 2451545.0
+	julianUnixEpoch = 2440587.5
+)
+
+// Times holds the solar events of one local day. A zero value means the
+// event does not happen that day (polar day or night).
+type Times struct {
+	Dawn    time.Time
+	Sunrise time.Time
+	Sunset  time.Time
+	Dusk    time.Time
+
+	AlwaysUp   bool
+	AlwaysDown bool
+}
+
+// TimesFor returns the events of the day containing t at the given
+// location. The day is taken from local solar time at lon, not from t's
+// time zone, so it is the right one wherever the caller's clock is set.
+// The events are in t's location.
+func TimesFor(t time.Time, lat, lon float64) Times {
+	y, m, d := solarDate(t, lon)
+	return timesOn(y, m, d, lat, lon, t.Location())
+}
+
+// solarDate is the calendar date at t in local mean solar time at lon.
+func solarDate(t time.Time, lon float64) (int, time.Month, int) {
+	return t.UTC().Add(time.Duration(lon / 15 * float64(time.Hour))).Date()
+}
+
+// timesOn computes the events of a solar date; d may be out of range, as
+// for time.Date.
+func timesOn(y int, m time.Month, d int, lat, lon float64, loc *time.Location) Times {
+	noon := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	n := math.Round(julianDate(noon)-julianEpoch2000) + 0.0008
+
+	meanSolar := n - lon/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolar, 360)
+	mRad := rad(anomaly)
+	center := 1.9148*math.Sin(mRad) + 0.02*math.Sin(2*mRad) + 0.0003*math.Sin(3*mRad)
+	lambda := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julianEpoch2000 + meanSolar + 0.0053*math.Sin(mRad) - 0.0069*math.Sin(2*rad(lambda))
+	declination := math.Asin(math.Sin(rad(lambda)) * math.Sin(rad(23.4397)))
+
+	var times Times
+	riseSet, ok := hourAngle(sunriseAltitude, lat, declination)
+	switch {
+	case ok:
+		times.Sunrise = fromJulian(transit - riseSet/360).In(loc)
+		times.Sunset = fromJulian(transit + riseSet/360).In(loc)
+	case riseSet > 0:
+		times.AlwaysUp = true
+	default:
+		times.AlwaysDown = true
+	}
+	if twilight, ok := hourAngle(civilAltitude, lat, declination); ok {
+		times.Dawn = fromJulian(transit - twilight/360).In(loc)
+		times.Dusk = fromJulian(transit + twilight/360).In(loc)
+	}
+	return times
+}
+
+func PhaseAt(t time.Time, lat, lon float64) Phase {
+	times := TimesFor(t, lat, lon)
+	switch {
+	case times.AlwaysUp:
+		return PhaseDay
+	case times.AlwaysDown:
+		if !times.Dawn.IsZero() && !t.Before(times.Dawn) && t.Before(times.Dusk) {
+			return PhaseDawn
+		}
+		return PhaseNight
+	case !times.Dawn.IsZero() && t.Before(times.Dawn):
+		return PhaseNight
+	case t.Before(times.Sunrise):
+		return PhaseDawn
+	case t.Before(times.Sunset):
+		return PhaseDay
+	case times.Dusk.IsZero() || t.Before(times.Dusk):
+		return PhaseDusk
+	default:
+		return PhaseNight
+	}
+}
+
+// Transitions is a schedule that fires at every dawn, sunrise, sunset and
+// dusk at the given location.
+type Transitions struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (tr Transitions) Next(after time.Time) time.Time {
+	// Start a day early: at high latitudes dusk can fall just after local
+	// solar midnight, on the next solar date.
+	y, m, d := solarDate(after, tr.Longitude)
+	for offset := -1; offset < 3; offset++ {
+		times := timesOn(y, m, d+offset, tr.Latitude, tr.Longitude, after.Location())
+		for _, event := range []time.Time{times.Dawn, times.Sunrise, times.Sunset, times.Dusk} {
+			if !event.IsZero() && event.After(after) {
+				return event.Truncate(time.Minute).Add(time.Minute)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// hourAngle returns the hour angle in degrees at which the sun reaches the
+// given altitude. When it never does, ok is false and the sign of the result
+// tells whether the sun stays above (positive) or below (negative).
+func hourAngle(altitude, lat, declination float64) (float64, bool) {
+	latRad := rad(lat)
+	cos := (math.Sin(rad(altitude)) - math.Sin(latRad)*math.Sin(declination)) / (math.Cos(latRad) * math.Cos(declination))
+	if cos < -1 {
+		return 1, false
+	}
+	if cos > 1 {
+		return -1, false
+	}
+	return deg(math.Acos(cos)), true
+}
+
+func julianDate(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(jd float64) time.Time {
+	seconds := (jd - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(seconds*float64(time.Second))).Round(time.Second)
+}
+
+func rad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func deg(r float64) float64 {
+	return r * 180 / math.Pi
+}
@@ -0,0 +1,134 @@
+package solar
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	beijingLat = 39.9042
+	beijingLon = 116.4074
+)
+
+var (
+	shanghaiTZ = time.FixedZone("CST", 8*3600)
+	newYorkTZ  = time.FixedZone("EDT", -4*3600)
+)
+
+func near(t *testing.T, name string, got, want time.Time) {
+	t.Helper()
+	if d := got.Sub(want); d < -3*time.Minute || d > 3*time.Minute {
+		t.Errorf("%s = %s, want about %s", name, got.Format(time.RFC3339), want.Format(time.RFC3339))
+	}
+}
+
+func TestTimesForBeijingSolstice(t *testing.T) {
+	// Published times for Beijing on 2024-06-21: sunrise 04:46, sunset
+	// 19:46, civil dawn 04:14 and dusk 20:19.
+	at := func(h, m int) time.Time { return time.Date(2024, 6, 21, h, m, 0, 0, shanghaiTZ) }
+	for _, tz := range []*time.Location{shanghaiTZ, time.UTC, newYorkTZ} {
+		// Any instant of the Beijing day gives that day's events, whatever
+		// the caller's time zone.
+		for _, instant := range []time.Time{at(0, 30), at(12, 0), at(23, 30)} {
+			times := TimesFor(instant.In(tz), beijingLat, beijingLon)
+			if times.AlwaysUp || times.AlwaysDown {
+				t.Fatalf("%s: polar day or night in Beijing", tz)
+			}
+			near(t, "sunrise", times.Sunrise, at(4, 46))
+			near(t, "sunset", times.Sunset, at(19, 46))
+			near(t, "dawn", times.Dawn, at(4, 14))
+			near(t, "dusk", times.Dusk, at(20, 19))
+			if times.Sunrise.Location() != tz {
+				t.Errorf("events in %s, want the caller's %s", times.Sunrise.Location(), tz)
+			}
+		}
+	}
+}
+
+func TestPhaseAtOtherTimeZone(t *testing.T) {
+	for _, tc := range []struct {
+		utc  string
+		want Phase
+	}{
+		{"2024-06-21T22:00:00Z", PhaseDay},   // 06:00 in Beijing
+		{"2024-06-21T20:30:00Z", PhaseDawn},  // 04:30
+		{"2024-06-21T19:00:00Z", PhaseNight}, // 03:00
+		{"2024-06-21T12:00:00Z", PhaseDusk},  // 20:00
+		{"2024-06-21T15:00:00Z", PhaseNight}, // 23:00
+	} {
+		at, err := time.Parse(time.RFC3339, tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tz := range []*time.Location{time.UTC, shanghaiTZ, newYorkTZ} {
+			if got := PhaseAt(at.In(tz), beijingLat, beijingLon); got != tc.want {
+				t.Errorf("PhaseAt(%s) = %s, want %s", at.In(tz).Format(time.RFC3339), got, tc.want)
+			}
+		}
+	}
+}
+
+func TestPolar(t *testing.T) {
+	const tromsoLat, tromsoLon = 69.65, 18.96
+	const svalbardLat, svalbardLon = 78.22, 15.65
+	summer := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC)
+
+	if times := TimesFor(summer, tromsoLat, tromsoLon); !times.AlwaysUp || !times.Sunrise.IsZero() {
+		t.Errorf("Tromsø in June: %+v, want the midnight sun", times)
+	}
+	if got := PhaseAt(summer.Add(11*time.Hour), tromsoLat, tromsoLon); got != PhaseDay {
+		t.Errorf("Tromsø at midnight in June: %s, want day", got)
+	}
+
+	// In December the sun stays down in Tromsø, but there is civil
+	// twilight around noon.
+	times := TimesFor(winter, tromsoLat, tromsoLon)
+	if !times.AlwaysDown || times.Dawn.IsZero() || times.Dusk.IsZero() {
+		t.Fatalf("Tromsø in December: %+v, want polar night with twilight", times)
+	}
+	if got := PhaseAt(winter, tromsoLat, tromsoLon); got != PhaseDawn {
+		t.Errorf("Tromsø at noon in December: %s, want dawn", got)
+	}
+	if got := PhaseAt(winter.Add(-10*time.Hour), tromsoLat, tromsoLon); got != PhaseNight {
+		t.Errorf("Tromsø at night in December: %s, want night", got)
+	}
+
+	// Further north there is not even twilight.
+	times = TimesFor(winter, svalbardLat, svalbardLon)
+	if !times.AlwaysDown || !times.Dawn.IsZero() {
+		t.Errorf("Svalbard in December: %+v, want polar night without twilight", times)
+	}
+	if got := PhaseAt(winter, svalbardLat, svalbardLon); got != PhaseNight {
+		t.Errorf("Svalbard at noon in December: %s, want night", got)
+	}
+	if next := (Transitions{Latitude: svalbardLat, Longitude: svalbardLon}).Next(winter); !next.IsZero() {
+		t.Errorf("Svalbard in December: next transition %s, want none", next)
+	}
+}
+
+func TestTransitionsNext(t *testing.T) {
+	tr := Transitions{Latitude: beijingLat, Longitude: beijingLon}
+	at := func(d, h, m int) time.Time { return time.Date(2024, 6, d, h, m, 0, 0, shanghaiTZ) }
+	for _, tz := range []*time.Location{shanghaiTZ, time.UTC, newYorkTZ} {
+		for _, tc := range []struct {
+			name        string
+			after, want time.Time
+		}{
+			{"before dawn", at(21, 3, 0), at(21, 4, 15)},
+			{"morning", at(21, 6, 0), at(21, 19, 47)},
+			{"after sunset", at(21, 20, 0), at(21, 20, 20)},
+			// After dusk the next event is the following day's dawn, past
+			// midnight in Beijing and, for the UTC caller, past midnight
+			// UTC too.
+			{"after dusk", at(21, 22, 0), at(22, 4, 15)},
+			{"just after midnight", at(22, 0, 5), at(22, 4, 15)},
+		} {
+			got := tr.Next(tc.after.In(tz))
+			near(t, tc.name, got, tc.want)
+			if !got.After(tc.after) || got.Second() != 0 {
+				t.Errorf("%s: Next(%s) = %s, want a whole minute after it", tc.name, tc.after, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+const BingURL = "https://www.bing.com"
+
+// bingSizes are the resolutions the archive serves under each urlbase,
+// smallest first.
+var bingSizes = [][2]int{
+	{800, 480}, {1024, 768}, {1280, 720}, {1366, 768},
+	{1920, 1080}, {1920, 1200},
+}
+
+// bing reads the daily image from an HPImageArchive-format endpoint. The
+// archive changes once a day, so its entry is kept in the state store and
+// the API is only asked again on the next calendar day. The image behind a
+// URL never changes either, so it is downloaded once: asking again the same
+// day answers ErrNotModified without a request.
+type bing struct {
+	name       string
+	base       string
+	resolution string
+	env        Env
+}
+
+type bingArchive struct {
+	Images []bingEntry `json:"images"`
+}
+
+type bingEntry struct {
+	StartDate     string `json:"startdate"`
+	URL           string `json:"url"`
+	URLBase       string `json:"urlbase"`
+	Copyright     string `json:"copyright"`
+	CopyrightLink string `json:"copyrightlink"`
+	Title         string `json:"title"`
+}
+
+type bingState struct {
+	Day   string    `json:"day"`
+	Entry bingEntry `json:"entry"`
+	// Downloaded is the image URL already fetched today.
+	Downloaded string `json:"downloaded,omitempty"`
+}
+
+func newBing(cfg config.SourceConfig, env Env) (*bing, error) {
+	base := strings.TrimSuffix(cfg.URL, "/")
+	if base == "" {
+		base = BingURL
+	}
+	resolution, err := bingResolution(cfg.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	return &bing{name: cfg.Name, base: base, resolution: resolution, env: env}, nil
+}
+
+func (b *bing) Name() string {
+	return b.name
+}
+
+func (b *bing) Fetch(ctx context.Context) (*Image, error) {
+	st, err := b.today(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entry := st.Entry
+	imageURL, err := b.imageURL(entry)
+	if err != nil {
+		return nil, err
+	}
+	if st.Downloaded == imageURL {
+		return nil, ErrNotModified
+	}
+	img, err := Download(ctx, b.env.Client, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	st.Downloaded = imageURL
+	b.save(st)
+	img.Meta = Metadata{Title: entry.Title, Copyright: entry.Copyright, URL: imageURL}
+	if img.Meta.Title == "" {
+		img.Meta.Title = entry.Copyright
+	}
+	return img, nil
+}
+
+// today returns the cached state if it is from today, otherwise asks the
+// archive.
+func (b *bing) today(ctx context.Context) (bingState, error) {
+	day := time.Now().Format("2006-01-02")
+	var cached bingState
+	if b.env.State != nil && b.env.State.Get(b.stateKey(), &cached) && cached.Day == day {
+		return cached, nil
+	}
+
+	entry, err := b.fetchEntry(ctx)
+	if err != nil {
+		return bingState{}, err
+	}
+	st := bingState{Day: day, Entry: entry}
+	b.save(st)
+	return st, nil
+}
+
+func (b *bing) save(st bingState) {
+	if b.env.State == nil {
+		return
+	}
+	if err := b.env.State.Put(b.stateKey(), st); err != nil {
+		log.Printf("source %s: save daily entry: %v", b.name, err)
+	}
+}
+
+func (b *bing) fetchEntry(ctx context.Context) (bingEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.base+"/HPImageArchive.aspx?format=js&idx=0&n=1", nil)
+	if err != nil {
+		return bingEntry{}, err
+	}
+	resp, err := b.env.Client.Do(req)
+	if err != nil {
+		return bingEntry{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return bingEntry{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var archive bingArchive
+	if err := json.NewDecoder(resp.Body).Decode(&archive); err != nil {
+		return bingEntry{}, fmt.Errorf("decode archive: %w", err)
+	}
+	if len(archive.Images) == 0 {
+		return bingEntry{}, errors.New("archive lists no images")
+	}
+	return archive.Images[0], nil
+}
+
+// imageURL builds the variant URL from urlbase, falling back to the
+// entry's default url when no urlbase is given.
+func (b *bing) imageURL(entry bingEntry) (string, error) {
+	ref := entry.URL
+	if entry.URLBase != "" {
+		ref = entry.URLBase + "_" + b.resolution + ".jpg"
+	}
+	return resolveURL(b.base+"/", ref)
+}
+
+func (b *bing) stateKey() string {
+	return "bing:" + b.name
+}
+
+// bingResolution maps the configured resolution to a variant the archive
+// serves: "UHD" (the default) or the smallest size covering WIDTHxHEIGHT.
+func bingResolution(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "uhd") {
+		return "UHD", nil
+	}
+	w, h, ok := strings.Cut(strings.ToLower(value), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return "", fmt.Errorf("invalid resolution %q, want UHD or WIDTHxHEIGHT", value)
+	}
+	return matchBingSize(width, height), nil
+}
+
+func matchBingSize(width, height int) string {
+	for _, size := range bingSizes {
+		if size[0] >= width && size[1] >= height {
+			return fmt.Sprintf("%dx%d", size[0], size[1])
+		}
+	}
+	return "UHD"
+}
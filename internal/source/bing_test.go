@@ -0,0 +1,116 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/state"
+)
+
+func TestBingDownloadsOncePerDay(t *testing.T) {
+	data := testPNG(t)
+	var archiveHits, imageHits int
+	var imagePath string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/HPImageArchive.aspx", func(w http.ResponseWriter, r *http.Request) {
+		archiveHits++
+		fmt.Fprint(w, `{"images": [{"startdate": "20240210", "url": "/th?id=OHR.Lanterns_1920x1080.jpg", "urlbase": "/th?id=OHR.Lanterns", "title": "Lanterns", "copyright": "Lanterns (© Example)"}]}`)
+	})
+	mux.HandleFunc("/th", func(w http.ResponseWriter, r *http.Request) {
+		imageHits++
+		imagePath = r.URL.RequestURI()
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(data)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Env{Client: srv.Client(), State: store}
+	src, err := New(config.SourceConfig{Name: "bing", Type: config.SourceBing, URL: srv.URL}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imagePath != "/th?id=OHR.Lanterns_UHD.jpg" {
+		t.Errorf("image path %s", imagePath)
+	}
+	if img.Meta.Title != "Lanterns" || img.Meta.Copyright != "Lanterns (© Example)" {
+		t.Errorf("meta %+v", img.Meta)
+	}
+
+	// A second refresh the same day, even from a new source built from the
+	// same store, neither asks the archive nor downloads the image again.
+	src, _ = New(config.SourceConfig{Name: "bing", Type: config.SourceBing, URL: srv.URL}, env)
+	if _, err := src.Fetch(context.Background()); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("second fetch: %v, want ErrNotModified", err)
+	}
+	if archiveHits != 1 || imageHits != 1 {
+		t.Errorf("archive asked %d times, image downloaded %d times; want once each", archiveHits, imageHits)
+	}
+
+	// Another resolution is another image.
+	src, _ = New(config.SourceConfig{Name: "bing", Type: config.SourceBing, URL: srv.URL, Resolution: "1280x720"}, env)
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if imagePath != "/th?id=OHR.Lanterns_1280x720.jpg" || imageHits != 2 {
+		t.Errorf("image path %s after %d downloads", imagePath, imageHits)
+	}
+
+	// The next day asks the archive again.
+	var st bingState
+	store.Get("bing:bing", &st)
+	st.Day = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	store.Put("bing:bing", st)
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if archiveHits != 2 || imageHits != 3 {
+		t.Errorf("next day: archive asked %d times, image downloaded %d times", archiveHits, imageHits)
+	}
+}
+
+func TestBingFailedDownloadIsRetried(t *testing.T) {
+	data := testPNG(t)
+	fail := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/HPImageArchive.aspx", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"images": [{"urlbase": "/th?id=OHR.Snow", "title": "Snow"}]}`)
+	})
+	mux.HandleFunc("/th", func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(data)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	store, _ := state.Open("")
+	src, err := New(config.SourceConfig{Name: "bing", Type: config.SourceBing, URL: srv.URL}, Env{Client: srv.Client(), State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Fetch(context.Background()); err == nil {
+		t.Fatal("failed download succeeded")
+	}
+	fail = false
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatalf("retry after a failed download: %v", err)
+	}
+}
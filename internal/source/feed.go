@@ -0,0 +1,355 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+// defaultFeedTTL is how long a feed is trusted when it does not say.
+const defaultFeedTTL = time.Hour
+
+// feed picks photos from an RSS 2.0 or Atom feed. Images come from RSS
+// enclosures, Media RSS content or Atom enclosure links. Each item is used
+// once before any repeats; the parsed feed, the validators for conditional
+// GET and the used items all live in the state store.
+type feed struct {
+	name string
+	url  string
+	env  Env
+
+	mu sync.Mutex
+}
+
+type feedItem struct {
+	Key       string `json:"key"`
+	URL       string `json:"url"`
+	Title     string `json:"title,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Copyright string `json:"copyright,omitempty"`
+}
+
+type feedState struct {
+	Items        []feedItem `json:"items"`
+	Used         []string   `json:"used"`
+	ETag         string     `json:"etag,omitempty"`
+	LastModified string     `json:"last_modified,omitempty"`
+	Fetched      time.Time  `json:"fetched"`
+	TTLMinutes   int        `json:"ttl_minutes,omitempty"`
+}
+
+func newFeed(cfg config.SourceConfig, env Env) (*feed, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("feed source needs a url")
+	}
+	return &feed{name: cfg.Name, url: cfg.URL, env: env}, nil
+}
+
+func (f *feed) Name() string {
+	return f.name
+}
+
+func (f *feed) Fetch(ctx context.Context) (*Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var st feedState
+	if f.env.State != nil {
+		f.env.State.Get(f.stateKey(), &st)
+	}
+	if f.stale(st) {
+		if err := f.update(ctx, &st); err != nil {
+			if len(st.Items) == 0 {
+				return nil, err
+			}
+			log.Printf("source %s: using cached feed: %v", f.name, err)
+		}
+	}
+
+	img, used, err := pick(ctx, f.name, st.Items, st.Used,
+		func(item feedItem) string { return item.Key },
+		func(item feedItem) (*Image, error) {
+			img, err := Download(ctx, f.env.Client, item.URL, nil)
+			if err != nil {
+				return nil, err
+			}
+			img.Meta = Metadata{Title: item.Title, Author: item.Author, Copyright: item.Copyright, URL: item.URL}
+			return img, nil
+		})
+	st.Used = used
+	f.save(st)
+	return img, err
+}
+
+func (f *feed) stale(st feedState) bool {
+	ttl := defaultFeedTTL
+	if st.TTLMinutes > 0 {
+		ttl = time.Duration(st.TTLMinutes) * time.Minute
+	}
+	return len(st.Items) == 0 || time.Since(st.Fetched) >= ttl
+}
+
+// update asks for the feed with the stored validators and replaces the
+// items when it changed. Used items that left the feed are forgotten.
+func (f *feed) update(ctx context.Context, st *feedState) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url, nil)
+	if err != nil {
+		return err
+	}
+	if len(st.Items) > 0 {
+		if st.ETag != "" {
+			req.Header.Set("If-None-Match", st.ETag)
+		}
+		if st.LastModified != "" {
+			req.Header.Set("If-Modified-Since", st.LastModified)
+		}
+	}
+	resp, err := f.env.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		st.Fetched = time.Now()
+		f.save(*st)
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes))
+	if err != nil {
+		return err
+	}
+	items, ttl, err := parseFeed(data, f.url)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(items))
+	for _, item := range items {
+		current[item.Key] = true
+	}
+	var used []string
+	for _, key := range st.Used {
+		if current[key] {
+			used = append(used, key)
+		}
+	}
+	*st = feedState{
+		Items:        items,
+		Used:         used,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		TTLMinutes:   ttl,
+	}
+	f.save(*st)
+	return nil
+}
+
+func (f *feed) stateKey() string {
+	return "feed:" + f.name
+}
+
+func (f *feed) save(st feedState) {
+	if f.env.State == nil {
+		return
+	}
+	if err := f.env.State.Put(f.stateKey(), st); err != nil {
+		log.Printf("source %s: save feed state: %v", f.name, err)
+	}
+}
+
+type mediaContent struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Medium string `xml:"medium,attr"`
+	Width  string `xml:"width,attr"`
+}
+
+// mediaFields are the Media RSS elements shared by RSS items and Atom
+// entries.
+type mediaFields struct {
+	Content   []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	Group     []mediaGroup   `xml:"http://search.yahoo.com/mrss/ group"`
+	Title     string         `xml:"http://search.yahoo.com/mrss/ title"`
+	Credit    []string       `xml:"http://search.yahoo.com/mrss/ credit"`
+	Copyright string         `xml:"http://search.yahoo.com/mrss/ copyright"`
+}
+
+type mediaGroup struct {
+	Content []mediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		TTL       string    `xml:"ttl"`
+		Copyright string    `xml:"copyright"`
+		Items     []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title      string `xml:"title"`
+	Link       string `xml:"link"`
+	GUID       string `xml:"guid"`
+	Author     string `xml:"author"`
+	Creator    string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Enclosures []struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	mediaFields
+}
+
+type atomFeed struct {
+	Rights  string      `xml:"rights"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID     string `xml:"id"`
+	Title  string `xml:"title"`
+	Rights string `xml:"rights"`
+	Author []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+	mediaFields
+}
+
+// parseFeed returns the image items of an RSS or Atom document and the
+// feed's TTL in minutes, if it gives one.
+func parseFeed(data []byte, base string) ([]feedItem, int, error) {
+	var root struct{ XMLName xml.Name }
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, 0, fmt.Errorf("parse feed: %w", err)
+	}
+
+	var items []feedItem
+	add := func(key, ref string, item feedItem) {
+		imageURL, err := resolveURL(base, strings.TrimSpace(ref))
+		if err != nil {
+			return
+		}
+		item.URL = imageURL
+		item.Key = firstNonEmpty(strings.TrimSpace(key), imageURL)
+		items = append(items, item)
+	}
+
+	switch root.XMLName.Local {
+	case "rss":
+		var doc rssFeed
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, 0, fmt.Errorf("parse rss: %w", err)
+		}
+		for _, it := range doc.Channel.Items {
+			ref := it.mediaFields.image()
+			for _, enc := range it.Enclosures {
+				if ref == "" && isImageType(enc.Type, enc.URL) {
+					ref = enc.URL
+				}
+			}
+			if ref == "" {
+				continue
+			}
+			add(firstNonEmpty(it.GUID, it.Link), ref, feedItem{
+				Title:     firstNonEmpty(it.mediaFields.Title, it.Title),
+				Author:    firstNonEmpty(strings.Join(it.Credit, ", "), it.Creator, it.Author),
+				Copyright: firstNonEmpty(it.mediaFields.Copyright, doc.Channel.Copyright),
+			})
+		}
+		ttl, _ := strconv.Atoi(strings.TrimSpace(doc.Channel.TTL))
+		return items, ttl, nil
+	case "feed":
+		var doc atomFeed
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, 0, fmt.Errorf("parse atom: %w", err)
+		}
+		for _, entry := range doc.Entries {
+			ref := entry.mediaFields.image()
+			for _, link := range entry.Links {
+				if ref == "" && link.Rel == "enclosure" && isImageType(link.Type, link.Href) {
+					ref = link.Href
+				}
+			}
+			if ref == "" {
+				continue
+			}
+			var authors []string
+			for _, author := range entry.Author {
+				if name := strings.TrimSpace(author.Name); name != "" {
+					authors = append(authors, name)
+				}
+			}
+			add(entry.ID, ref, feedItem{
+				Title:     firstNonEmpty(entry.mediaFields.Title, entry.Title),
+				Author:    firstNonEmpty(strings.Join(entry.Credit, ", "), strings.Join(authors, ", ")),
+				Copyright: firstNonEmpty(entry.mediaFields.Copyright, entry.Rights, doc.Rights),
+			})
+		}
+		return items, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("not an RSS or Atom feed: <%s>", root.XMLName.Local)
+	}
+}
+
+// image returns the widest image among the media:content elements.
+func (m mediaFields) image() string {
+	contents := m.Content
+	for _, group := range m.Group {
+		contents = append(contents, group.Content...)
+	}
+	best, bestWidth := "", -1
+	for _, content := range contents {
+		if content.Medium != "" && content.Medium != "image" {
+			continue
+		}
+		if content.Medium == "" && !isImageType(content.Type, content.URL) {
+			continue
+		}
+		width, _ := strconv.Atoi(content.Width)
+		if width > bestWidth {
+			best, bestWidth = content.URL, width
+		}
+	}
+	return best
+}
+
+func isImageType(contentType, ref string) bool {
+	if contentType != "" {
+		return strings.HasPrefix(strings.ToLower(contentType), "image/")
+	}
+	if u, _, ok := strings.Cut(ref, "?"); ok {
+		ref = u
+	}
+	return IsImageFile(ref)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/state"
+)
+
+func TestParseFeedRSS(t *testing.T) {
+	doc := `<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+  <title>Photos</title>
+  <ttl> 30 </ttl>
+  <copyright>© Example Photos</copyright>
+  <item>
+    <title>Harbour</title>
+    <guid>harbour-1</guid>
+    <dc:creator>Ann</dc:creator>
+    <enclosure url="/audio/harbour.mp3" type="audio/mpeg"/>
+    <enclosure url="/img/harbour.jpg" type="image/jpeg"/>
+  </item>
+  <item>
+    <title>Ridge</title>
+    <link>https://photos.example.com/ridge</link>
+    <media:content url="https://cdn.example.com/ridge-small.jpg" medium="image" width="640"/>
+    <media:content url="https://cdn.example.com/ridge-large.jpg" medium="image" width="3840"/>
+    <media:content url="https://cdn.example.com/ridge.mp4" medium="video" width="7680"/>
+    <media:credit>Bo</media:credit>
+    <media:copyright>CC BY 4.0</media:copyright>
+  </item>
+  <item>
+    <title>Dunes</title>
+    <guid>dunes</guid>
+    <media:group>
+      <media:content url="https://cdn.example.com/dunes-1080.jpg" type="image/jpeg" width="1920"/>
+      <media:content url="https://cdn.example.com/dunes-4k.jpg" type="image/jpeg" width="3840"/>
+    </media:group>
+    <media:content url="https://cdn.example.com/dunes-thumb.jpg" type="image/jpeg" width="320"/>
+  </item>
+  <item>
+    <title>Text only</title>
+    <guid>text</guid>
+  </item>
+</channel>
+</rss>`
+	items, ttl, err := parseFeed([]byte(doc), "https://photos.example.com/feed.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []feedItem{
+		{Key: "harbour-1", URL: "https://photos.example.com/img/harbour.jpg", Title: "Harbour", Author: "Ann", Copyright: "© Example Photos"},
+		{Key: "https://photos.example.com/ridge", URL: "https://cdn.example.com/ridge-large.jpg", Title: "Ridge", Author: "Bo", Copyright: "CC BY 4.0"},
+		{Key: "dunes", URL: "https://cdn.example.com/dunes-4k.jpg", Title: "Dunes", Copyright: "© Example Photos"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("items\n%+v\nwant\n%+v", items, want)
+	}
+	if ttl != 30 {
+		t.Errorf("ttl %d, want 30", ttl)
+	}
+}
+
+func TestParseFeedAtom(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Photos</title>
+  <rights>© Feed</rights>
+  <entry>
+    <id>tag:example.com,2024:lake</id>
+    <title>Lake</title>
+    <author><name>Cy</name></author>
+    <author><name>Di</name></author>
+    <link rel="alternate" href="https://example.com/lake"/>
+    <link rel="enclosure" type="image/png" href="lake.png"/>
+  </entry>
+  <entry>
+    <id>tag:example.com,2024:forest</id>
+    <title>Forest</title>
+    <rights>© Ed</rights>
+    <link rel="enclosure" href="https://example.com/forest.jpg?w=4000"/>
+  </entry>
+  <entry>
+    <id>tag:example.com,2024:podcast</id>
+    <link rel="enclosure" type="audio/mpeg" href="https://example.com/episode.mp3"/>
+  </entry>
+</feed>`
+	items, ttl, err := parseFeed([]byte(doc), "https://example.com/photos/atom.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []feedItem{
+		{Key: "tag:example.com,2024:lake", URL: "https://example.com/photos/lake.png", Title: "Lake", Author: "Cy, Di", Copyright: "© Feed"},
+		{Key: "tag:example.com,2024:forest", URL: "https://example.com/forest.jpg?w=4000", Title: "Forest", Copyright: "© Ed"},
+	}
+	if !reflect.DeepEqual(items, want) || ttl != 0 {
+		t.Errorf("items\n%+v\nttl %d, want\n%+v", items, ttl, want)
+	}
+}
+
+func TestParseFeedErrors(t *testing.T) {
+	for _, doc := range []string{"not xml", `<html><body/></html>`} {
+		if _, _, err := parseFeed([]byte(doc), "https://example.com/"); err == nil {
+			t.Errorf("%q parsed as a feed", doc)
+		}
+	}
+}
+
+// feedServer serves an RSS feed of the given image names, answering
+// conditional requests with 304 while the feed is unchanged.
+type feedServer struct {
+	mu       sync.Mutex
+	images   []string
+	version  int
+	requests []string
+}
+
+func (f *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/feed.xml" {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngFor(r.URL.Path))
+		return
+	}
+	etag := fmt.Sprintf(`"v%d"`, f.version)
+	f.requests = append(f.requests, r.Header.Get("If-None-Match"))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	fmt.Fprint(w, `<rss version="2.0"><channel><ttl>30</ttl>`)
+	for _, name := range f.images {
+		fmt.Fprintf(w, `<item><title>%s</title><guid>%s</guid><enclosure url="/img/%s.png" type="image/png"/></item>`, name, name, name)
+	}
+	fmt.Fprint(w, `</channel></rss>`)
+}
+
+func (f *feedServer) update(images ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images = images
+	f.version++
+}
+
+func (f *feedServer) feedRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// pngFor is a PNG whose pixels spell name, so every image differs.
+func pngFor(name string) []byte {
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	copy(img.Pix, name)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestFeedFetch(t *testing.T) {
+	fs := &feedServer{images: []string{"a", "b", "c"}}
+	srv := httptest.NewServer(fs)
+	defer srv.Close()
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := New(config.SourceConfig{Name: "photos", Type: config.SourceFeed, URL: srv.URL + "/feed.xml"}, Env{Client: srv.Client(), State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := src.(*feed)
+	titles := func(n int) string {
+		t.Helper()
+		var got []string
+		for i := 0; i < n; i++ {
+			img, err := src.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, img.Meta.Title)
+		}
+		sort.Strings(got)
+		return strings.Join(got, ",")
+	}
+
+	// Each item is used once before any repeats, and within the feed's
+	// TTL the feed itself is asked for only once.
+	if got := titles(3); got != "a,b,c" {
+		t.Errorf("first round %s, want a, b and c", got)
+	}
+	if reqs := fs.feedRequests(); len(reqs) != 1 || reqs[0] != "" {
+		t.Errorf("feed requests %q, want one unconditional", reqs)
+	}
+	var st feedState
+	store.Get(f.stateKey(), &st)
+	if st.TTLMinutes != 30 || st.ETag != `"v0"` || len(st.Used) != 3 {
+		t.Errorf("state %+v", st)
+	}
+
+	// Past the TTL the feed is asked again with its ETag; 304 keeps the
+	// items and what was used.
+	expire := func() {
+		store.Get(f.stateKey(), &st)
+		st.Fetched = st.Fetched.Add(-31 * time.Minute)
+		f.save(st)
+	}
+	expire()
+	src.Fetch(context.Background())
+	if reqs := fs.feedRequests(); len(reqs) != 2 || reqs[1] != `"v0"` {
+		t.Errorf("feed requests %q, want a conditional second one", reqs)
+	}
+	store.Get(f.stateKey(), &st)
+	if len(st.Items) != 3 || len(st.Used) != 1 || time.Since(st.Fetched) > time.Minute {
+		t.Errorf("after 304: %d items, used %v, fetched %s", len(st.Items), st.Used, st.Fetched)
+	}
+
+	// A changed feed replaces the items and forgets used items that left.
+	used := st.Used[0]
+	var remaining []string
+	for _, name := range []string{"a", "b", "c"} {
+		if name != used {
+			remaining = append(remaining, name)
+		}
+	}
+	fs.update(used, remaining[0], "d")
+	expire()
+	img, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Get(f.stateKey(), &st)
+	if len(st.Items) != 3 || st.ETag != `"v1"` || img.Meta.Title == used {
+		t.Errorf("after the change: %d items, etag %s, fetched %s again", len(st.Items), st.ETag, img.Meta.Title)
+	}
+	fs.update("d", "e")
+	expire()
+	src.Fetch(context.Background())
+	store.Get(f.stateKey(), &st)
+	for _, key := range st.Used {
+		if key != "d" && key != "e" {
+			t.Errorf("used %v keeps %s, which left the feed", st.Used, key)
+		}
+	}
+}
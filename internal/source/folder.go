@@ -0,0 +1,247 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"yuluwallpaper/internal/config"
+)
+
+// folder rotates through local images with a shuffle bag: every image is
+// shown once before any repeats. The bag survives restarts through the
+// state store, and new files join the current round as they appear.
+type folder struct {
+	name      string
+	dirs      []string
+	recursive bool
+	include   []string
+	exclude   []string
+	env       Env
+
+	mu        sync.Mutex
+	remaining []string
+	shown     map[string]bool
+	watcher   *watcher
+}
+
+type folderState struct {
+	Remaining []string `json:"remaining"`
+	Shown     []string `json:"shown"`
+}
+
+func newFolder(cfg config.SourceConfig, env Env) (*folder, error) {
+	if len(cfg.Dirs) == 0 {
+		return nil, errors.New("folder source needs at least one directory")
+	}
+	f := &folder{
+		name:      cfg.Name,
+		dirs:      cfg.Dirs,
+		recursive: cfg.Recursive,
+		include:   cfg.Include,
+		exclude:   cfg.Exclude,
+		env:       env,
+		shown:     make(map[string]bool),
+	}
+
+	var saved folderState
+	if env.State != nil && env.State.Get(f.stateKey(), &saved) {
+		f.remaining = saved.Remaining
+		for _, path := range saved.Shown {
+			f.shown[path] = true
+		}
+	}
+	f.addUnseen(f.scan())
+
+	watcher, err := newWatcher(f)
+	if err != nil {
+		log.Printf("source %s: not watching for new files: %v", f.name, err)
+	}
+	f.watcher = watcher
+	return f, nil
+}
+
+func (f *folder) Name() string {
+	return f.name
+}
+
+func (f *folder) Fetch(ctx context.Context) (*Image, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	refilled := false
+	for {
+		if len(f.remaining) == 0 {
+			if refilled {
+				return nil, errors.New("no images found")
+			}
+			f.refill()
+			refilled = true
+			continue
+		}
+		path := f.remaining[0]
+		f.remaining = f.remaining[1:]
+		if !f.matches(path) {
+			continue
+		}
+		img, err := readImageFile(path)
+		if err != nil {
+			log.Printf("source %s: skipping %s: %v", f.name, path, err)
+			continue
+		}
+		f.shown[path] = true
+		f.save()
+		return img, nil
+	}
+}
+
+func (f *folder) Close() error {
+	if f.watcher == nil {
+		return nil
+	}
+	return f.watcher.close()
+}
+
+// added is called by the watcher for every new file.
+func (f *folder) added(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.matches(path) {
+		f.addUnseen([]string{path})
+		f.save()
+	}
+}
+
+func (f *folder) refill() {
+	f.shown = make(map[string]bool)
+	f.remaining = f.scan()
+	rand.Shuffle(len(f.remaining), func(i, j int) {
+		f.remaining[i], f.remaining[j] = f.remaining[j], f.remaining[i]
+	})
+}
+
+// addUnseen puts files that are neither shown nor queued in this round at
+// random positions of the bag.
+func (f *folder) addUnseen(paths []string) {
+	queued := make(map[string]bool, len(f.remaining))
+	for _, path := range f.remaining {
+		queued[path] = true
+	}
+	for _, path := range paths {
+		if queued[path] || f.shown[path] {
+			continue
+		}
+		queued[path] = true
+		i := rand.Intn(len(f.remaining) + 1)
+		f.remaining = append(f.remaining, "")
+		copy(f.remaining[i+1:], f.remaining[i:])
+		f.remaining[i] = path
+	}
+}
+
+func (f *folder) scan() []string {
+	var paths []string
+	for _, dir := range f.dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Printf("source %s: %v", f.name, err)
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if path != dir && !f.recursive {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if f.matches(path) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("source %s: scan %s: %v", f.name, dir, err)
+		}
+	}
+	return paths
+}
+
+func (f *folder) matches(path string) bool {
+	if !IsImageFile(path) {
+		return false
+	}
+	rel := path
+	for _, dir := range f.dirs {
+		if r, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+			break
+		}
+	}
+	if len(f.include) > 0 && !matchAny(f.include, rel) {
+		return false
+	}
+	return !matchAny(f.exclude, rel)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	base := filepath.Base(rel)
+	slashed := filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(filepath.ToSlash(pattern), slashed); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *folder) stateKey() string {
+	return "folder:" + f.name
+}
+
+func (f *folder) save() {
+	if f.env.State == nil {
+		return
+	}
+	saved := folderState{Remaining: f.remaining, Shown: make([]string, 0, len(f.shown))}
+	for path := range f.shown {
+		saved.Shown = append(saved.Shown, path)
+	}
+	if err := f.env.State.Put(f.stateKey(), saved); err != nil {
+		log.Printf("source %s: save rotation: %v", f.name, err)
+	}
+}
+
+func readImageFile(path string) (*Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := ReadImage(file, "")
+	if err != nil {
+		return nil, err
+	}
+	img.Meta.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	img.Meta.URL = path
+	return img, nil
+}
+
+func IsImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".bmp", ".gif", ".jpg", ".jpeg":
+		return true
+	default:
+		return false
+	}
+}
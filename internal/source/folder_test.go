@@ -0,0 +1,123 @@
+package source
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/state"
+)
+
+// newTestFolder writes the named images under dir and opens a folder source
+// on it.
+func newTestFolder(t *testing.T, cfg config.SourceConfig, store *state.Store, dir string, names ...string) *folder {
+	t.Helper()
+	data := testPNG(t)
+	for _, name := range names {
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(name)), data)
+	}
+	cfg.Name, cfg.Type, cfg.Dirs = "photos", config.SourceFolder, []string{dir}
+	f, err := newFolder(cfg, Env{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestFolderShuffleBag(t *testing.T) {
+	f := newTestFolder(t, config.SourceConfig{}, nil, t.TempDir(), "a.png", "b.png", "c.png", "d.png", "e.png")
+	want := []string{"a", "b", "c", "d", "e"}
+	for round := 0; round < 3; round++ {
+		if got := fetchTitles(t, f, len(want)); !slices.Equal(got, want) {
+			t.Errorf("round %d showed %v, want each image once", round, got)
+		}
+	}
+}
+
+func TestFolderRotationPersists(t *testing.T) {
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	f := newTestFolder(t, config.SourceConfig{}, store, dir, "a.png", "b.png", "c.png", "d.png", "e.png")
+	first := fetchTitles(t, f, 2)
+
+	// A restart finishes the round instead of starting over.
+	f = newTestFolder(t, config.SourceConfig{}, store, dir)
+	if len(f.remaining) != 3 {
+		t.Fatalf("restored %d queued images, want 3", len(f.remaining))
+	}
+	rest := fetchTitles(t, f, 3)
+	if got := sorted(append(first, rest...)); !slices.Equal(got, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("showed %v before and %v after the restart", first, rest)
+	}
+}
+
+func TestFolderGlobs(t *testing.T) {
+	names := []string{"a.png", "b.jpg", "notes.txt", "skip/c.png", "trip/d.png", "trip/deep/e.png"}
+	for _, tc := range []struct {
+		name string
+		cfg  config.SourceConfig
+		want []string
+	}{
+		{"top level", config.SourceConfig{}, []string{"a", "b"}},
+		{"recursive", config.SourceConfig{Recursive: true}, []string{"a", "b", "c", "d", "e"}},
+		{"include by name", config.SourceConfig{Recursive: true, Include: []string{"*.png"}}, []string{"a", "c", "d", "e"}},
+		{"exclude by path", config.SourceConfig{Recursive: true, Exclude: []string{"skip/*", "trip/deep/*"}}, []string{"a", "b", "d"}},
+		{"both", config.SourceConfig{Recursive: true, Include: []string{"trip/*"}, Exclude: []string{"d.*"}}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newTestFolder(t, tc.cfg, nil, t.TempDir(), names...)
+			if tc.want == nil {
+				if _, err := f.Fetch(context.Background()); err == nil {
+					t.Error("fetched an image nothing matches")
+				}
+				return
+			}
+			if got := fetchTitles(t, f, len(tc.want)); !slices.Equal(got, tc.want) {
+				t.Errorf("showed %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFolderWatch(t *testing.T) {
+	dir := t.TempDir()
+	f := newTestFolder(t, config.SourceConfig{Exclude: []string{"*.tmp.png"}}, nil, dir, "a.png", "b.png")
+	if f.watcher == nil {
+		t.Skip("no file watcher on this platform")
+	}
+	first := fetchTitles(t, f, 1)
+
+	// A new file joins the round in progress; an excluded one does not.
+	writeFile(t, filepath.Join(dir, "x.tmp.png"), testPNG(t))
+	writeFile(t, filepath.Join(dir, "c.png"), testPNG(t))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.mu.Lock()
+		queued := slices.Contains(f.remaining, filepath.Join(dir, "c.png"))
+		f.mu.Unlock()
+		if queued {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new file never queued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rest := fetchTitles(t, f, 2)
+	if got := sorted(append(first, rest...)); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("round showed %v then %v", first, rest)
+	}
+}
+
+func sorted(titles []string) []string {
+	sort.Strings(titles)
+	return titles
+}
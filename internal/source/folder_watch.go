@@ -0,0 +1,86 @@
+//go:build darwin || dragonfly || freebsd || openbsd || linux || netbsd || solaris || windows
+
+package source
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type watcher struct {
+	folder *folder
+	fs     *fsnotify.Watcher
+	done   chan struct{}
+}
+
+func newWatcher(f *folder) (*watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{folder: f, fs: fsw, done: make(chan struct{})}
+	for _, dir := range f.dirs {
+		w.addTree(dir)
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *watcher) close() error {
+	close(w.done)
+	return w.fs.Close()
+}
+
+func (w *watcher) addTree(dir string) {
+	if err := w.fs.Add(dir); err != nil {
+		log.Printf("source %s: watch %s: %v", w.folder.name, dir, err)
+		return
+	}
+	if !w.folder.recursive {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			w.addTree(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func (w *watcher) loop() {
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				if w.folder.recursive {
+					w.addTree(event.Name)
+				}
+				continue
+			}
+			w.folder.added(event.Name)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("source %s: watcher: %v", w.folder.name, err)
+		case <-w.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !openbsd && !linux && !netbsd && !solaris && !windows
+
+package source
+
+import "errors"
+
+type watcher struct{}
+
+func newWatcher(f *folder) (*watcher, error) {
+	return nil, errors.New("directory watching not supported on this platform")
+}
+
+func (w *watcher) close() error {
+	return nil
+}
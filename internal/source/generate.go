@@ -0,0 +1,109 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"log"
+	"strings"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/generative"
+	"yuluwallpaper/internal/overlay"
+	"yuluwallpaper/internal/sysinfo"
+)
+
+// fallbackWidth and fallbackHeight are used when the screen size cannot be
+// found and none is configured.
+const (
+	fallbackWidth  = 1920
+	fallbackHeight = 1080
+)
+
+// generate draws wallpapers locally, so it works without a network. The
+// seed is the date unless configured, giving one reproducible image a day.
+type generate struct {
+	name          string
+	style         string
+	seed          string
+	width, height int
+	// quote draws a saying chosen by the seed, with font.
+	quote bool
+	font  []byte
+}
+
+func newGenerate(cfg config.SourceConfig, env Env) (*generate, error) {
+	style := strings.ToLower(strings.TrimSpace(cfg.Style))
+	if style == "random" {
+		style = ""
+	}
+	if style != "" && !validStyle(style) {
+		return nil, fmt.Errorf("unknown style %q, want one of %s", cfg.Style, strings.Join(generative.Styles, ", "))
+	}
+	g := &generate{name: cfg.Name, style: style, seed: cfg.Seed, quote: cfg.Quote, font: env.Font}
+	if cfg.Resolution != "" {
+		if _, err := fmt.Sscanf(strings.ToLower(cfg.Resolution), "%dx%d", &g.width, &g.height); err != nil || g.width <= 0 || g.height <= 0 {
+			return nil, fmt.Errorf("invalid resolution %q, want WIDTHxHEIGHT", cfg.Resolution)
+		}
+	}
+	return g, nil
+}
+
+func (g *generate) Name() string {
+	return g.name
+}
+
+func (g *generate) Fetch(ctx context.Context) (*Image, error) {
+	width, height := g.size()
+	seed := g.seed
+	if seed == "" || seed == "date" {
+		seed = time.Now().Format("2006-01-02")
+	}
+	img, err := generative.Render(g.style, seed, width, height)
+	if err != nil {
+		return nil, err
+	}
+	title := g.style
+	if title == "" {
+		title = "generated"
+	}
+	meta := Metadata{Title: title + " " + seed}
+	if g.quote {
+		saying := overlay.PickSaying(seed)
+		if withQuote, err := overlay.Quote(img, g.font, saying.Text, saying.Author); err == nil {
+			img, meta = withQuote, Metadata{Title: saying.Text, Author: saying.Author, Drawn: true}
+		} else {
+			log.Printf("source %s: quote: %v", g.name, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &Image{
+		Data:        buf.Bytes(),
+		ContentType: "image/png",
+		Meta:        meta,
+	}, nil
+}
+
+func (g *generate) size() (int, int) {
+	if g.width > 0 {
+		return g.width, g.height
+	}
+	if width, height, err := sysinfo.ScreenSize(); err == nil && width > 0 && height > 0 {
+		return width, height
+	}
+	return fallbackWidth, fallbackHeight
+}
+
+func validStyle(style string) bool {
+	for _, s := range generative.Styles {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/overlay"
+)
+
+func TestGenerateQuote(t *testing.T) {
+	cfg := config.SourceConfig{Name: "gen", Type: config.SourceGenerate, Style: "gradient", Seed: "2024-02-10", Resolution: "320x180"}
+	plain, err := New(cfg, Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Quote = true
+	quoted, err := New(cfg, Env{Font: goregular.TTF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noFont, err := New(cfg, Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := plain.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Meta.Title != "gradient 2024-02-10" {
+		t.Errorf("title %q", a.Meta.Title)
+	}
+	b, err := quoted.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saying := overlay.PickSaying("2024-02-10")
+	if b.Meta.Title != saying.Text || b.Meta.Author != saying.Author {
+		t.Errorf("meta %+v, want %+v", b.Meta, saying)
+	}
+	if bytes.Equal(a.Data, b.Data) {
+		t.Error("quote not drawn")
+	}
+	// Without a font the plain image is still returned.
+	c, err := noFont.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Data, c.Data) {
+		t.Error("image without font differs from plain image")
+	}
+}
@@ -0,0 +1,88 @@
+package source
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SignatureHeader carries a base64 ed25519 signature over the image bytes.
+const SignatureHeader = "X-Signature-Ed25519"
+
+// Integrity says how a downloaded image must be vouched for. A digest sent
+// by the server is always checked; these options make checks mandatory.
+type Integrity struct {
+	PublicKey     ed25519.PublicKey
+	RequireDigest bool
+}
+
+func parsePublicKey(value string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("public_key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// verify rejects data that does not match the digest or signature headers
+// of its response.
+func (in Integrity) verify(header http.Header, data []byte) error {
+	want, ok, err := responseDigest(header)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if sum := sha256.Sum256(data); !bytes.Equal(sum[:], want) {
+			return errors.New("image does not match its SHA-256 digest")
+		}
+	} else if in.RequireDigest {
+		return errors.New("image has no SHA-256 digest header")
+	}
+
+	if in.PublicKey != nil {
+		value := header.Get(SignatureHeader)
+		if value == "" {
+			return errors.New("image is not signed")
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid signature header: %w", err)
+		}
+		if !ed25519.Verify(in.PublicKey, data, sig) {
+			return errors.New("image signature does not verify")
+		}
+	}
+	return nil
+}
+
+// responseDigest reads a SHA-256 digest from Content-Digest (RFC 9530),
+// Digest (RFC 3230) or X-Content-SHA256 (hex).
+func responseDigest(header http.Header) ([]byte, bool, error) {
+	for _, name := range []string{"Content-Digest", "Digest"} {
+		for _, part := range strings.Split(header.Get(name), ",") {
+			algo, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok || !strings.EqualFold(algo, "sha-256") {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":"))
+			if err != nil || len(raw) != sha256.Size {
+				return nil, false, fmt.Errorf("invalid %s header", name)
+			}
+			return raw, true, nil
+		}
+	}
+	if value := header.Get("X-Content-SHA256"); value != "" {
+		raw, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(raw) != sha256.Size {
+			return nil, false, errors.New("invalid X-Content-SHA256 header")
+		}
+		return raw, true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,96 @@
+package source
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResponseDigest(t *testing.T) {
+	data := []byte("image bytes")
+	sum := sha256.Sum256(data)
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, tc := range []struct {
+		name, header, value string
+		ok, fails           bool
+	}{
+		{"content-digest", "Content-Digest", "sha-512=:abc:, sha-256=:" + b64 + ":", true, false},
+		{"digest", "Digest", "SHA-256=" + b64, true, false},
+		{"hex", "X-Content-SHA256", hex.EncodeToString(sum[:]), true, false},
+		{"other algorithm only", "Content-Digest", "sha-512=:abc:", false, false},
+		{"bad base64", "Content-Digest", "sha-256=:!!:", false, true},
+		{"short hex", "X-Content-SHA256", "abcd", false, true},
+	} {
+		header := http.Header{}
+		header.Set(tc.header, tc.value)
+		got, ok, err := responseDigest(header)
+		if (err != nil) != tc.fails || ok != tc.ok || ok && string(got) != string(sum[:]) {
+			t.Errorf("%s: digest %x, ok %v, err %v", tc.name, got, ok, err)
+		}
+	}
+}
+
+func TestIntegrityVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("image bytes")
+	sum := sha256.Sum256(data)
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+
+	headers := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+	for _, tc := range []struct {
+		name      string
+		integrity Integrity
+		header    http.Header
+		data      []byte
+		err       string
+	}{
+		{"no checks", Integrity{}, headers(), data, ""},
+		{"matching digest", Integrity{}, headers("Content-Digest", digest), data, ""},
+		{"tampered body", Integrity{}, headers("Content-Digest", digest), []byte("image bytez"), "does not match"},
+		{"required digest", Integrity{RequireDigest: true}, headers("Content-Digest", digest), data, ""},
+		{"missing required digest", Integrity{RequireDigest: true}, headers(), data, "no SHA-256 digest"},
+		{"signed", Integrity{PublicKey: pub}, headers(SignatureHeader, signature), data, ""},
+		{"unsigned", Integrity{PublicKey: pub}, headers(), data, "not signed"},
+		{"signature not base64", Integrity{PublicKey: pub}, headers(SignatureHeader, "!!"), data, "invalid signature"},
+		{"signed by another key", Integrity{PublicKey: pub}, headers(SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, data))), data, "does not verify"},
+		{"wrong public key", Integrity{PublicKey: otherPub}, headers(SignatureHeader, signature), data, "does not verify"},
+		{"signature over other bytes", Integrity{PublicKey: pub}, headers(SignatureHeader, signature), []byte("image bytez"), "does not verify"},
+	} {
+		err := tc.integrity.verify(tc.header, tc.data)
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: err %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parsePublicKey(" " + base64.StdEncoding.EncodeToString(pub) + "\n"); err != nil || !got.Equal(pub) {
+		t.Errorf("parsePublicKey = %x, %v", got, err)
+	}
+	if _, err := parsePublicKey(base64.StdEncoding.EncodeToString(pub[:16])); err == nil {
+		t.Error("short key accepted")
+	}
+}
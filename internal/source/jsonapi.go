@@ -0,0 +1,198 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+// jsonAPI asks an API for a JSON document, picks an image URL out of it
+// with a path expression and downloads the image.
+type jsonAPI struct {
+	name   string
+	url    string
+	header http.Header
+	query  *template.Template
+	image  []pathStep
+	meta   map[string][]pathStep
+	env    Env
+}
+
+// queryData is what the query template can refer to.
+type queryData struct {
+	Date      string
+	Timestamp int64
+}
+
+func (queryData) Random(min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + rand.Intn(max-min+1)
+}
+
+func newJSONAPI(cfg config.SourceConfig, env Env) (*jsonAPI, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("json source needs a url")
+	}
+	if cfg.ImagePath == "" {
+		return nil, errors.New("json source needs an image_path")
+	}
+	api := &jsonAPI{
+		name:   cfg.Name,
+		url:    cfg.URL,
+		header: make(http.Header),
+		meta:   make(map[string][]pathStep),
+		env:    env,
+	}
+	for key, value := range cfg.Headers {
+		api.header.Set(key, value)
+	}
+	if cfg.Query != "" {
+		tmpl, err := template.New(cfg.Name).Parse(cfg.Query)
+		if err != nil {
+			return nil, fmt.Errorf("query template: %w", err)
+		}
+		api.query = tmpl
+	}
+
+	var err error
+	if api.image, err = parsePath(cfg.ImagePath); err != nil {
+		return nil, err
+	}
+	for field, path := range map[string]string{"title": cfg.TitlePath, "author": cfg.AuthorPath, "copyright": cfg.CopyrightPath} {
+		if path == "" {
+			continue
+		}
+		if api.meta[field], err = parsePath(path); err != nil {
+			return nil, err
+		}
+	}
+	return api, nil
+}
+
+func (api *jsonAPI) Name() string {
+	return api.name
+}
+
+func (api *jsonAPI) Fetch(ctx context.Context) (*Image, error) {
+	endpoint, err := api.requestURL()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = api.header.Clone()
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	resp, err := api.env.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var doc any
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+
+	urls := evalPath(doc, api.image)
+	if len(urls) == 0 {
+		return nil, errors.New("image_path matched nothing")
+	}
+	pick := rand.Intn(len(urls))
+	imageURL, err := resolveURL(endpoint, stringValue(urls[pick]))
+	if err != nil {
+		return nil, err
+	}
+
+	// The configured headers often carry API keys; images served from
+	// another host, such as a CDN, must not receive them.
+	var header http.Header
+	if sameOrigin(imageURL, endpoint) {
+		header = api.header
+	}
+	img, err := Download(ctx, api.env.Client, imageURL, header)
+	if err != nil {
+		return nil, err
+	}
+	img.Meta.URL = imageURL
+	img.Meta.Title = api.metaValue(doc, "title", pick, len(urls))
+	img.Meta.Author = api.metaValue(doc, "author", pick, len(urls))
+	img.Meta.Copyright = api.metaValue(doc, "copyright", pick, len(urls))
+	return img, nil
+}
+
+// metaValue extracts a metadata field. When the field path yields as many
+// values as the image path, the value at the picked image's index is used.
+func (api *jsonAPI) metaValue(doc any, field string, pick, count int) string {
+	steps, ok := api.meta[field]
+	if !ok {
+		return ""
+	}
+	values := evalPath(doc, steps)
+	switch {
+	case len(values) == 0:
+		return ""
+	case len(values) == count:
+		return stringValue(values[pick])
+	default:
+		return stringValue(values[0])
+	}
+}
+
+func (api *jsonAPI) requestURL() (string, error) {
+	if api.query == nil {
+		return api.url, nil
+	}
+	var buf bytes.Buffer
+	now := time.Now()
+	if err := api.query.Execute(&buf, queryData{Date: now.Format("2006-01-02"), Timestamp: now.Unix()}); err != nil {
+		return "", fmt.Errorf("query template: %w", err)
+	}
+	u, err := url.Parse(api.url)
+	if err != nil {
+		return "", err
+	}
+	extra, err := url.ParseQuery(strings.TrimPrefix(buf.String(), "?"))
+	if err != nil {
+		return "", fmt.Errorf("query template: %w", err)
+	}
+	query := u.Query()
+	for key, values := range extra {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func resolveURL(base, ref string) (string, error) {
+	if ref == "" {
+		return "", errors.New("empty image url")
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return baseURL.ResolveReference(refURL).String(), nil
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"yuluwallpaper/internal/config"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestJSONAPIHeadersStayOnAPIHost(t *testing.T) {
+	data := testPNG(t)
+	var cdnAuth, apiAuth, sameHostAuth string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	defer cdn.Close()
+	mux := http.NewServeMux()
+	api := httptest.NewServer(mux)
+	defer api.Close()
+	mux.HandleFunc("/cdn", func(w http.ResponseWriter, r *http.Request) {
+		apiAuth = r.Header.Get("Authorization")
+		fmt.Fprintf(w, `{"url": %q}`, cdn.URL+"/a.png")
+	})
+	mux.HandleFunc("/local", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"url": "/img.png"}`)
+	})
+	mux.HandleFunc("/img.png", func(w http.ResponseWriter, r *http.Request) {
+		sameHostAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	})
+
+	for _, path := range []string{"/cdn", "/local"} {
+		src, err := newJSONAPI(config.SourceConfig{
+			Name:      "api",
+			URL:       api.URL + path,
+			ImagePath: "url",
+			Headers:   map[string]string{"Authorization": "Bearer secret"},
+		}, Env{Client: api.Client()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := src.Fetch(context.Background()); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	if apiAuth != "Bearer secret" {
+		t.Errorf("API request Authorization = %q, want the configured header", apiAuth)
+	}
+	if cdnAuth != "" {
+		t.Errorf("image host on another origin received Authorization %q", cdnAuth)
+	}
+	if sameHostAuth != "Bearer secret" {
+		t.Errorf("image on the API origin got Authorization %q, want the configured header", sameHostAuth)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://api.example.com/v1", "https://api.example.com/img.jpg", true},
+		{"https://api.example.com/v1", "https://api.example.com:443/img.jpg", true},
+		{"https://api.example.com/v1", "http://api.example.com/img.jpg", false},
+		{"https://api.example.com/v1", "https://cdn.example.com/img.jpg", false},
+		{"http://127.0.0.1:8080/", "http://127.0.0.1:8081/", false},
+	}
+	for _, tt := range tests {
+		if got := sameOrigin(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameOrigin(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package source
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type pathStep struct {
+	key      string
+	index    int
+	wildcard bool
+	isIndex  bool
+}
+
+// parsePath reads a small JSON path dialect: dotted keys with optional
+// [n] or [*] subscripts, e.g. "data.items[*].url". A leading "$." is
+// accepted and ignored.
+func parsePath(path string) ([]pathStep, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, nil
+	}
+	var steps []pathStep
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key != "" {
+			steps = append(steps, pathStep{key: key})
+		}
+		for rest != "" {
+			sub, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("unclosed [ in %q", path)
+			}
+			if sub == "*" {
+				steps = append(steps, pathStep{wildcard: true, isIndex: true})
+			} else {
+				n, err := strconv.Atoi(sub)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in %q", sub, path)
+				}
+				steps = append(steps, pathStep{index: n, isIndex: true})
+			}
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return steps, nil
+}
+
+// evalPath returns every value the path selects from a decoded JSON
+// document.
+func evalPath(doc any, steps []pathStep) []any {
+	values := []any{doc}
+	for _, step := range steps {
+		var next []any
+		for _, value := range values {
+			switch {
+			case !step.isIndex:
+				if obj, ok := value.(map[string]any); ok {
+					if v, ok := obj[step.key]; ok {
+						next = append(next, v)
+					}
+				}
+			case step.wildcard:
+				switch v := value.(type) {
+				case []any:
+					next = append(next, v...)
+				case map[string]any:
+					for _, item := range v {
+						next = append(next, item)
+					}
+				}
+			default:
+				if arr, ok := value.([]any); ok {
+					i := step.index
+					if i < 0 {
+						i += len(arr)
+					}
+					if i >= 0 && i < len(arr) {
+						next = append(next, arr[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
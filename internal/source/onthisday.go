@@ -0,0 +1,264 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/exif"
+)
+
+// photoIndexTTL is how often the library is walked for changes.
+const photoIndexTTL = time.Hour
+
+// onThisDay shows photos from a local library that were taken on today's
+// month and day in earlier years. The library is indexed by EXIF
+// DateTimeOriginal, falling back to the modification time; the index is
+// kept in the cache directory and only files that changed are read again.
+type onThisDay struct {
+	name      string
+	dirs      []string
+	recursive bool
+	include   []string
+	exclude   []string
+	indexPath string
+	env       Env
+
+	mu      sync.Mutex
+	index   map[string]photoEntry
+	scanned time.Time
+	last    string
+}
+
+type photoEntry struct {
+	ModTime     int64  `json:"mtime"`
+	Size        int64  `json:"size"`
+	Taken       string `json:"taken"`
+	Orientation int    `json:"orientation,omitempty"`
+}
+
+type photoIndex struct {
+	Scanned time.Time             `json:"scanned"`
+	Photos  map[string]photoEntry `json:"photos"`
+}
+
+func newOnThisDay(cfg config.SourceConfig, env Env) (*onThisDay, error) {
+	if len(cfg.Dirs) == 0 {
+		return nil, errors.New("on-this-day source needs at least one directory")
+	}
+	o := &onThisDay{
+		name:      cfg.Name,
+		dirs:      cfg.Dirs,
+		recursive: cfg.Recursive,
+		include:   cfg.Include,
+		exclude:   cfg.Exclude,
+		env:       env,
+		index:     make(map[string]photoEntry),
+	}
+	if env.CacheDir != "" {
+		o.indexPath = filepath.Join(env.CacheDir, "onthisday", cfg.Name+".json")
+		o.load()
+	}
+	return o, nil
+}
+
+func (o *onThisDay) Name() string {
+	return o.name
+}
+
+func (o *onThisDay) Fetch(ctx context.Context) (*Image, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if time.Since(o.scanned) >= photoIndexTTL {
+		o.rescan(ctx)
+	}
+
+	now := time.Now()
+	var matches []string
+	for path, entry := range o.index {
+		taken, err := time.ParseInLocation("2006-01-02", entry.Taken, time.Local)
+		if err != nil {
+			continue
+		}
+		if taken.Month() == now.Month() && taken.Day() == now.Day() && taken.Year() < now.Year() {
+			matches = append(matches, path)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no photos taken on %s in earlier years", now.Format("01-02"))
+	}
+
+	rand.Shuffle(len(matches), func(i, j int) { matches[i], matches[j] = matches[j], matches[i] })
+	if len(matches) > 1 && matches[0] == o.last {
+		matches[0], matches[1] = matches[1], matches[0]
+	}
+	for _, path := range matches {
+		img, err := o.read(path, o.index[path])
+		if err != nil {
+			log.Printf("source %s: skipping %s: %v", o.name, path, err)
+			continue
+		}
+		o.last = path
+		return img, nil
+	}
+	return nil, errors.New("no readable photos for today")
+}
+
+// rescan walks the library, reading EXIF only for new or changed files.
+func (o *onThisDay) rescan(ctx context.Context) {
+	seen := make(map[string]bool, len(o.index))
+	read := 0
+	for _, dir := range o.dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if path != dir && !o.recursive {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !o.matches(dir, path) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			seen[path] = true
+			if old, ok := o.index[path]; ok && old.ModTime == info.ModTime().UnixNano() && old.Size == info.Size() {
+				return nil
+			}
+			o.index[path] = indexPhoto(path, info)
+			read++
+			return nil
+		})
+		if err != nil {
+			log.Printf("source %s: scan %s: %v", o.name, dir, err)
+			if ctx.Err() != nil {
+				// Keep the partial index but scan again next time.
+				return
+			}
+		}
+	}
+	removed := 0
+	for path := range o.index {
+		if !seen[path] {
+			delete(o.index, path)
+			removed++
+		}
+	}
+	o.scanned = time.Now()
+	if read > 0 || removed > 0 {
+		log.Printf("source %s: indexed %d new or changed photos, dropped %d", o.name, read, removed)
+	}
+	o.save()
+}
+
+func indexPhoto(path string, info fs.FileInfo) photoEntry {
+	entry := photoEntry{ModTime: info.ModTime().UnixNano(), Size: info.Size(), Orientation: 1}
+	taken := info.ModTime()
+	if file, err := os.Open(path); err == nil {
+		if meta, err := exif.Read(file); err == nil {
+			if !meta.Taken.IsZero() {
+				taken = meta.Taken
+			}
+			entry.Orientation = meta.Orientation
+		}
+		file.Close()
+	}
+	entry.Taken = taken.Format("2006-01-02")
+	return entry
+}
+
+func (o *onThisDay) matches(dir, path string) bool {
+	if !IsImageFile(path) {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = path
+	}
+	if len(o.include) > 0 && !matchAny(o.include, rel) {
+		return false
+	}
+	return !matchAny(o.exclude, rel)
+}
+
+// read loads the photo and turns it upright if its EXIF data asks for it.
+func (o *onThisDay) read(path string, entry photoEntry) (*Image, error) {
+	img, err := readImageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Orientation > 1 {
+		decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, exif.Orient(decoded, entry.Orientation), &jpeg.Options{Quality: 92}); err != nil {
+			return nil, err
+		}
+		img.Data, img.ContentType = buf.Bytes(), "image/jpeg"
+	}
+	year := strings.SplitN(entry.Taken, "-", 2)[0]
+	img.Meta.Title = fmt.Sprintf("%s (%s)", img.Meta.Title, year)
+	return img, nil
+}
+
+func (o *onThisDay) load() {
+	data, err := os.ReadFile(o.indexPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("source %s: read index: %v", o.name, err)
+		}
+		return
+	}
+	var saved photoIndex
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("source %s: index is corrupt, rebuilding: %v", o.name, err)
+		return
+	}
+	if saved.Photos != nil {
+		o.index = saved.Photos
+	}
+	o.scanned = saved.Scanned
+}
+
+func (o *onThisDay) save() {
+	if o.indexPath == "" {
+		return
+	}
+	data, err := json.Marshal(photoIndex{Scanned: o.scanned, Photos: o.index})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(o.indexPath), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(o.indexPath, data, 0o644)
+	}
+	if err != nil {
+		log.Printf("source %s: save index: %v", o.name, err)
+	}
+}
@@ -0,0 +1,189 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+// photoJPEG is a w×h photo with a red top-left block, carrying EXIF data
+// with the given orientation and, unless taken is zero, DateTimeOriginal.
+func photoJPEG(t *testing.T, w, h, orientation int, taken time.Time) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 8 && y < 8 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	jpg := buf.Bytes()
+
+	// Big-endian TIFF: IFD0 with Orientation and the Exif IFD pointer,
+	// then the Exif IFD with DateTimeOriginal.
+	order := binary.BigEndian
+	tiff := make([]byte, 76)
+	copy(tiff, "MM")
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], uint16(orientation))
+	order.PutUint16(tiff[22:], 0x8769)
+	order.PutUint16(tiff[24:], 4)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint32(tiff[30:], 38)
+	if !taken.IsZero() {
+		order.PutUint16(tiff[38:], 1)
+		order.PutUint16(tiff[40:], 0x9003)
+		order.PutUint16(tiff[42:], 2)
+		order.PutUint32(tiff[44:], 20)
+		order.PutUint32(tiff[48:], 56)
+		copy(tiff[56:], taken.Format("2006:01:02 15:04:05"))
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = order.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestOnThisDay(t *testing.T, dir, cacheDir string) *onThisDay {
+	t.Helper()
+	o, err := newOnThisDay(config.SourceConfig{Name: "memories", Type: config.SourceOnThisDay, Dirs: []string{dir}}, Env{CacheDir: cacheDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestOnThisDayRescan(t *testing.T) {
+	dir, cacheDir := t.TempDir(), t.TempDir()
+	a, b := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg")
+	july := time.Date(2019, 7, 4, 18, 30, 0, 0, time.Local)
+	writeFile(t, a, photoJPEG(t, 16, 16, 1, july))
+	writeFile(t, b, photoJPEG(t, 16, 16, 1, time.Time{}))
+	march := time.Date(2018, 3, 1, 9, 0, 0, 0, time.Local)
+	if err := os.Chtimes(b, march, march); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "sub", "c.jpg"), photoJPEG(t, 16, 16, 1, july))
+	writeFile(t, filepath.Join(dir, "notes.txt"), []byte("not a photo"))
+
+	o := newTestOnThisDay(t, dir, cacheDir)
+	o.rescan(context.Background())
+	taken := func(path string) string { return o.index[path].Taken }
+	if len(o.index) != 2 || taken(a) != "2019-07-04" || taken(b) != "2018-03-01" {
+		t.Fatalf("index %+v, want a by its EXIF date and b by its modification time", o.index)
+	}
+
+	// Same size and modification time: the file is not read again, even
+	// though its EXIF date changed.
+	stat, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, a, photoJPEG(t, 16, 16, 1, july.AddDate(1, 0, 0)))
+	if err := os.Chtimes(a, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	o.rescan(context.Background())
+	if taken(a) != "2019-07-04" {
+		t.Errorf("unchanged file read again: taken %s", taken(a))
+	}
+
+	// A new modification time means the file is read again.
+	later := stat.ModTime().Add(time.Minute)
+	if err := os.Chtimes(a, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	o.rescan(context.Background())
+	if taken(a) != "2020-07-04" {
+		t.Errorf("changed file not read again: taken %s", taken(a))
+	}
+	if _, ok := o.index[b]; ok || len(o.index) != 1 {
+		t.Errorf("deleted file still indexed: %+v", o.index)
+	}
+
+	// The index is kept in the cache directory for the next run.
+	again := newTestOnThisDay(t, dir, cacheDir)
+	if len(again.index) != 1 || again.index[a].Taken != "2020-07-04" || !again.scanned.Equal(o.scanned) {
+		t.Errorf("reloaded index %+v scanned %s", again.index, again.scanned)
+	}
+}
+
+func TestOnThisDayFetch(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	// Four years back, so the date exists even on 29 February.
+	today := time.Date(now.Year()-4, now.Month(), now.Day(), 12, 0, 0, 0, time.Local)
+	writeFile(t, filepath.Join(dir, "today.jpg"), photoJPEG(t, 32, 16, 6, today))
+	writeFile(t, filepath.Join(dir, "yesterday.jpg"), photoJPEG(t, 32, 16, 1, today.AddDate(0, 0, -1)))
+	writeFile(t, filepath.Join(dir, "this-year.jpg"), photoJPEG(t, 32, 16, 1, now))
+
+	o := newTestOnThisDay(t, dir, "")
+	for i := 0; i < 3; i++ {
+		img, err := o.Fetch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "(" + today.Format("2006") + ")"; !strings.HasSuffix(img.Meta.Title, want) || !strings.HasPrefix(img.Meta.Title, "today") {
+			t.Errorf("title %q, want today's photo from %s", img.Meta.Title, want)
+		}
+		// Orientation 6 turns the 32×16 photo upright, 16×32, with its
+		// red top-left block at the top right.
+		decoded, _, err := image.Decode(bytes.NewReader(img.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := decoded.Bounds(); b.Dx() != 16 || b.Dy() != 32 {
+			t.Errorf("%dx%d, want 16x32", b.Dx(), b.Dy())
+		}
+		if r, _, bl, _ := decoded.At(12, 3).RGBA(); r < 0xc000 || bl > 0x4000 {
+			t.Errorf("top right is not red")
+		}
+		if r, _, _, _ := decoded.At(3, 3).RGBA(); r > 0x4000 {
+			t.Errorf("top left is red, the photo was not rotated")
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "today.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	o.rescan(context.Background())
+	if _, err := o.Fetch(context.Background()); err == nil {
+		t.Error("fetched a photo on a day without any")
+	}
+}
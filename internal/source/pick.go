@@ -0,0 +1,54 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+)
+
+// maxPicks caps the images one Fetch tries, so an outage costs a few
+// requests instead of one per image in the collection.
+const maxPicks = 3
+
+var errNoImages = errors.New("no images found")
+
+// pick tries random items not yet in used, starting a new round once every
+// item has been shown, and returns the first image get delivers with used
+// extended by its key. Failed items stay unused, so an outage does not use
+// up the round.
+func pick[T any](ctx context.Context, name string, items []T, used []string, key func(T) string, get func(T) (*Image, error)) (*Image, []string, error) {
+	if len(items) == 0 {
+		return nil, used, errNoImages
+	}
+	seen := make(map[string]bool, len(used))
+	for _, k := range used {
+		seen[k] = true
+	}
+	var unused []T
+	for _, item := range items {
+		if !seen[key(item)] {
+			unused = append(unused, item)
+		}
+	}
+	if len(unused) == 0 {
+		used = nil
+		unused = append(unused, items...)
+	}
+
+	rand.Shuffle(len(unused), func(i, j int) { unused[i], unused[j] = unused[j], unused[i] })
+	var lastErr error
+	for _, item := range unused[:min(len(unused), maxPicks)] {
+		if err := ctx.Err(); err != nil {
+			return nil, used, err
+		}
+		img, err := get(item)
+		if err != nil {
+			log.Printf("source %s: skipping %s: %v", name, key(item), err)
+			lastErr = err
+			continue
+		}
+		return img, append(used, key(item)), nil
+	}
+	return nil, used, lastErr
+}
@@ -0,0 +1,84 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPickRounds(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	key := func(s string) string { return s }
+	get := func(s string) (*Image, error) { return &Image{Meta: Metadata{Title: s}}, nil }
+
+	var used []string
+	var shown []string
+	for i := 0; i < 6; i++ {
+		img, u, err := pick(context.Background(), "test", items, used, key, get)
+		if err != nil {
+			t.Fatal(err)
+		}
+		used = u
+		shown = append(shown, img.Meta.Title)
+	}
+	// Every item is shown once before any repeats.
+	for _, round := range [][]string{shown[:3], shown[3:]} {
+		sorted := slices.Clone(round)
+		slices.Sort(sorted)
+		if strings.Join(sorted, ",") != "a,b,c" {
+			t.Errorf("round %v does not show each item once", round)
+		}
+	}
+	if len(used) != 3 {
+		t.Errorf("used %v after two full rounds", used)
+	}
+	if _, _, err := pick(context.Background(), "test", nil, nil, key, get); !errors.Is(err, errNoImages) {
+		t.Errorf("no items: err %v", err)
+	}
+}
+
+func TestPickOutage(t *testing.T) {
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = string(rune('A' + i))
+	}
+	failure := errors.New("connection refused")
+	tries := 0
+	get := func(string) (*Image, error) {
+		tries++
+		return nil, failure
+	}
+	used := []string{"A"}
+	_, got, err := pick(context.Background(), "test", items, used, func(s string) string { return s }, get)
+	if !errors.Is(err, failure) || tries != maxPicks {
+		t.Errorf("err %v after %d tries, want %v after %d", err, tries, failure, maxPicks)
+	}
+	if !slices.Equal(got, used) {
+		t.Errorf("used %v after failures, want %v unchanged", got, used)
+	}
+
+	// A cancelled fetch stops trying.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tries = 0
+	if _, _, err := pick(ctx, "test", items, nil, func(s string) string { return s }, get); !errors.Is(err, context.Canceled) || tries != 0 {
+		t.Errorf("cancelled: err %v after %d tries", err, tries)
+	}
+}
+
+func TestPickSkipsBroken(t *testing.T) {
+	get := func(s string) (*Image, error) {
+		if s == "broken" {
+			return nil, errors.New("not an image")
+		}
+		return &Image{Meta: Metadata{Title: s}}, nil
+	}
+	for i := 0; i < 20; i++ {
+		img, used, err := pick(context.Background(), "test", []string{"broken", "good"}, nil, func(s string) string { return s }, get)
+		if err != nil || img.Meta.Title != "good" || !slices.Equal(used, []string{"good"}) {
+			t.Fatalf("got %v, used %v, err %v", img, used, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/sysinfo"
+)
+
+// defaultPluginTimeout bounds one plugin run when the config sets none.
+const defaultPluginTimeout = time.Minute
+
+// maxPluginOutput caps what is read from a plugin's stdout and stderr.
+const maxPluginOutput = 1 << 20
+
+// plugin runs an external program as a source. It gets a pluginRequest as
+// JSON on stdin and answers with a pluginReply as JSON on stdout, naming
+// either a local file or a URL to download.
+type plugin struct {
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+	env     Env
+}
+
+type pluginRequest struct {
+	Version  int          `json:"version"`
+	Source   string       `json:"source"`
+	Screen   pluginScreen `json:"screen"`
+	Locale   string       `json:"locale,omitempty"`
+	LastHash string       `json:"last_hash,omitempty"`
+}
+
+type pluginScreen struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type pluginReply struct {
+	Path      string `json:"path"`
+	URL       string `json:"url"`
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	Copyright string `json:"copyright"`
+	Error     string `json:"error"`
+}
+
+func newPlugin(cfg config.SourceConfig, env Env) (*plugin, error) {
+	if cfg.Command == "" {
+		return nil, errors.New("plugin source needs a command")
+	}
+	timeout := defaultPluginTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return &plugin{name: cfg.Name, command: cfg.Command, args: cfg.Args, timeout: timeout, env: env}, nil
+}
+
+func (p *plugin) Name() string {
+	return p.name
+}
+
+func (p *plugin) Fetch(ctx context.Context) (*Image, error) {
+	reply, err := p.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var img *Image
+	switch {
+	case reply.Path != "":
+		path := reply.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(p.command), path)
+		}
+		img, err = readImageFile(path)
+	case reply.URL != "":
+		img, err = Download(ctx, p.env.Client, reply.URL, nil)
+		if err == nil {
+			img.Meta.URL = reply.URL
+		}
+	default:
+		err = errors.New("plugin reply has neither path nor url")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reply.Title != "" {
+		img.Meta.Title = reply.Title
+	}
+	img.Meta.Author = reply.Author
+	img.Meta.Copyright = reply.Copyright
+
+	sum := sha256.Sum256(img.Data)
+	if p.env.State != nil {
+		if err := p.env.State.Put(p.stateKey(), hex.EncodeToString(sum[:])); err != nil {
+			log.Printf("source %s: save last hash: %v", p.name, err)
+		}
+	}
+	return img, nil
+}
+
+func (p *plugin) run(ctx context.Context) (pluginReply, error) {
+	input, err := json.Marshal(p.request())
+	if err != nil {
+		return pluginReply{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	configureCommand(cmd)
+	// Children the plugin started may keep its pipes open after it is
+	// killed; stop waiting for them shortly after.
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr limitedBuffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err = cmd.Run()
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		log.Printf("source %s: plugin stderr: %s", p.name, msg)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return pluginReply{}, fmt.Errorf("plugin %s timed out after %s", p.command, p.timeout)
+	}
+	if err != nil {
+		return pluginReply{}, fmt.Errorf("plugin %s: %w", p.command, err)
+	}
+
+	var reply pluginReply
+	if err := json.Unmarshal(stdout.Bytes(), &reply); err != nil {
+		return pluginReply{}, fmt.Errorf("plugin %s: invalid reply: %w", p.command, err)
+	}
+	if reply.Error != "" {
+		return pluginReply{}, fmt.Errorf("plugin %s: %s", p.command, reply.Error)
+	}
+	return reply, nil
+}
+
+func (p *plugin) request() pluginRequest {
+	req := pluginRequest{Version: 1, Source: p.name}
+	if width, height, err := sysinfo.ScreenSize(); err == nil {
+		req.Screen = pluginScreen{Width: width, Height: height}
+	}
+	req.Locale, _ = sysinfo.Locale()
+	if p.env.State != nil {
+		p.env.State.Get(p.stateKey(), &req.LastHash)
+	}
+	return req
+}
+
+func (p *plugin) stateKey() string {
+	return "plugin:" + p.name
+}
+
+// limitedBuffer keeps the first maxPluginOutput bytes written to it and
+// drops the rest, so a chatty plugin cannot exhaust memory.
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if room := maxPluginOutput - b.Len(); room > 0 {
+		if len(data) > room {
+			b.Buffer.Write(data[:room])
+		} else {
+			b.Buffer.Write(data)
+		}
+	}
+	return len(data), nil
+}
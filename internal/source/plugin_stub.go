@@ -0,0 +1,7 @@
+//go:build !windows
+
+package source
+
+import "os/exec"
+
+func configureCommand(cmd *exec.Cmd) {}
@@ -0,0 +1,182 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/state"
+)
+
+// pluginEnv makes the test binary act as a plugin, doing what its first
+// argument says.
+const pluginEnv = "YULU_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(pluginEnv) != "" {
+		os.Exit(runTestPlugin(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func runTestPlugin(args []string) int {
+	reply := func(v any) int {
+		json.NewEncoder(os.Stdout).Encode(v)
+		return 0
+	}
+	switch args[0] {
+	case "echo":
+		// Keep the request for the test, and answer with an image next to
+		// the plugin.
+		request, _ := io.ReadAll(os.Stdin)
+		os.WriteFile(args[1], request, 0o644)
+		fmt.Fprintln(os.Stderr, "picked image.png")
+		return reply(pluginReply{Path: "image.png", Title: "From plugin", Author: "Plug", Copyright: "CC0"})
+	case "url":
+		return reply(pluginReply{URL: args[1]})
+	case "error":
+		return reply(pluginReply{Error: "no photos today"})
+	case "garbage":
+		fmt.Print("not json")
+		return 0
+	case "fail":
+		fmt.Fprintln(os.Stderr, "something broke")
+		return 3
+	case "sleep":
+		time.Sleep(time.Minute)
+		return 0
+	}
+	return 2
+}
+
+// testPlugin returns a plugin source running the test binary through a link
+// in a fresh directory, which is where relative paths in replies point.
+func testPlugin(t *testing.T, timeout int, args ...string) (Source, string, *state.Store) {
+	t.Helper()
+	t.Setenv(pluginEnv, "1")
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	command := filepath.Join(dir, "plugin")
+	if err := os.Symlink(self, command); err != nil {
+		t.Skipf("cannot link the test binary: %v", err)
+	}
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := New(config.SourceConfig{Name: "plug", Type: config.SourcePlugin, Command: command, Args: args, TimeoutSeconds: timeout}, Env{Client: http.DefaultClient, State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src, dir, store
+}
+
+func TestPluginReply(t *testing.T) {
+	requestFile := filepath.Join(t.TempDir(), "request.json")
+	src, dir, _ := testPlugin(t, 0, "echo", requestFile)
+	data := testPNG(t)
+	if err := os.WriteFile(filepath.Join(dir, "image.png"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	readRequest := func() pluginRequest {
+		t.Helper()
+		raw, err := os.ReadFile(requestFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req pluginRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			t.Fatalf("request %q: %v", raw, err)
+		}
+		return req
+	}
+
+	img, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Data, data) || img.Meta != (Metadata{Title: "From plugin", Author: "Plug", Copyright: "CC0", URL: filepath.Join(dir, "image.png")}) {
+		t.Errorf("image of %d bytes with meta %+v", len(img.Data), img.Meta)
+	}
+	if req := readRequest(); req.Version != 1 || req.Source != "plug" || req.LastHash != "" {
+		t.Errorf("first request %+v", req)
+	}
+	if !strings.Contains(logs.String(), "source plug: plugin stderr: picked image.png") {
+		t.Errorf("stderr not logged:\n%s", logs.String())
+	}
+
+	// The next run is told what the last image was.
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if req := readRequest(); req.LastHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("last_hash %q, want the first image's", req.LastHash)
+	}
+}
+
+func TestPluginURLReply(t *testing.T) {
+	data := testPNG(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write(data) }))
+	defer srv.Close()
+	src, _, _ := testPlugin(t, 0, "url", srv.URL+"/photo.png")
+	img, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(img.Data, data) || img.Meta.URL != srv.URL+"/photo.png" {
+		t.Errorf("image of %d bytes, meta %+v", len(img.Data), img.Meta)
+	}
+}
+
+func TestPluginErrors(t *testing.T) {
+	for _, tc := range []struct {
+		mode, want string
+	}{
+		{"error", "no photos today"},
+		{"garbage", "invalid reply"},
+		{"fail", "exit status 3"},
+		{"echo", "image.png"}, // the reply names a file that is not there
+	} {
+		args := []string{tc.mode}
+		if tc.mode == "echo" {
+			args = append(args, filepath.Join(t.TempDir(), "request.json"))
+		}
+		src, _, _ := testPlugin(t, 0, args...)
+		if _, err := src.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err %v, want %q", tc.mode, err, tc.want)
+		}
+	}
+}
+
+func TestPluginTimeout(t *testing.T) {
+	src, _, _ := testPlugin(t, 1, "sleep")
+	start := time.Now()
+	_, err := src.Fetch(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("err %v, want a timeout", err)
+	}
+	if took := time.Since(start); took > 10*time.Second {
+		t.Errorf("took %s to give up", took)
+	}
+}
@@ -0,0 +1,253 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/secrets"
+)
+
+// s3ListTTL is how long a bucket listing is reused before listing again.
+const s3ListTTL = time.Hour
+
+// s3 rotates through the images under a prefix of an S3-compatible bucket.
+// Requests are signed with SigV4 when credentials are configured and sent
+// anonymously otherwise.
+type s3 struct {
+	name      string
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	pathStyle bool
+	include   []string
+	exclude   []string
+	cred      secrets.Credential
+	signed    bool
+	env       Env
+
+	mu sync.Mutex
+}
+
+type s3Object struct {
+	Key  string `json:"key"`
+	ETag string `json:"etag,omitempty"`
+}
+
+type s3State struct {
+	Objects []s3Object `json:"objects"`
+	Used    []string   `json:"used"`
+	Listed  time.Time  `json:"listed"`
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func newS3(cfg config.SourceConfig, env Env) (*s3, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 source needs a bucket")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := cfg.URL
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	src := &s3{
+		name:      cfg.Name,
+		endpoint:  u,
+		bucket:    cfg.Bucket,
+		prefix:    strings.TrimPrefix(cfg.Prefix, "/"),
+		region:    region,
+		pathStyle: cfg.PathStyle,
+		include:   cfg.Include,
+		exclude:   cfg.Exclude,
+		env:       env,
+	}
+	if cfg.Credentials != "" {
+		cred, ok := env.Secrets.Lookup(cfg.Credentials)
+		if !ok || cred.AccessKeyID == "" || cred.SecretAccessKey == "" {
+			return nil, fmt.Errorf("credentials %q need access_key_id and secret_access_key", cfg.Credentials)
+		}
+		src.cred, src.signed = cred, true
+	}
+	return src, nil
+}
+
+func (s *s3) Name() string {
+	return s.name
+}
+
+func (s *s3) Fetch(ctx context.Context) (*Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var st s3State
+	if s.env.State != nil {
+		s.env.State.Get(s.stateKey(), &st)
+	}
+	if len(st.Objects) == 0 || time.Since(st.Listed) >= s3ListTTL {
+		if err := s.updateListing(ctx, &st); err != nil {
+			if len(st.Objects) == 0 {
+				return nil, err
+			}
+			log.Printf("source %s: using cached listing: %v", s.name, err)
+		}
+	}
+
+	img, used, err := pick(ctx, s.name, st.Objects, st.Used,
+		func(obj s3Object) string { return obj.Key },
+		func(obj s3Object) (*Image, error) { return s.getObject(ctx, obj.Key) })
+	st.Used = used
+	s.save(st)
+	return img, err
+}
+
+func (s *s3) updateListing(ctx context.Context, st *s3State) error {
+	var objects []s3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if s.prefix != "" {
+			query.Set("prefix", s.prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, "", query)
+		if err != nil {
+			return err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(io.LimitReader(resp.Body, maxImageBytes)).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("list objects: %w", err)
+		}
+		for _, obj := range result.Contents {
+			if s.matches(obj.Key) {
+				objects = append(objects, s3Object{Key: obj.Key, ETag: obj.ETag})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	current := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		current[obj.Key] = true
+	}
+	var used []string
+	for _, key := range st.Used {
+		if current[key] {
+			used = append(used, key)
+		}
+	}
+	*st = s3State{Objects: objects, Used: used, Listed: time.Now()}
+	s.save(*st)
+	return nil
+}
+
+func (s *s3) matches(key string) bool {
+	if strings.HasSuffix(key, "/") || !IsImageFile(key) {
+		return false
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(key, s.prefix), "/")
+	if len(s.include) > 0 && !matchAny(s.include, rel) {
+		return false
+	}
+	return !matchAny(s.exclude, rel)
+}
+
+// getObject streams the object through the same checks as any download.
+func (s *s3) getObject(ctx context.Context, key string) (*Image, error) {
+	resp, err := s.do(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	img, err := ReadImage(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(key)
+	img.Meta = Metadata{Title: strings.TrimSuffix(name, path.Ext(name)), URL: "s3://" + s.bucket + "/" + key}
+	return img, nil
+}
+
+// do sends a signed GET for key, or for the bucket itself when key is
+// empty, and fails on anything but 200 OK.
+func (s *s3) do(ctx context.Context, key string, query url.Values) (*http.Response, error) {
+	u := *s.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		basePath += "/" + awsEscape(s.bucket, false)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	rawPath := basePath + "/" + awsEscape(key, true)
+	decoded, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, err
+	}
+	u.Path, u.RawPath = decoded, rawPath
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.signed {
+		signV4(req, s.cred.AccessKeyID, s.cred.SecretAccessKey, s.cred.SessionToken, s.region, "s3", time.Now())
+	}
+	resp, err := s.env.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+func (s *s3) stateKey() string {
+	return "s3:" + s.name
+}
+
+func (s *s3) save(st s3State) {
+	if s.env.State == nil {
+		return
+	}
+	if err := s.env.State.Put(s.stateKey(), st); err != nil {
+		log.Printf("source %s: save listing: %v", s.name, err)
+	}
+}
@@ -0,0 +1,202 @@
+package source
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/secrets"
+	"yuluwallpaper/internal/state"
+)
+
+// fakeS3 implements ListObjectsV2, two keys a page, and GetObject for one
+// bucket, addressed either way.
+type fakeS3 struct {
+	t         *testing.T
+	bucket    string
+	host      string
+	pathStyle bool
+	keys      []string
+	data      []byte
+
+	mu     sync.Mutex
+	tokens []string
+	gets   []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") != emptyPayloadHash {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	key := r.URL.Path
+	if f.pathStyle {
+		if r.Host != f.host {
+			f.t.Errorf("path-style request to host %s", r.Host)
+		}
+		var ok bool
+		if key, ok = strings.CutPrefix(key, "/"+f.bucket); !ok {
+			http.NotFound(w, r)
+			return
+		}
+	} else if r.Host != f.bucket+"."+f.host {
+		f.t.Errorf("virtual-host request to host %s", r.Host)
+	}
+	key = strings.TrimPrefix(key, "/")
+
+	if key != "" {
+		f.gets = append(f.gets, key)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(f.data)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		http.Error(w, "want ListObjectsV2", http.StatusBadRequest)
+		return
+	}
+	token := query.Get("continuation-token")
+	f.tokens = append(f.tokens, token)
+	start := 0
+	if token != "" {
+		start, _ = strconv.Atoi(strings.TrimPrefix(token, "page-"))
+	}
+	var matching []string
+	for _, k := range f.keys {
+		if strings.HasPrefix(k, query.Get("prefix")) {
+			matching = append(matching, k)
+		}
+	}
+	end := min(start+2, len(matching))
+	type object struct {
+		Key  string
+		ETag string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object `xml:"Contents"`
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{IsTruncated: end < len(matching)}
+	for _, k := range matching[start:end] {
+		result.Contents = append(result.Contents, object{Key: k, ETag: `"` + k + `"`})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = fmt.Sprintf("page-%d", end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// dialTo sends every connection to addr, whatever host the URL names, so
+// virtual-host URLs reach the test server.
+func dialTo(addr string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return &http.Client{Transport: transport}
+}
+
+func TestS3(t *testing.T) {
+	keys := []string{
+		"wallpapers/",
+		"wallpapers/a.jpg",
+		"wallpapers/notes.txt",
+		"wallpapers/春节 lanterns.png",
+		"wallpapers/sub/c+d.jpg",
+		"wallpapers/e.png",
+		"other/f.jpg",
+	}
+	want := []string{"wallpapers/a.jpg", "wallpapers/e.png", "wallpapers/sub/c+d.jpg", "wallpapers/春节 lanterns.png"}
+	for _, pathStyle := range []bool{true, false} {
+		t.Run(fmt.Sprintf("path_style=%v", pathStyle), func(t *testing.T) {
+			fake := &fakeS3{t: t, bucket: "photos", pathStyle: pathStyle, keys: keys, data: testPNG(t)}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+			_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+			fake.host = "s3.example.test:" + port
+
+			store, err := state.Open("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := Env{
+				Client:  dialTo(srv.Listener.Addr().String()),
+				State:   store,
+				Secrets: secrets.Store{"s3": {AccessKeyID: "AKID", SecretAccessKey: "secret"}},
+			}
+			src, err := New(config.SourceConfig{
+				Name:        "s3",
+				Type:        config.SourceS3,
+				URL:         "http://" + fake.host,
+				Bucket:      "photos",
+				Prefix:      "wallpapers/",
+				PathStyle:   pathStyle,
+				Credentials: "s3",
+			}, env)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for range want {
+				img, err := src.Fetch(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, strings.TrimPrefix(img.Meta.URL, "s3://photos/"))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "|") != strings.Join(want, "|") {
+				t.Errorf("fetched %q, want each of %q once", got, want)
+			}
+			// Keys reach the server exactly, spaces and all.
+			fetched := append([]string(nil), fake.gets...)
+			sort.Strings(fetched)
+			if strings.Join(fetched, "|") != strings.Join(want, "|") {
+				t.Errorf("server saw GETs %q", fetched)
+			}
+			// Six keys under the prefix take three pages, listed once.
+			if strings.Join(fake.tokens, ",") != ",page-2,page-4" {
+				t.Errorf("continuation tokens %q", fake.tokens)
+			}
+			// Once every image was used the rotation starts over.
+			if _, err := src.Fetch(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestS3Anonymous(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	src, err := New(config.SourceConfig{Name: "s3", Type: config.SourceS3, URL: srv.URL, Bucket: "photos", PathStyle: true}, Env{Client: srv.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("fetch = %v, want the 403", err)
+	}
+	if auth != "" {
+		t.Errorf("anonymous request sent Authorization %q", auth)
+	}
+}
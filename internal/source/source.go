@@ -0,0 +1,244 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/httpclient"
+	"yuluwallpaper/internal/secrets"
+	"yuluwallpaper/internal/state"
+)
+
+// maxImageBytes caps downloads so a misbehaving server cannot fill the disk.
+const maxImageBytes = 64 << 20
+
+// ErrNotModified means the server answered a conditional request with 304:
+// the image is the one this source returned last time.
+var ErrNotModified = errors.New("image not modified")
+
+type Metadata struct {
+	Title     string `json:"title,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Copyright string `json:"copyright,omitempty"`
+	URL       string `json:"url,omitempty"`
+	// Drawn means the title and author are already part of the image, as
+	// on quote cards, so no credit line is added.
+	Drawn bool `json:"drawn,omitempty"`
+}
+
+type Image struct {
+	Data        []byte
+	ContentType string
+	Meta        Metadata
+}
+
+// Ext returns the file extension matching the image format.
+func (img *Image) Ext() string {
+	return extensionFromContentType(img.ContentType)
+}
+
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) (*Image, error)
+}
+
+// Themed is implemented by sources that can ask for an image matching a
+// solar term or festival.
+type Themed interface {
+	FetchTheme(ctx context.Context, param, theme string) (*Image, error)
+}
+
+// Env holds what the service shares with every source.
+type Env struct {
+	Client  *http.Client
+	State   *state.Store
+	Secrets secrets.Store
+	// CacheDir is where sources may keep downloaded files between runs.
+	CacheDir string
+	// Proxy is what Client uses, for sources that need a client of their own.
+	Proxy httpclient.ProxyOptions
+	// Usage, if set, is told how many bytes each source downloads.
+	Usage func(source string, n int64)
+	// Font is the overlay font, for sources that draw text. It may be
+	// empty.
+	Font []byte
+}
+
+func New(cfg config.SourceConfig, env Env) (Source, error) {
+	if env.Client == nil || cfg.CABundle != "" || len(cfg.PinSHA256) > 0 {
+		client, err := httpclient.New(httpclient.Options{
+			Proxy: env.Proxy,
+			TLS:   httpclient.TLSOptions{CABundle: cfg.CABundle, Pins: cfg.PinSHA256},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", cfg.Name, err)
+		}
+		env.Client = client
+	}
+	if env.Usage != nil {
+		name, usage := cfg.Name, env.Usage
+		env.Client = httpclient.Counting(env.Client, func(n int64) { usage(name, n) })
+	}
+	switch cfg.Type {
+	case config.SourceYulu:
+		return newYulu(cfg, env)
+	case config.SourceFolder:
+		return newFolder(cfg, env)
+	case config.SourceJSON:
+		return newJSONAPI(cfg, env)
+	case config.SourceBing:
+		return newBing(cfg, env)
+	case config.SourceFeed:
+		return newFeed(cfg, env)
+	case config.SourceWebDAV:
+		return newWebDAV(cfg, env)
+	case config.SourceS3:
+		return newS3(cfg, env)
+	case config.SourcePlugin:
+		return newPlugin(cfg, env)
+	case config.SourceGenerate:
+		return newGenerate(cfg, env)
+	case config.SourceOnThisDay:
+		return newOnThisDay(cfg, env)
+	default:
+		return nil, fmt.Errorf("source %s: unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// Download fetches url and validates that the response is an image. A
+// digest header in the response is checked if present.
+func Download(ctx context.Context, client *http.Client, url string, header http.Header) (*Image, error) {
+	img, _, err := download(ctx, client, url, header, Integrity{})
+	return img, err
+}
+
+// download also returns the response header, for callers that keep cache
+// validators. A 304 answer yields ErrNotModified.
+func download(ctx context.Context, client *http.Client, url string, header http.Header, integrity Integrity) (*Image, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, resp.Header, ErrNotModified
+	default:
+		return nil, nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	img, err := ReadImage(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := integrity.verify(resp.Header, img.Data); err != nil {
+		return nil, nil, err
+	}
+	return img, resp.Header, nil
+}
+
+// sameOrigin reports whether a and b share scheme, host and port, so
+// credentials meant for one may be sent to the other.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Hostname(), ub.Hostname()) && originPort(ua) == originPort(ub)
+}
+
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+	return ""
+}
+
+// validators are the cache validators of the previous response, sent back
+// so that an unchanged image costs a 304 instead of a download.
+type validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func validatorsOf(header http.Header) validators {
+	return validators{ETag: header.Get("ETag"), LastModified: header.Get("Last-Modified")}
+}
+
+func (v validators) header() http.Header {
+	header := make(http.Header)
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+	return header
+}
+
+// ReadImage reads image data and checks that it really is an image, so an
+// HTML error page never ends up as the wallpaper.
+func ReadImage(r io.Reader, contentType string) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageBytes {
+		return nil, fmt.Errorf("image larger than %d MB", maxImageBytes>>20)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty image")
+	}
+	sniffed := http.DetectContentType(data)
+	if !strings.HasPrefix(sniffed, "image/") {
+		return nil, fmt.Errorf("not an image: %s", sniffed)
+	}
+	if extensionFromContentType(contentType) == "" {
+		contentType = sniffed
+	}
+	return &Image{Data: data, ContentType: contentType}, nil
+}
+
+func extensionFromContentType(contentType string) string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "image/png"):
+		return ".png"
+	case strings.Contains(contentType, "image/jpeg"):
+		return ".jpg"
+	case strings.Contains(contentType, "image/jpg"):
+		return ".jpg"
+	case strings.Contains(contentType, "image/bmp"):
+		return ".bmp"
+	case strings.Contains(contentType, "image/gif"):
+		return ".gif"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,346 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"yuluwallpaper/internal/config"
+)
+
+// webdavListTTL is how long a recursive listing is reused while the root
+// collection's ETag stays the same. Servers need not change that ETag when
+// something in a subfolder does.
+const webdavListTTL = time.Hour
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getetag/><d:getcontenttype/></d:prop></d:propfind>`
+
+// webdav rotates through the images of a remote WebDAV collection such as
+// a Nextcloud share. The listing is kept in the state store and only read
+// again when the collection's ETag changes, or, when subfolders are
+// included, after webdavListTTL; images are downloaded when picked and kept
+// in the cache directory until their ETag changes.
+type webdav struct {
+	name      string
+	url       *url.URL
+	recursive bool
+	include   []string
+	exclude   []string
+	header    http.Header
+	cacheDir  string
+	env       Env
+
+	mu sync.Mutex
+}
+
+type davFile struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel"`
+	ETag string `json:"etag,omitempty"`
+}
+
+type webdavState struct {
+	ETag   string            `json:"etag,omitempty"`
+	Listed time.Time         `json:"listed"`
+	Files  []davFile         `json:"files"`
+	Used   []string          `json:"used"`
+	Cached map[string]string `json:"cached,omitempty"`
+}
+
+func newWebDAV(cfg config.SourceConfig, env Env) (*webdav, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webdav source needs a url")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	d := &webdav{
+		name:      cfg.Name,
+		url:       u,
+		recursive: cfg.Recursive,
+		include:   cfg.Include,
+		exclude:   cfg.Exclude,
+		header:    make(http.Header),
+		env:       env,
+	}
+	if cfg.Credentials != "" {
+		cred, ok := env.Secrets.Lookup(cfg.Credentials)
+		if !ok {
+			return nil, fmt.Errorf("credentials %q not found in secrets", cfg.Credentials)
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Password))
+		d.header.Set("Authorization", "Basic "+auth)
+	}
+	if env.CacheDir != "" {
+		d.cacheDir = filepath.Join(env.CacheDir, "webdav", cfg.Name)
+	}
+	return d, nil
+}
+
+func (d *webdav) Name() string {
+	return d.name
+}
+
+func (d *webdav) Fetch(ctx context.Context) (*Image, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var st webdavState
+	if d.env.State != nil {
+		d.env.State.Get(d.stateKey(), &st)
+	}
+	if err := d.updateListing(ctx, &st); err != nil {
+		if len(st.Files) == 0 {
+			return nil, err
+		}
+		log.Printf("source %s: using cached listing: %v", d.name, err)
+	}
+
+	img, used, err := pick(ctx, d.name, st.Files, st.Used,
+		func(file davFile) string { return file.Href },
+		func(file davFile) (*Image, error) { return d.image(ctx, file, &st) })
+	st.Used = used
+	d.save(st)
+	return img, err
+}
+
+// updateListing lists the collection again unless its ETag is unchanged
+// and, for a recursive listing, the listing is recent.
+func (d *webdav) updateListing(ctx context.Context, st *webdavState) error {
+	root, err := d.propfind(ctx, d.url, "0")
+	if err != nil {
+		return err
+	}
+	etag := ""
+	if len(root) > 0 {
+		etag = root[0].ETag
+	}
+	fresh := !d.recursive || time.Since(st.Listed) < webdavListTTL
+	if etag != "" && etag == st.ETag && len(st.Files) > 0 && fresh {
+		return nil
+	}
+
+	files, err := d.list(ctx, d.url)
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool, len(files))
+	for _, file := range files {
+		current[file.Href] = true
+	}
+	var used []string
+	for _, href := range st.Used {
+		if current[href] {
+			used = append(used, href)
+		}
+	}
+	for href := range st.Cached {
+		if !current[href] {
+			_ = os.Remove(d.cachePath(href))
+			delete(st.Cached, href)
+		}
+	}
+	st.ETag, st.Files, st.Used, st.Listed = etag, files, used, time.Now()
+	d.save(*st)
+	return nil
+}
+
+func (d *webdav) list(ctx context.Context, dir *url.URL) ([]davFile, error) {
+	entries, err := d.propfind(ctx, dir, "1")
+	if err != nil {
+		return nil, err
+	}
+	var files []davFile
+	for _, entry := range entries {
+		if strings.TrimSuffix(entry.URL.Path, "/") == strings.TrimSuffix(dir.Path, "/") {
+			continue
+		}
+		if entry.Collection {
+			if !d.recursive {
+				continue
+			}
+			sub, err := d.list(ctx, entry.URL)
+			if err != nil {
+				log.Printf("source %s: list %s: %v", d.name, entry.URL.Path, err)
+				continue
+			}
+			files = append(files, sub...)
+			continue
+		}
+		rel := strings.TrimPrefix(entry.URL.Path, d.url.Path)
+		if !d.matches(rel, entry.ContentType) {
+			continue
+		}
+		files = append(files, davFile{Href: entry.URL.String(), Rel: rel, ETag: entry.ETag})
+	}
+	return files, nil
+}
+
+func (d *webdav) matches(rel, contentType string) bool {
+	if !isImageType(contentType, rel) {
+		return false
+	}
+	rel = filepath.FromSlash(rel)
+	if len(d.include) > 0 && !matchAny(d.include, rel) {
+		return false
+	}
+	return !matchAny(d.exclude, rel)
+}
+
+// image returns the cached copy of file if its ETag still matches and
+// downloads it otherwise.
+func (d *webdav) image(ctx context.Context, file davFile, st *webdavState) (*Image, error) {
+	cachePath := d.cachePath(file.Href)
+	if cachePath != "" && file.ETag != "" && st.Cached[file.Href] == file.ETag {
+		if img, err := readImageFile(cachePath); err == nil {
+			d.describe(img, file)
+			return img, nil
+		}
+	}
+
+	img, err := Download(ctx, d.env.Client, file.Href, d.headerFor(file.Href))
+	if err != nil {
+		return nil, err
+	}
+	d.describe(img, file)
+	if cachePath == "" {
+		return img, nil
+	}
+	if err := os.MkdirAll(d.cacheDir, 0o755); err != nil {
+		log.Printf("source %s: cache: %v", d.name, err)
+		return img, nil
+	}
+	if err := os.WriteFile(cachePath, img.Data, 0o644); err != nil {
+		log.Printf("source %s: cache: %v", d.name, err)
+		return img, nil
+	}
+	if st.Cached == nil {
+		st.Cached = make(map[string]string)
+	}
+	st.Cached[file.Href] = file.ETag
+	return img, nil
+}
+
+// headerFor returns the credentials for target if it is on the configured
+// server. A listing may point elsewhere, such as a CDN, which must not see
+// them.
+func (d *webdav) headerFor(target string) http.Header {
+	if sameOrigin(target, d.url.String()) {
+		return d.header
+	}
+	return http.Header{}
+}
+
+func (d *webdav) describe(img *Image, file davFile) {
+	name := path.Base(file.Rel)
+	img.Meta = Metadata{Title: strings.TrimSuffix(name, path.Ext(name)), URL: file.Href}
+}
+
+func (d *webdav) cachePath(href string) string {
+	if d.cacheDir == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(href))
+	ext := strings.ToLower(path.Ext(href))
+	if !IsImageFile("x" + ext) {
+		ext = ".img"
+	}
+	return filepath.Join(d.cacheDir, hex.EncodeToString(sum[:])+ext)
+}
+
+func (d *webdav) stateKey() string {
+	return "webdav:" + d.name
+}
+
+func (d *webdav) save(st webdavState) {
+	if d.env.State == nil {
+		return
+	}
+	if err := d.env.State.Put(d.stateKey(), st); err != nil {
+		log.Printf("source %s: save listing: %v", d.name, err)
+	}
+}
+
+type davEntry struct {
+	URL         *url.URL
+	ETag        string
+	ContentType string
+	Collection  bool
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ETag        string `xml:"DAV: getetag"`
+				ContentType string `xml:"DAV: getcontenttype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func (d *webdav) propfind(ctx context.Context, target *url.URL, depth string) ([]davEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", target.String(), bytes.NewBufferString(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = d.headerFor(target.String()).Clone()
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := d.env.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: unexpected status: %s", target.Path, resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxImageBytes)).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %w", target.Path, err)
+	}
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		ref, err := url.Parse(strings.TrimSpace(r.Href))
+		if err != nil {
+			continue
+		}
+		entry := davEntry{URL: target.ResolveReference(ref)}
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.ETag = ps.Prop.ETag
+			entry.ContentType = ps.Prop.ContentType
+			entry.Collection = ps.Prop.ResourceType.Collection != nil
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
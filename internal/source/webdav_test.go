@@ -0,0 +1,289 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	davfs "golang.org/x/net/webdav"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/secrets"
+	"yuluwallpaper/internal/state"
+)
+
+// davServer is a golang.org/x/net/webdav server behind Basic auth. That
+// package reports no ETag for collections, so the root's Depth 0 PROPFIND
+// is answered here with rootETag, as Nextcloud would.
+type davServer struct {
+	fs      davfs.FileSystem
+	handler *davfs.Handler
+
+	mu        sync.Mutex
+	rootETag  string
+	propfinds map[string]int
+	gets      int
+}
+
+func newDAVServer(t *testing.T, files map[string][]byte) (*davServer, *httptest.Server) {
+	t.Helper()
+	fs := davfs.NewMemFS()
+	d := &davServer{
+		fs:        fs,
+		handler:   &davfs.Handler{FileSystem: fs, LockSystem: davfs.NewMemLS()},
+		rootETag:  `"v1"`,
+		propfinds: make(map[string]int),
+	}
+	for name, data := range files {
+		d.put(t, name, data)
+	}
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	return d, srv
+}
+
+func (d *davServer) put(t *testing.T, name string, data []byte) {
+	t.Helper()
+	ctx := context.Background()
+	dir := ""
+	for _, part := range strings.Split(strings.Trim(name, "/"), "/")[:strings.Count(strings.Trim(name, "/"), "/")] {
+		dir += "/" + part
+		if err := d.fs.Mkdir(ctx, dir, 0o755); err != nil && !os.IsExist(err) {
+			t.Fatal(err)
+		}
+	}
+	f, err := d.fs.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (d *davServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="dav"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	d.mu.Lock()
+	etag := d.rootETag
+	switch r.Method {
+	case "PROPFIND":
+		d.propfinds[r.Header.Get("Depth")+" "+r.URL.Path]++
+	case http.MethodGet:
+		d.gets++
+	}
+	d.mu.Unlock()
+	if r.Method == "PROPFIND" && r.Header.Get("Depth") == "0" && r.URL.Path == "/photos/" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<D:multistatus xmlns:D="DAV:"><D:response><D:href>/photos/</D:href><D:propstat><D:prop>
+<D:resourcetype><D:collection/></D:resourcetype><D:getetag>%s</D:getetag>
+</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response></D:multistatus>`, etag)
+		return
+	}
+	d.handler.ServeHTTP(w, r)
+}
+
+func (d *davServer) count(key string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.propfinds[key]
+}
+
+func davSource(t *testing.T, url string, recursive bool, password string) Source {
+	t.Helper()
+	store, err := state.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := New(config.SourceConfig{
+		Name:        "dav",
+		Type:        config.SourceWebDAV,
+		URL:         url,
+		Recursive:   recursive,
+		Credentials: "dav",
+	}, Env{
+		Client:   http.DefaultClient,
+		State:    store,
+		Secrets:  secrets.Store{"dav": {Username: "alice", Password: password}},
+		CacheDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func fetchTitles(t *testing.T, src Source, n int) []string {
+	t.Helper()
+	var titles []string
+	for i := 0; i < n; i++ {
+		img, err := src.Fetch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		titles = append(titles, img.Meta.Title)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestWebDAVListing(t *testing.T) {
+	data := testPNG(t)
+	dav, srv := newDAVServer(t, map[string][]byte{
+		"/photos/a.png":     data,
+		"/photos/b.png":     data,
+		"/photos/notes.txt": []byte("not an image"),
+		"/photos/sub/c.png": data,
+	})
+	src := davSource(t, srv.URL+"/photos", false, "secret")
+
+	if got := fetchTitles(t, src, 2); strings.Join(got, ",") != "a,b" {
+		t.Errorf("fetched %v, want a and b", got)
+	}
+	// Every refresh checks the collection with Depth 0, but lists it with
+	// Depth 1 only once while its ETag stays the same.
+	if n := dav.count("0 /photos/"); n != 2 {
+		t.Errorf("%d Depth 0 PROPFINDs, want 2", n)
+	}
+	if n := dav.count("1 /photos/"); n != 1 {
+		t.Errorf("%d Depth 1 PROPFINDs, want 1", n)
+	}
+	if n := dav.count("1 /photos/sub/"); n != 0 {
+		t.Errorf("subfolder listed %d times without recursive", n)
+	}
+
+	// Images already downloaded come from the cache while their ETag holds.
+	gets := dav.gets
+	fetchTitles(t, src, 2)
+	if dav.gets != gets {
+		t.Errorf("%d downloads of cached images", dav.gets-gets)
+	}
+
+	// A new ETag means the collection changed and is listed again.
+	dav.put(t, "/photos/d.png", data)
+	dav.mu.Lock()
+	dav.rootETag = `"v2"`
+	dav.mu.Unlock()
+	// a and b have both been shown, so the new image comes next, and then
+	// a fresh round covers all three.
+	if got := fetchTitles(t, src, 1); strings.Join(got, ",") != "d" {
+		t.Errorf("after the change fetched %v, want d", got)
+	}
+	if got := fetchTitles(t, src, 3); strings.Join(got, ",") != "a,b,d" {
+		t.Errorf("next round fetched %v, want a, b and d", got)
+	}
+	if n := dav.count("1 /photos/"); n != 2 {
+		t.Errorf("%d Depth 1 PROPFINDs after the change, want 2", n)
+	}
+}
+
+func TestWebDAVRecursive(t *testing.T) {
+	data := testPNG(t)
+	dav, srv := newDAVServer(t, map[string][]byte{
+		"/photos/a.png":          data,
+		"/photos/sub/c.png":      data,
+		"/photos/sub/deep/e.png": data,
+	})
+	src := davSource(t, srv.URL+"/photos/", true, "secret")
+	if got := fetchTitles(t, src, 3); strings.Join(got, ",") != "a,c,e" {
+		t.Errorf("fetched %v, want a, c and e", got)
+	}
+	if dav.count("1 /photos/sub/") != 1 || dav.count("1 /photos/sub/deep/") != 1 {
+		t.Errorf("subfolders not listed once each: %v", dav.propfinds)
+	}
+}
+
+// TestWebDAVRecursiveRelists adds a file to a subfolder, which leaves the
+// root collection's ETag alone, and expects it once the listing is stale.
+func TestWebDAVRecursiveRelists(t *testing.T) {
+	data := testPNG(t)
+	dav, srv := newDAVServer(t, map[string][]byte{
+		"/photos/a.png":     data,
+		"/photos/sub/c.png": data,
+	})
+	src := davSource(t, srv.URL+"/photos/", true, "secret")
+	fetchTitles(t, src, 2)
+
+	dav.put(t, "/photos/sub/n.png", data)
+	if got := fetchTitles(t, src, 2); strings.Join(got, ",") != "a,c" {
+		t.Errorf("fetched %v from a fresh listing, want a and c", got)
+	}
+	if n := dav.count("1 /photos/"); n != 1 {
+		t.Errorf("listed %d times within webdavListTTL, want once", n)
+	}
+
+	d := src.(*webdav)
+	var st webdavState
+	d.env.State.Get(d.stateKey(), &st)
+	st.Listed = st.Listed.Add(-webdavListTTL)
+	d.save(st)
+	if got := fetchTitles(t, src, 1); strings.Join(got, ",") != "n" {
+		t.Errorf("fetched %v after the listing went stale, want the new n", got)
+	}
+	if n := dav.count("1 /photos/"); n != 2 {
+		t.Errorf("listed %d times, want 2", n)
+	}
+}
+
+func TestWebDAVBasicAuth(t *testing.T) {
+	_, srv := newDAVServer(t, map[string][]byte{"/photos/a.png": testPNG(t)})
+	src := davSource(t, srv.URL+"/photos", false, "wrong")
+	if _, err := src.Fetch(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("fetch with a wrong password = %v, want 401", err)
+	}
+}
+
+// TestWebDAVCredentialsStayOnServer lists a file on another host, as a
+// share backed by a CDN might; it must be fetched without the credentials.
+func TestWebDAVCredentialsStayOnServer(t *testing.T) {
+	data := testPNG(t)
+	var cdnAuth string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = r.Header.Get("Authorization")
+		w.Write(data)
+	}))
+	defer cdn.Close()
+	var davAuth []string
+	dav := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		davAuth = append(davAuth, r.Header.Get("Authorization"))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">`)
+		fmt.Fprint(w, `<D:response><D:href>/photos/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`)
+		if r.Header.Get("Depth") == "1" {
+			for _, href := range []string{"/photos/local.png", cdn.URL + "/photos/remote.png"} {
+				fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontenttype>image/png</D:getcontenttype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`, href)
+			}
+		}
+		fmt.Fprint(w, `</D:multistatus>`)
+	}))
+	defer dav.Close()
+
+	src := davSource(t, dav.URL+"/photos", false, "secret")
+	if got := fetchTitles(t, src, 2); strings.Join(got, ",") != "local,remote" {
+		t.Fatalf("fetched %v, want local and remote", got)
+	}
+	if cdnAuth != "" {
+		t.Errorf("credentials sent to another host: %q", cdnAuth)
+	}
+	for _, auth := range davAuth {
+		if !strings.HasPrefix(auth, "Basic ") {
+			t.Errorf("request to the server without credentials: %q", auth)
+		}
+	}
+}
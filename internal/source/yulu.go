@@ -0,0 +1,194 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/sysinfo"
+)
+
+const YuluURL = "https://yulu.frogchou.com/api/v1/quotes/getdesktoppic"
+
+// yulu fetches from an endpoint that answers with the image itself, such
+// as the quotes site's getdesktoppic.
+type yulu struct {
+	name      string
+	url       string
+	integrity Integrity
+	env       Env
+
+	hints         map[string]bool
+	width, height int
+	orientation   string
+	language      string
+	category      string
+	tags          []string
+}
+
+func newYulu(cfg config.SourceConfig, env Env) (*yulu, error) {
+	endpoint := cfg.URL
+	if endpoint == "" {
+		endpoint = YuluURL
+	}
+	y := &yulu{name: cfg.Name, url: endpoint, env: env}
+	y.integrity.RequireDigest = cfg.RequireDigest
+	if cfg.PublicKey != "" {
+		key, err := parsePublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		y.integrity.PublicKey = key
+	}
+	if err := y.configureHints(cfg); err != nil {
+		return nil, err
+	}
+	return y, nil
+}
+
+// configureHints checks the hint settings. Custom URLs get no hints unless
+// asked for, as they may not expect extra parameters or may be signed.
+func (y *yulu) configureHints(cfg config.SourceConfig) error {
+	names := cfg.Hints
+	if len(names) == 0 && cfg.URL == "" {
+		names = []string{config.HintResolution, config.HintScale, config.HintOrientation, config.HintLanguage}
+	}
+	y.hints = make(map[string]bool)
+	for _, name := range names {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case config.HintResolution, config.HintScale, config.HintOrientation, config.HintLanguage:
+			y.hints[name] = true
+		case config.HintNone:
+		default:
+			return fmt.Errorf("unknown hint %q, want resolution, scale, orientation, lang or none", name)
+		}
+	}
+	if cfg.Resolution != "" {
+		if _, err := fmt.Sscanf(strings.ToLower(cfg.Resolution), "%dx%d", &y.width, &y.height); err != nil || y.width <= 0 || y.height <= 0 {
+			return fmt.Errorf("invalid resolution %q, want WIDTHxHEIGHT", cfg.Resolution)
+		}
+	}
+	switch y.orientation = strings.ToLower(strings.TrimSpace(cfg.Orientation)); y.orientation {
+	case "", config.OrientationLandscape, config.OrientationPortrait:
+	default:
+		return fmt.Errorf("unknown orientation %q, want landscape or portrait", cfg.Orientation)
+	}
+	y.language = strings.TrimSpace(cfg.Language)
+	y.category = strings.TrimSpace(cfg.Category)
+	for _, tag := range cfg.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			y.tags = append(y.tags, tag)
+		}
+	}
+	return nil
+}
+
+func (y *yulu) Name() string {
+	return y.name
+}
+
+// Fetch sends the validators of the previous response, so a server that
+// would return the same image again can answer 304 instead.
+func (y *yulu) Fetch(ctx context.Context) (*Image, error) {
+	endpoint, err := y.endpoint(nil)
+	if err != nil {
+		return nil, err
+	}
+	var last validators
+	if y.env.State != nil {
+		y.env.State.Get(y.stateKey(), &last)
+	}
+	img, header, err := download(ctx, y.env.Client, endpoint, last.header(), y.integrity)
+	if err != nil {
+		return nil, err
+	}
+	if y.env.State != nil {
+		if err := y.env.State.Put(y.stateKey(), validatorsOf(header)); err != nil {
+			log.Printf("source %s: save validators: %v", y.name, err)
+		}
+	}
+	return img, nil
+}
+
+func (y *yulu) stateKey() string {
+	return "yulu:" + y.name
+}
+
+func (y *yulu) FetchTheme(ctx context.Context, param, theme string) (*Image, error) {
+	endpoint, err := y.endpoint(url.Values{param: {theme}})
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := download(ctx, y.env.Client, endpoint, nil, y.integrity)
+	return img, err
+}
+
+// endpoint adds extra and the hints to the configured URL. Parameters
+// already in the URL are kept as they are.
+func (y *yulu) endpoint(extra url.Values) (string, error) {
+	u, err := url.Parse(y.url)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, values := range extra {
+		query[key] = values
+	}
+	for key, values := range y.query() {
+		if !query.Has(key) {
+			query[key] = values
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// query describes this machine as configured. It is worked out on every
+// request, since displays and language can change while running.
+func (y *yulu) query() url.Values {
+	query := url.Values{}
+	if y.category != "" {
+		query.Set("category", y.category)
+	}
+	if len(y.tags) > 0 {
+		query.Set("tags", strings.Join(y.tags, ","))
+	}
+	width, height := y.width, y.height
+	if width == 0 && (y.hints[config.HintResolution] || y.hints[config.HintOrientation] && y.orientation == "") {
+		width, height, _ = sysinfo.ScreenSize()
+	}
+	if y.hints[config.HintResolution] && width > 0 && height > 0 {
+		query.Set("resolution", fmt.Sprintf("%dx%d", width, height))
+	}
+	if y.hints[config.HintScale] {
+		if scale, err := sysinfo.ScaleFactor(); err == nil && scale > 0 {
+			query.Set("scale", strconv.FormatFloat(scale, 'f', -1, 64))
+		}
+	}
+	if y.hints[config.HintOrientation] {
+		orientation := y.orientation
+		if orientation == "" && width > 0 && height > 0 {
+			orientation = config.OrientationLandscape
+			if height > width {
+				orientation = config.OrientationPortrait
+			}
+		}
+		if orientation != "" {
+			query.Set("orientation", orientation)
+		}
+	}
+	if y.hints[config.HintLanguage] {
+		language := y.language
+		if language == "" {
+			language, _ = sysinfo.Locale()
+		}
+		if language != "" {
+			query.Set("lang", language)
+		}
+	}
+	return query
+}
@@ -0,0 +1,139 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"yuluwallpaper/internal/config"
+	"yuluwallpaper/internal/sysinfo"
+)
+
+// yuluQuery fetches once from a yulu source pointed at a test server and
+// returns the query the server saw. builtIn configures the source as if it
+// used the built-in URL.
+func yuluQuery(t *testing.T, cfg config.SourceConfig, builtIn bool) url.Values {
+	t.Helper()
+	data := testPNG(t)
+	var got url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query()
+		w.Write(data)
+	}))
+	defer srv.Close()
+	if cfg.URL == "" && !builtIn {
+		cfg.URL = srv.URL + "/pic"
+	}
+	cfg.Name, cfg.Type = "yulu", config.SourceYulu
+	y, err := newYulu(cfg, Env{Client: http.DefaultClient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if builtIn {
+		y.url = srv.URL + "/pic"
+	}
+	if _, err := y.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestYuluHints(t *testing.T) {
+	scale := ""
+	if s, err := sysinfo.ScaleFactor(); err == nil && s > 0 {
+		scale = strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	for _, tc := range []struct {
+		name    string
+		cfg     config.SourceConfig
+		builtIn bool
+		want    url.Values
+	}{
+		{
+			name:    "built-in URL sends every hint",
+			cfg:     config.SourceConfig{Resolution: "1920x1080", Language: "zh-CN"},
+			builtIn: true,
+			want:    url.Values{"resolution": {"1920x1080"}, "scale": {scale}, "orientation": {"landscape"}, "lang": {"zh-CN"}},
+		},
+		{
+			name:    "orientation follows the resolution",
+			cfg:     config.SourceConfig{Resolution: "1080X1920", Language: "en"},
+			builtIn: true,
+			want:    url.Values{"resolution": {"1080x1920"}, "scale": {scale}, "orientation": {"portrait"}, "lang": {"en"}},
+		},
+		{
+			name:    "orientation override",
+			cfg:     config.SourceConfig{Resolution: "1920x1080", Orientation: "Portrait", Language: "en", Hints: []string{"orientation", " LANG "}},
+			builtIn: true,
+			want:    url.Values{"orientation": {"portrait"}, "lang": {"en"}},
+		},
+		{
+			name:    "category and tags without hints",
+			cfg:     config.SourceConfig{Hints: []string{"none"}, Category: " nature ", Tags: []string{"sea", " ", "dawn "}},
+			builtIn: true,
+			want:    url.Values{"category": {"nature"}, "tags": {"sea,dawn"}},
+		},
+		{
+			name: "custom URL gets no hints by default",
+			cfg:  config.SourceConfig{Resolution: "1920x1080", Language: "en", Category: "city"},
+			want: url.Values{"category": {"city"}},
+		},
+		{
+			name: "custom URL with hints asked for",
+			cfg:  config.SourceConfig{Resolution: "1920x1080", Hints: []string{"resolution"}},
+			want: url.Values{"resolution": {"1920x1080"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.want.Get("scale") == "" {
+				tc.want.Del("scale")
+			}
+			got := yuluQuery(t, tc.cfg, tc.builtIn)
+			if got.Encode() != tc.want.Encode() {
+				t.Errorf("query %q, want %q", got.Encode(), tc.want.Encode())
+			}
+		})
+	}
+}
+
+func TestYuluKeepsURLParameters(t *testing.T) {
+	y, err := newYulu(config.SourceConfig{
+		Name:     "yulu",
+		Type:     config.SourceYulu,
+		URL:      "https://example.com/pic?sig=abc&resolution=800x600&category=keep",
+		Hints:    []string{"resolution"},
+		Category: "other",
+		Tags:     []string{"sea"},
+	}, Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint, err := y.endpoint(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"sig": {"abc"}, "resolution": {"800x600"}, "category": {"keep"}, "tags": {"sea"}}
+	if got := u.Query(); got.Encode() != want.Encode() {
+		t.Errorf("query %q, want %q", got.Encode(), want.Encode())
+	}
+}
+
+func TestYuluInvalidHints(t *testing.T) {
+	for _, cfg := range []config.SourceConfig{
+		{Hints: []string{"weather"}},
+		{Resolution: "big"},
+		{Resolution: "0x1080"},
+		{Orientation: "square"},
+	} {
+		if _, err := newYulu(cfg, Env{}); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package sysinfo
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statusTTL bounds how stale power and Wi-Fi readings from commands
+	// may be; rules are evaluated every minute.
+	statusTTL = 2 * time.Minute
+	// displayTTL is for display and locale settings, which rarely change
+	// and which system_profiler takes seconds to list on macOS.
+	displayTTL = 30 * time.Minute
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+type Power string
+
+const (
+	PowerUnknown Power = ""
+	PowerAC      Power = "ac"
+	PowerBattery Power = "battery"
+)
+
+func PowerSource() (Power, error) {
+	return powerSource()
+}
+
+// WiFiSSID returns the SSID of the connected wireless network, or an empty
+// string when there is none.
+func WiFiSSID() (string, error) {
+	return wifiSSID()
+}
+
+func MonitorCount() (int, error) {
+	return monitorCount()
+}
+
+// ScreenSize returns the resolution of the primary display in pixels.
+func ScreenSize() (width, height int, err error) {
+	return screenSize()
+}
+
+// ScaleFactor returns how many physical pixels the desktop uses per
+// logical pixel on the primary display, such as 2 on a Retina screen.
+func ScaleFactor() (float64, error) {
+	return scaleFactor()
+}
+
+// Locale returns the user's locale as a BCP 47 tag such as "zh-CN".
+func Locale() (string, error) {
+	return locale()
+}
+
+// commandCache keeps the output of a probe command, or its error, for ttl
+// so that evaluating rules does not start a process each time.
+type commandCache struct {
+	ttl time.Duration
+
+	mu  sync.Mutex
+	at  time.Time
+	out []byte
+	err error
+}
+
+func (c *commandCache) output(run func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.at.IsZero() || now().Sub(c.at) >= c.ttl {
+		c.out, c.err = run()
+		c.at = now()
+	}
+	return c.out, c.err
+}
+
+func localeFromEnv() string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := normalizeLocale(os.Getenv(key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// normalizeLocale turns POSIX names like "zh_CN.UTF-8" into "zh-CN".
+func normalizeLocale(value string) string {
+	value, _, _ = strings.Cut(value, ".")
+	value, _, _ = strings.Cut(value, "@")
+	if value == "" || value == "C" || value == "POSIX" {
+		return ""
+	}
+	return strings.ReplaceAll(value, "_", "-")
+}
@@ -0,0 +1,129 @@
+//go:build darwin
+
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var (
+	pmsetOutput    = &commandCache{ttl: statusTTL}
+	airportOutput  = &commandCache{ttl: statusTTL}
+	displaysOutput = &commandCache{ttl: displayTTL}
+	localeOutput   = &commandCache{ttl: displayTTL}
+)
+
+// displays lists the displays; monitorCount, screenSize and scaleFactor
+// share one slow system_profiler run.
+func displays() ([]byte, error) {
+	return displaysOutput.output(exec.Command("system_profiler", "SPDisplaysDataType").Output)
+}
+
+func powerSource() (Power, error) {
+	out, err := pmsetOutput.output(exec.Command("pmset", "-g", "batt").Output)
+	if err != nil {
+		return PowerUnknown, err
+	}
+	switch {
+	case bytes.Contains(out, []byte("'AC Power'")):
+		return PowerAC, nil
+	case bytes.Contains(out, []byte("'Battery Power'")):
+		return PowerBattery, nil
+	default:
+		return PowerUnknown, nil
+	}
+}
+
+func wifiSSID() (string, error) {
+	out, err := airportOutput.output(exec.Command("networksetup", "-getairportnetwork", "en0").Output)
+	if err != nil {
+		return "", err
+	}
+	_, ssid, ok := strings.Cut(strings.TrimSpace(string(out)), "Current Wi-Fi Network: ")
+	if !ok {
+		return "", nil
+	}
+	return ssid, nil
+}
+
+func monitorCount() (int, error) {
+	out, err := displays()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "Resolution:") {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// screenSize reads the first display's resolution from system_profiler,
+// which lists the main display first.
+func screenSize() (int, int, error) {
+	out, err := displays()
+	if err != nil {
+		return 0, 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "Resolution:")
+		if !ok {
+			continue
+		}
+		var width, height int
+		if _, err := fmt.Sscanf(strings.TrimSpace(value), "%d x %d", &width, &height); err == nil {
+			return width, height, nil
+		}
+	}
+	return 0, 0, errors.New("no display resolution found")
+}
+
+// scaleFactor compares the main display's resolution with the size the
+// UI looks like, which system_profiler only lists for scaled displays.
+func scaleFactor() (float64, error) {
+	out, err := displays()
+	if err != nil {
+		return 0, err
+	}
+	var width, looksLike int
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, ok := strings.CutPrefix(line, "Resolution:"); ok {
+			if width > 0 {
+				break
+			}
+			fmt.Sscanf(strings.TrimSpace(value), "%d x", &width)
+		} else if value, ok := strings.CutPrefix(line, "UI Looks like:"); ok && width > 0 {
+			fmt.Sscanf(strings.TrimSpace(value), "%d x", &looksLike)
+			break
+		}
+	}
+	switch {
+	case width <= 0:
+		return 0, errors.New("no display resolution found")
+	case looksLike <= 0:
+		return 1, nil
+	}
+	return float64(width) / float64(looksLike), nil
+}
+
+func locale() (string, error) {
+	if value := localeFromEnv(); value != "" {
+		return value, nil
+	}
+	out, err := localeOutput.output(exec.Command("defaults", "read", "-g", "AppleLocale").Output)
+	if err != nil {
+		return "", err
+	}
+	return normalizeLocale(strings.TrimSpace(string(out))), nil
+}
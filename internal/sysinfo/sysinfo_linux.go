@@ -0,0 +1,120 @@
+//go:build linux
+
+package sysinfo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	nmcliOutput     = &commandCache{ttl: statusTTL}
+	gsettingsOutput = &commandCache{ttl: displayTTL}
+)
+
+func powerSource() (Power, error) {
+	supplies, err := filepath.Glob("/sys/class/power_supply/*")
+	if err != nil {
+		return PowerUnknown, err
+	}
+	power := PowerUnknown
+	for _, supply := range supplies {
+		kind := readTrimmed(filepath.Join(supply, "type"))
+		switch {
+		case kind == "Mains" && readTrimmed(filepath.Join(supply, "online")) == "1":
+			return PowerAC, nil
+		case kind == "Battery" && readTrimmed(filepath.Join(supply, "status")) == "Discharging":
+			power = PowerBattery
+		}
+	}
+	if power == PowerUnknown && len(supplies) == 0 {
+		return PowerAC, nil
+	}
+	return power, nil
+}
+
+func wifiSSID() (string, error) {
+	out, err := nmcliOutput.output(exec.Command("nmcli", "-t", "-f", "active,ssid", "dev", "wifi").Output)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if ssid, ok := strings.CutPrefix(line, "yes:"); ok {
+			return strings.ReplaceAll(ssid, `\:`, ":"), nil
+		}
+	}
+	return "", nil
+}
+
+func monitorCount() (int, error) {
+	connectors, err := filepath.Glob("/sys/class/drm/card*-*/status")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, status := range connectors {
+		if readTrimmed(status) == "connected" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// screenSize takes the preferred mode of the first connected output, which
+// DRM lists first in each connector's modes file.
+func screenSize() (int, int, error) {
+	connectors, err := filepath.Glob("/sys/class/drm/card*-*")
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, connector := range connectors {
+		if readTrimmed(filepath.Join(connector, "status")) != "connected" {
+			continue
+		}
+		mode, _, _ := strings.Cut(readTrimmed(filepath.Join(connector, "modes")), "\n")
+		var width, height int
+		if _, err := fmt.Sscanf(mode, "%dx%d", &width, &height); err == nil {
+			return width, height, nil
+		}
+	}
+	return 0, 0, errors.New("no connected display found")
+}
+
+// scaleFactor follows the toolkit overrides, then GNOME's integer scaling
+// setting, where 0 means automatic and so tells nothing.
+func scaleFactor() (float64, error) {
+	for _, key := range []string{"GDK_SCALE", "QT_SCALE_FACTOR"} {
+		if scale, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil && scale > 0 {
+			return scale, nil
+		}
+	}
+	out, err := gsettingsOutput.output(exec.Command("gsettings", "get", "org.gnome.desktop.interface", "scaling-factor").Output)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimPrefix(strings.TrimSpace(string(out)), "uint32 ")
+	if scale, err := strconv.ParseFloat(value, 64); err == nil && scale > 0 {
+		return scale, nil
+	}
+	return 0, errors.New("scale factor not set")
+}
+
+func locale() (string, error) {
+	if value := localeFromEnv(); value != "" {
+		return value, nil
+	}
+	return "", errors.New("locale not set")
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
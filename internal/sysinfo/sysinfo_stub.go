@@ -0,0 +1,34 @@
+//go:build !windows && !darwin && !linux
+
+package sysinfo
+
+import "errors"
+
+var errUnsupported = errors.New("system information not supported on this platform")
+
+func powerSource() (Power, error) {
+	return PowerUnknown, errUnsupported
+}
+
+func wifiSSID() (string, error) {
+	return "", errUnsupported
+}
+
+func monitorCount() (int, error) {
+	return 0, errUnsupported
+}
+
+func screenSize() (int, int, error) {
+	return 0, 0, errUnsupported
+}
+
+func scaleFactor() (float64, error) {
+	return 0, errUnsupported
+}
+
+func locale() (string, error) {
+	if value := localeFromEnv(); value != "" {
+		return value, nil
+	}
+	return "", errUnsupported
+}
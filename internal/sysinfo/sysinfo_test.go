@@ -0,0 +1,57 @@
+package sysinfo
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCommandCache(t *testing.T) {
+	clock := time.Date(2024, 2, 10, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	runs := 0
+	fail := false
+	run := func() ([]byte, error) {
+		runs++
+		if fail {
+			return nil, errors.New("no such command")
+		}
+		return []byte{byte(runs)}, nil
+	}
+	c := &commandCache{ttl: time.Minute}
+	for i := 0; i < 3; i++ {
+		if out, err := c.output(run); err != nil || out[0] != 1 {
+			t.Fatalf("output = %v, %v", out, err)
+		}
+	}
+	if runs != 1 {
+		t.Errorf("ran %d times within the TTL", runs)
+	}
+
+	clock = clock.Add(time.Minute)
+	fail = true
+	if _, err := c.output(run); err == nil || runs != 2 {
+		t.Errorf("expired cache: err %v after %d runs", err, runs)
+	}
+	// Failures are kept too, so a missing command is not retried each time.
+	if _, err := c.output(run); err == nil || runs != 2 {
+		t.Errorf("failure not cached: err %v after %d runs", err, runs)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	for in, want := range map[string]string{
+		"zh_CN.UTF-8":      "zh-CN",
+		"en_US":            "en-US",
+		"de_DE.UTF-8@euro": "de-DE",
+		"C":                "",
+		"POSIX":            "",
+		"":                 "",
+	} {
+		if got := normalizeLocale(in); got != want {
+			t.Errorf("normalizeLocale(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
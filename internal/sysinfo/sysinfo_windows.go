@@ -0,0 +1,107 @@
+//go:build windows
+
+package sysinfo
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	smCXScreen        = 0
+	smCYScreen        = 1
+	smCMonitors       = 80
+	localeNameMaxLen  = 85
+	createNoWindow    = 0x08000000
+	acLineOnline      = 1
+	acLineOffline     = 0
+	batteryFlagAbsent = 128
+)
+
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+func powerSource() (Power, error) {
+	var status systemPowerStatus
+	proc := windows.NewLazySystemDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+	ret, _, err := proc.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return PowerUnknown, err
+	}
+	switch {
+	case status.ACLineStatus == acLineOffline:
+		return PowerBattery, nil
+	case status.ACLineStatus == acLineOnline, status.BatteryFlag&batteryFlagAbsent != 0:
+		return PowerAC, nil
+	default:
+		return PowerUnknown, nil
+	}
+}
+
+var netshOutput = &commandCache{ttl: statusTTL}
+
+func wifiSSID() (string, error) {
+	cmd := exec.Command("netsh", "wlan", "show", "interfaces")
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNoWindow}
+	out, err := netshOutput.output(cmd.Output)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "SSID" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", nil
+}
+
+func monitorCount() (int, error) {
+	proc := windows.NewLazySystemDLL("user32.dll").NewProc("GetSystemMetrics")
+	ret, _, _ := proc.Call(uintptr(smCMonitors))
+	return int(ret), nil
+}
+
+func screenSize() (int, int, error) {
+	proc := windows.NewLazySystemDLL("user32.dll").NewProc("GetSystemMetrics")
+	width, _, _ := proc.Call(uintptr(smCXScreen))
+	height, _, _ := proc.Call(uintptr(smCYScreen))
+	return int(width), int(height), nil
+}
+
+// scaleFactor uses the system DPI, where 96 is 100%. Windows before 10
+// has no GetDpiForSystem and is taken as unscaled.
+func scaleFactor() (float64, error) {
+	proc := windows.NewLazySystemDLL("user32.dll").NewProc("GetDpiForSystem")
+	if err := proc.Find(); err != nil {
+		return 1, nil
+	}
+	dpi, _, _ := proc.Call()
+	if dpi == 0 {
+		return 1, nil
+	}
+	return float64(dpi) / 96, nil
+}
+
+func locale() (string, error) {
+	buf := make([]uint16, localeNameMaxLen)
+	proc := windows.NewLazySystemDLL("kernel32.dll").NewProc("GetUserDefaultLocaleName")
+	ret, _, err := proc.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if ret == 0 {
+		return "", err
+	}
+	return windows.UTF16ToString(buf), nil
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package wallpaper
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+const gnomeBackgroundSchema = "org.gnome.desktop.background"
+
+func setWallpaper(path string, layout Layout) error {
+	if _, err := exec.LookPath("gsettings"); err != nil {
+		return errors.New("wallpaper not supported on this desktop: gsettings not found")
+	}
+
+	options := "zoom"
+	switch layout {
+	case LayoutTile:
+		options = "wallpaper"
+	case LayoutCenter:
+		options = "centered"
+	case LayoutFit:
+		options = "scaled"
+	case LayoutFill:
+		options = "zoom"
+	case LayoutStretch:
+		options = "stretched"
+	}
+
+	uri := (&url.URL{Scheme: "file", Path: path}).String()
+	if err := gsettingsSet("picture-uri", uri); err != nil {
+		return err
+	}
+	// GNOME 42+ shows picture-uri-dark when the dark style is active; older
+	// versions do not have the key at all.
+	if exec.Command("gsettings", "writable", gnomeBackgroundSchema, "picture-uri-dark").Run() == nil {
+		if err := gsettingsSet("picture-uri-dark", uri); err != nil {
+			return err
+		}
+	}
+	return gsettingsSet("picture-options", options)
+}
+
+func gsettingsSet(key, value string) error {
+	out, err := exec.Command("gsettings", "set", gnomeBackgroundSchema, key, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gsettings set %s failed: %w: %s", key, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}